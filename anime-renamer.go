@@ -4,23 +4,38 @@
 The intention of this program is to rename anime videos and
 subtitle files so mpv can find the subtitles and auto load them.
 
-It assumes the videos and subtitles are in the same folder.
+It assumes the videos and subtitles are in the same folder unless
+-sub-folder names a separate folder for the subtitles. The planned
+renames are listed and confirmed before anything is changed, and
+-undo reverts the most recent batch.
 
-Possible video formats: .mkv, .mp4, .avi
+Usage:
 
-Possible subtitle formats: .srt, .ass
+	anime-renamer [-folder path] [-name "Show Name"] [-yes] [-dry-run]
+	anime-renamer [flags] path ["Show Name"]
+	anime-renamer parse "file name" ...
+
+The folder and anime name can also be given as arguments, and are
+prompted for when not given at all. Every flag is described by -help,
+and README.md covers the features in more detail.
 
 The program will try to find the episode number in the following order:
 
-1. S1 - 01
+1. S1 - 01 (season-dash)
+
+2. S1E01 (season-episode)
+
+3. E01 (episode)
+
+4. - 01 (dash)
 
-2. S1E01
+5. Ep05, Ep. 5 or Episode 5 (ep)
 
-3. E01
+6. #05 (hash)
 
-4. - 01
+7. [12] or (12) (brackets)
 
-5. 01 or 001 at the end or before space
+8. 01, 001 or 1015 at the end or before space (trailing)
 
 If season number isn't found in either the video or subtitle file name,
 it will normalize to only use episode number.
@@ -29,6 +44,9 @@ then the file names will be E1..E24
 
 If season number *is* found in both the video and subtitle file name,
 then season number will be retained.
+
+The scanning, pairing and renaming live in the renamer package, so other
+programs can import them; this command only adds the flags and prompts.
 */
 package main
 
@@ -41,629 +59,1128 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+
+	"anime-renamer/thing/renamer"
 )
 
-type FileInfo struct {
-	Path      string
-	Season    int
-	Episode   int
-	Extension string
+type AppConfig struct {
+	FolderPath       string
+	SubFolder        string
+	AnimeName        string
+	NameCase         string
+	DryRun           bool
+	AssumeYes        bool
+	DefaultAnswer    string
+	Undo             bool
+	Batch            bool
+	Orphans          string
+	JSON             bool
+	Verbose          bool
+	Quiet            bool
+	NoColor          bool
+	Template         string
+	Preset           string
+	SeasonSubfolders bool
+	Mode             string
+	OutputDir        string
+	LinkDir          string
+	ReplaceLinks     bool
+	KeepModTimes     bool
+	ContinueOnError  bool
+	Backup           bool
+	ConvertUTF8      bool
+	MpvPlaylist      string
+	MapFile          string
+	TitlesFile       string
+	Workers          int
+	MaxFiles         int
+	Force            bool
+	Recursive        bool
+	GroupByDir       bool
+	FoldParts        bool
+	FuzzyNames       bool
+	FindDuplicates   bool
+	SeasonOffset     int
+	Season           int
+	FinalSeason      int
+	Sniff            bool
+	NoSubs           bool
+	SubsOnly         bool
+	SeasonCounts     []int
+
+	VideoExtensions    []string
+	SubtitleExtensions []string
+	NoiseTokens        []string
+
+	EpisodePatterns      []string
+	EpisodePatternsFirst bool
+	PatternOrder         []string
 }
 
-type FilePair struct {
-	Video    FileInfo
-	Subtitle FileInfo
-}
+// stdinReader and messageOutput are the input and output handed to the
+// prompts, so tests can script the answers and capture what is printed.
+var stdinReader = bufio.NewReader(os.Stdin)
 
-type RenameOperation struct {
-	OldPath string
-	NewPath string
-}
+var messageOutput io.Writer = os.Stdout
 
-type AppConfig struct {
-	FolderPath string
-	AnimeName  string
-	DryRun     bool
-}
+var episodeOverridePattern = regexp.MustCompile(`(?i)^(?:S(\d+)\s*)?E?(\d+)(?:\.(\d))?$`)
 
-type episodePattern struct {
-	regex        *regexp.Regexp
-	seasonIndex  int
-	episodeIndex int
-}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "parse" {
+		if err := runParse(os.Args[2:], os.Stdout, defaultConfigPath()); err != nil && !errors.Is(err, flag.ErrHelp) {
+			exitWithError(err)
+		}
 
-type PreflightError struct {
-	Issues []string
-}
+		return
+	}
 
-func (e *PreflightError) Error() string {
-	return "preflight checks failed:\n - " + strings.Join(e.Issues, "\n - ")
-}
+	config, err := loadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 
-type RenameExecutionError struct {
-	Phase string
-	From  string
-	To    string
-	Err   error
-}
+	if err == nil {
+		switch {
+		case config.Undo:
+			err = runUndo(config)
+		case config.Batch:
+			err = runBatch(config)
+		default:
+			err = run(config)
+		}
+	}
 
-func (e *RenameExecutionError) Error() string {
-	return fmt.Sprintf("rename failed during %s (%s -> %s): %v", e.Phase, e.From, e.To, e.Err)
+	if err != nil {
+		exitWithError(err)
+	}
 }
 
-func (e *RenameExecutionError) Unwrap() error {
-	return e.Err
-}
+// run scans, pairs, plans and renames the files in config.FolderPath. It
+// only prompts when the config leaves something open and returns every
+// failure so main alone decides how to report it.
+func run(config AppConfig) error {
+	scan, err := scanFiles(config)
+	if err != nil {
+		return err
+	}
 
-type renameExecutor func(oldPath string, newPath string) error
+	shows := scan.Shows
 
-type renameState struct {
-	RenameOperation
-	TempPath    string
-	CurrentPath string
-}
+	if len(shows) > 1 {
+		if config.AnimeName != "" {
+			return fmt.Errorf("the folder holds %d different shows, leave out -name to name each one", len(shows))
+		}
 
-var stdinReader = bufio.NewReader(os.Stdin)
+		infof("\nThe folder holds %d different shows, each is paired and named on its own.\n", len(shows))
+	}
 
-var episodePatterns = []episodePattern{
-	{regex: regexp.MustCompile(`(?i)S(\d+)\s*-\s*(\d+)`), seasonIndex: 1, episodeIndex: 2},
-	{regex: regexp.MustCompile(`(?i)S(\d+)(?:\s|E)(\d+)`), seasonIndex: 1, episodeIndex: 2},
-	{regex: regexp.MustCompile(`(?i)E(\d+)`), seasonIndex: 0, episodeIndex: 1},
-	{regex: regexp.MustCompile(`\s-\s\(?(\d+)\)?`), seasonIndex: 0, episodeIndex: 1},
-	{regex: regexp.MustCompile(`\s(\d{2,3})(?:\s|$)`), seasonIndex: 0, episodeIndex: 1},
-}
+	pairs := []renamer.FilePair{}
+	unmatched := []renamer.FileInfo{}
+	operations := []renamer.RenameOperation{}
+	for _, show := range shows {
+		showPairs, showUnmatched, showOperations, err := planShow(config, show.Videos, show.Subtitles, scan.Patterns)
+		if err != nil {
+			return err
+		}
 
-var flexiblePattern = regexp.MustCompile(`\d+`)
+		pairs = append(pairs, showPairs...)
+		unmatched = append(unmatched, showUnmatched...)
+		operations = append(operations, showOperations...)
+	}
 
-var videoExtensions = []string{".mkv", ".mp4", ".avi"}
+	if config.FindDuplicates {
+		if err := reportDuplicates(pairs, unmatched, scan); err != nil {
+			return err
+		}
+	}
 
-var subtitleExtensions = []string{".srt", ".ass"}
+	if config.MpvPlaylist != "" {
+		return writeMpvPlaylist(config.MpvPlaylist, pairs)
+	}
 
-func main() {
-	config, err := loadConfig()
-	if err != nil {
-		exitWithError(err)
+	executeOptions := renamer.ExecuteOptions{
+		Mode:             config.Mode,
+		DryRun:           config.DryRun,
+		ReplaceLinks:     config.ReplaceLinks,
+		PreserveModTimes: config.KeepModTimes,
+		ContinueOnError:  config.ContinueOnError,
+	}
+	if err := renamer.Preflight(operations, executeOptions); err != nil {
+		emitRunReport(config, pairs, unmatched, nil, err)
+		return err
 	}
 
-	videoFiles, err := findFiles(config.FolderPath, videoExtensions)
-	if err != nil {
-		exitWithError(err)
+	if config.DryRun {
+		infof("\nDry-run mode enabled. No files will be changed.\n")
+		printOperations(operations, true, config.Mode)
+		emitRunReport(config, pairs, unmatched, operations, nil)
+		fmt.Fprintf(
+			messageOutput,
+			"Dry-run complete: %d of %d operations would have renamed a file. Nothing was changed.\n",
+			renamer.CountPendingOperations(operations),
+			len(operations),
+		)
+		return nil
 	}
 
-	subtitleFiles, err := findFiles(config.FolderPath, subtitleExtensions)
-	if err != nil {
-		exitWithError(err)
+	if !config.AssumeYes {
+		printPlan(operations)
+		confirmed, err := confirmRename(stdinReader, messageOutput, config.DefaultAnswer)
+		if err != nil {
+			return err
+		}
+
+		if confirmed {
+			confirmed, err = confirmOverwrites(operations)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !confirmed {
+			fmt.Fprintln(messageOutput, "Renaming cancelled.")
+			return nil
+		}
+	}
+
+	// The backup is made after the checks and the confirmation, so a
+	// cancelled run leaves nothing behind, and a failed one stops the
+	// batch before any file is renamed.
+	if config.Backup && renamer.CountPendingOperations(operations) > 0 {
+		backupDir, err := renamer.BackupOriginals(config.FolderPath, operations, time.Now())
+		if err != nil {
+			return fmt.Errorf("backup failed, nothing was renamed: %w", err)
+		}
+
+		infof("Backed up the originals to %s\n", backupDir)
 	}
 
-	if len(videoFiles) == 0 && len(subtitleFiles) == 0 {
-		exitWithError(errors.New("no video or subtitle files found"))
+	executeOptions.Progress = newProgress(progressVerb(config.Mode))
+	executionErr := renamer.Execute(operations, executeOptions)
+	emitRunReport(config, pairs, unmatched, operations, executionErr)
+	stats := renamer.BuildRunReport(pairs, unmatched, operations, false, executionErr).Stats
+
+	// With -continue-on-error the renames that went through are listed and
+	// journaled like a whole batch before the failures are returned.
+	var partialErr *renamer.PartialExecutionError
+	if errors.As(executionErr, &partialErr) {
+		operations = partialErr.Completed(operations)
 	}
 
-	if len(videoFiles) != len(subtitleFiles) {
-		fmt.Printf(
+	if executionErr == nil || partialErr != nil {
+		printOperations(operations, false, config.Mode)
+		if config.ConvertUTF8 {
+			convertSubtitles(operations)
+		}
+	}
+
+	printSummary(stats, config.Mode)
+	if executionErr != nil && partialErr == nil {
+		return executionErr
+	}
+
+	// The renames are journaled even when the orphans can't be handled,
+	// so -undo can still revert them.
+	var orphansErr error
+	if executionErr == nil {
+		var orphanOperations []renamer.RenameOperation
+		orphanOperations, orphansErr = handleOrphans(config, unmatched)
+		operations = append(operations, orphanOperations...)
+	}
+
+	// Copies and links leave the originals in place, so there is nothing
+	// for -undo to move back. A run that only found already named files
+	// keeps the previous journal, so -undo still reverts the batch that
+	// named them.
+	if !renamer.KeepsSources(config.Mode) && renamer.CountPendingOperations(operations) > 0 {
+		if err := renamer.WriteUndoJournal(config.FolderPath, operations); err != nil {
+			fmt.Fprintf(messageOutput, "Warning: %v\n", err)
+		}
+	}
+
+	if executionErr != nil {
+		return executionErr
+	}
+
+	if orphansErr != nil {
+		return orphansErr
+	}
+
+	infof("All done :)\n")
+	return nil
+}
+
+// writeMpvPlaylist writes the mpv script for -mpv-playlist in place of
+// renaming anything.
+func writeMpvPlaylist(path string, pairs []renamer.FilePair) error {
+	var script strings.Builder
+	if err := renamer.WriteMpvScript(&script, pairs); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, []byte(script.String()), 0o755); err != nil {
+		return fmt.Errorf("writing mpv playlist %s: %w", path, err)
+	}
+
+	infof("\nWrote an mpv script for %d episodes to %s. Nothing was renamed.\n", len(pairs), path)
+	return nil
+}
+
+// convertSubtitles rewrites the renamed text subtitles as UTF-8. The files
+// already have their new names, so a subtitle that can't be converted is
+// only warned about.
+func convertSubtitles(operations []renamer.RenameOperation) {
+	for _, operation := range operations {
+		if !renamer.IsTextSubtitle(operation.NewPath) {
+			continue
+		}
+
+		encoding, err := renamer.ConvertToUTF8(operation.NewPath)
+		if err != nil {
+			fmt.Fprintf(messageOutput, "Warning: %v\n", err)
+			continue
+		}
+
+		if encoding != "" {
+			infof("Converted %s from %s to UTF-8\n", filepath.Base(operation.NewPath), encoding)
+		}
+	}
+}
+
+// planShow names, pairs and plans the files of one show, inferring its name
+// with the episode patterns of the scan.
+func planShow(
+	config AppConfig,
+	videoFiles []renamer.FileInfo,
+	subtitleFiles []renamer.FileInfo,
+	patterns []*regexp.Regexp,
+) ([]renamer.FilePair, []renamer.FileInfo, []renamer.RenameOperation, error) {
+	var err error
+	if config.AnimeName == "" && !config.SubsOnly && config.MpvPlaylist == "" {
+		files := slices.Concat(videoFiles, subtitleFiles)
+		suggestedName := renamer.InferAnimeName(files, config.FolderPath, config.NoiseTokens, patterns)
+		config.AnimeName, err = promptAnimeName(suggestedName)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if len(videoFiles) != len(subtitleFiles) && !config.NoSubs {
+		fmt.Fprintf(
+			messageOutput,
 			"Warning: found %d video files and %d subtitle files.\n",
 			len(videoFiles),
 			len(subtitleFiles),
 		)
+
+		if hint := countMismatchHint(len(videoFiles), len(subtitleFiles)); hint != "" {
+			fmt.Fprintf(messageOutput, "Hint: %s.\n", hint)
+		}
 	}
 
-	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
-	displayPairsAndUnmatched(pairs, unmatched)
+	// A dry run only prints the plan, so there is nothing to review.
+	if !config.AssumeYes && !config.JSON && !config.DryRun {
+		review, err := askYesNo("\nDo you want to review the detected episode numbers? (yes/no): ")
+		if err != nil {
+			return nil, nil, nil, err
+		}
 
-	operations := buildRenameOperations(pairs, config.AnimeName)
+		if review {
+			videoFiles, subtitleFiles, err = reviewParsedEpisodes(videoFiles, subtitleFiles)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
 
-	if err := preflightRenameOperations(operations); err != nil {
-		exitWithError(err)
+	pairs, unmatched, err := pairFiles(config, videoFiles, subtitleFiles)
+	if err != nil || config.MpvPlaylist != "" {
+		return pairs, unmatched, nil, err
 	}
 
-	if config.DryRun {
-		fmt.Println("\nDry-run mode enabled. No files will be changed.")
-		if err := executeRenameOperations(operations, true); err != nil {
-			exitWithError(err)
+	outputDir := config.OutputDir
+	if config.Mode == renamer.ModeSymlink {
+		outputDir = config.LinkDir
+	}
+
+	var metadata renamer.MetadataProvider
+	if config.TitlesFile != "" {
+		if metadata, err = renamer.LoadTitleList(config.TitlesFile); err != nil {
+			return pairs, unmatched, nil, err
 		}
-		fmt.Println("Dry-run complete.")
-		return
 	}
 
-	confirmed, err := confirmRename()
+	operations, err := renamer.Plan(pairs, renamer.PlanOptions{
+		AnimeName:             config.AnimeName,
+		NameCase:              config.NameCase,
+		Metadata:              metadata,
+		Template:              config.Template,
+		SeasonSubfolders:      config.SeasonSubfolders,
+		SubtitlesNextToVideos: config.SubFolder != "",
+		SubtitlesOnly:         config.SubsOnly,
+		FolderPath:            config.FolderPath,
+		OutputDir:             outputDir,
+	})
 	if err != nil {
-		exitWithError(err)
+		return nil, nil, nil, err
 	}
 
-	if !confirmed {
-		fmt.Println("Renaming cancelled.")
-		return
-	}
+	return pairs, unmatched, operations, nil
+}
 
-	if err := executeRenameOperations(operations, false); err != nil {
-		exitWithError(err)
+// countMismatchHint guesses why the counts differ when one is a whole
+// multiple of the other, like 24 subtitles for 12 videos.
+func countMismatchHint(videoCount int, subtitleCount int) string {
+	switch {
+	case videoCount == 0 || subtitleCount == 0 || videoCount == subtitleCount:
+		return ""
+	case subtitleCount%videoCount == 0:
+		return fmt.Sprintf(
+			"subtitles appear to be %dx the videos, possibly split episodes or several subtitle tracks per video",
+			subtitleCount/videoCount,
+		)
+	case videoCount%subtitleCount == 0:
+		return fmt.Sprintf(
+			"videos appear to be %dx the subtitles, possibly split episodes or subtitles covering several episodes",
+			videoCount/subtitleCount,
+		)
+	default:
+		return ""
 	}
-
-	fmt.Println("All done :)")
 }
 
-func loadConfig() (AppConfig, error) {
-	var dryRun bool
-	flag.BoolVar(&dryRun, "dry-run", false, "print planned renames without changing files")
-	flag.Parse()
+func scanFiles(config AppConfig) (renamer.ScanResult, error) {
+	var overrides renamer.Overrides
+	if config.MapFile != "" {
+		var err error
+		if overrides, err = renamer.LoadOverrides(config.MapFile); err != nil {
+			return renamer.ScanResult{}, err
+		}
+	}
 
-	folderPath, err := getUserInputLine("Enter the path to the folder containing the videos and subtitles: ")
+	result, err := renamer.Scan(config.FolderPath, renamer.ScanOptions{
+		VideoExtensions:    config.VideoExtensions,
+		SubtitleExtensions: config.SubtitleExtensions,
+		NoiseTokens:        config.NoiseTokens,
+		Workers:            config.Workers,
+		Recursive:          config.Recursive,
+		FoldParts:          config.FoldParts,
+		SeasonCounts:       config.SeasonCounts,
+		Sniff:              config.Sniff,
+		SubtitleFolder:     config.SubFolder,
+		SkipSubtitles:      config.NoSubs,
+		Season:             config.Season,
+		FinalSeason:        config.FinalSeason,
+		GroupByDir:         config.GroupByDir,
+		Overrides:          overrides,
+
+		EpisodePatterns:      config.EpisodePatterns,
+		EpisodePatternsFirst: config.EpisodePatternsFirst,
+		PatternOrder:         config.PatternOrder,
+	})
 	if err != nil {
-		return AppConfig{}, fmt.Errorf("reading folder path: %w", err)
+		return renamer.ScanResult{}, err
 	}
 
-	if err := validateFolderPath(folderPath); err != nil {
-		return AppConfig{}, err
+	// A mistyped path, like the home folder, can hold far more files than a
+	// show, none of which should be renamed.
+	found := len(result.Videos) + len(result.Subtitles)
+	if config.MaxFiles > 0 && found > config.MaxFiles && !config.Force {
+		return renamer.ScanResult{}, fmt.Errorf(
+			"found %d videos and subtitles in %s, over the -max-files limit of %d; check the folder or use -force",
+			found,
+			config.FolderPath,
+			config.MaxFiles,
+		)
 	}
 
-	animeName, err := getUserInputLine("Enter the name of the anime: ")
-	if err != nil {
-		return AppConfig{}, fmt.Errorf("reading anime name: %w", err)
+	displayEpisodeCollisions(result.Collisions)
+	for _, file := range result.Superseded {
+		infof("Skipping %s, a newer version of %s was found\n", file.Path, renamer.FormatEpisodeLabel(file))
 	}
 
-	if err := validateAnimeName(animeName); err != nil {
-		return AppConfig{}, err
+	if config.FinalSeason == 0 {
+		finalSeasonFiles := 0
+		for _, file := range slices.Concat(result.Videos, result.Subtitles) {
+			if file.FinalSeason {
+				finalSeasonFiles++
+			}
+		}
+
+		if finalSeasonFiles > 0 {
+			fmt.Fprintf(
+				messageOutput,
+				"Warning: %d files are from a \"Final Season\" and are numbered season 1, give its number with -final-season.\n",
+				finalSeasonFiles,
+			)
+		}
 	}
 
-	return AppConfig{
-		FolderPath: folderPath,
-		AnimeName:  animeName,
-		DryRun:     dryRun,
-	}, nil
+	if result.OtherSeasons > 0 {
+		infof("Leaving out %d files from other seasons than season %d.\n", result.OtherSeasons, config.Season)
+	}
+
+	return result, nil
 }
 
-func validateFolderPath(folderPath string) error {
-	if strings.TrimSpace(folderPath) == "" {
-		return errors.New("folder path is empty")
+// reportDuplicates warns about the files left out of the pairs that are
+// copies of another file: the unmatched ones, and the episode collisions
+// and superseded versions the scan set aside.
+func reportDuplicates(pairs []renamer.FilePair, unmatched []renamer.FileInfo, scan renamer.ScanResult) error {
+	candidates := slices.Concat(unmatched, scan.Superseded)
+	for _, collision := range scan.Collisions {
+		candidates = append(candidates, collision...)
 	}
 
-	info, err := os.Stat(folderPath)
+	duplicates, err := renamer.FindDuplicates(pairs, candidates)
 	if err != nil {
-		return fmt.Errorf("checking folder path: %w", err)
+		return err
 	}
 
-	if !info.IsDir() {
-		return fmt.Errorf("folder path is not a directory: %s", folderPath)
+	for _, duplicate := range duplicates {
+		fmt.Fprintf(
+			messageOutput,
+			"Warning: %s looks like a copy of %s and can probably be deleted.\n",
+			duplicate.File.Path,
+			duplicate.Original,
+		)
 	}
 
 	return nil
 }
 
-func validateAnimeName(animeName string) error {
-	if strings.TrimSpace(animeName) == "" {
-		return errors.New("anime name is empty")
+func pairFiles(
+	config AppConfig,
+	videoFiles []renamer.FileInfo,
+	subtitleFiles []renamer.FileInfo,
+) ([]renamer.FilePair, []renamer.FileInfo, error) {
+	pairs, unmatched := renamer.Pair(videoFiles, subtitleFiles, renamer.PairOptions{
+		VideosOnly:      config.NoSubs,
+		GroupByDir:      config.GroupByDir,
+		FuzzyNames:      config.FuzzyNames,
+		SeasonOffset:    config.SeasonOffset,
+		VideoExtensions: config.VideoExtensions,
+		NoiseTokens:     config.NoiseTokens,
+	})
+	displayPairsAndUnmatched(pairs, unmatched, config.NoiseTokens)
+
+	if offset, ok := renamer.SuggestSeasonOffset(unmatched, config.VideoExtensions); ok {
+		fmt.Fprintf(
+			messageOutput,
+			"Warning: the unmatched subtitles look numbered %d season(s) off from the videos, "+
+				"a -season-offset %+d correction would pair them.\n",
+			max(offset, -offset),
+			offset,
+		)
 	}
 
-	if strings.ContainsAny(animeName, `<>:"/\|?*`) {
-		return fmt.Errorf("anime name contains invalid filename characters: %s", animeName)
+	interactive := !config.AssumeYes && !config.JSON
+	if interactive && config.FuzzyNames {
+		var err error
+		pairs, unmatched, err = confirmSimilarPairs(pairs, unmatched)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return nil
-}
+	if !interactive || !hasVideoAndSubtitle(unmatched, config.VideoExtensions) {
+		return pairs, unmatched, nil
+	}
 
-func getUserInputLine(prompt string) (string, error) {
-	fmt.Print(prompt)
-	input, err := stdinReader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
-		return "", err
+	pairManually, err := askYesNo("\nDo you want to pair the unmatched files manually? (yes/no): ")
+	if err != nil || !pairManually {
+		return pairs, unmatched, err
 	}
 
-	trimmedInput := strings.TrimSpace(input)
-	if errors.Is(err, io.EOF) && trimmedInput == "" {
-		return "", io.EOF
+	manualPairs, remaining, err := pairUnmatchedManually(unmatched, config.VideoExtensions)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return trimmedInput, nil
+	infof("\nAdded %d manual pairs.\n", len(manualPairs))
+	return append(pairs, manualPairs...), remaining, nil
 }
 
-func exitWithError(err error) {
-	fmt.Printf("Error: %v\n", err)
-	os.Exit(1)
-}
+func printSummary(stats renamer.RunStats, mode string) {
+	label := "Files renamed:"
+	if renamer.KeepsSources(mode) {
+		label = "Files created:"
+	}
 
-func findFiles(folderPath string, extensions []string) ([]FileInfo, error) {
-	files := []FileInfo{}
-	extensionSet := map[string]struct{}{}
+	infof("\nSummary:\n")
+	infof("  %-17s %d\n", "Pairs matched:", stats.Pairs)
+	infof("  %-17s %d\n", label, stats.Renamed)
+	infof("  %-17s %d\n", "Already named:", stats.Skipped)
+	infof("  %-17s %d\n", "Unmatched files:", stats.Unmatched)
+	infof("  %-17s %d\n", "Errors:", stats.Errors)
+}
 
-	for _, ext := range extensions {
-		normalizedExtension := strings.ToLower(ext)
-		extensionSet[normalizedExtension] = struct{}{}
+func progressVerb(mode string) string {
+	if renamer.KeepsSources(mode) {
+		return "Creating"
 	}
 
-	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("accessing path %q: %w", path, err)
-		}
+	return "Renaming"
+}
 
-		if info.IsDir() {
-			return nil
-		}
+// printPlan lists the pending operations before the confirmation, so the
+// answer is given with the new names in view.
+func printPlan(operations []renamer.RenameOperation) {
+	if renamer.CountPendingOperations(operations) == 0 {
+		return
+	}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if _, exists := extensionSet[ext]; !exists {
-			return nil
+	infof("\nPlanned changes:\n")
+	kinds := renamer.ClassifyOperations(operations)
+	for _, section := range []struct {
+		kind    renamer.OperationKind
+		heading string
+	}{
+		{renamer.OperationRename, "Renamed in place:"},
+		{renamer.OperationMove, "Moved to another folder:"},
+		{renamer.OperationOverwrite, "Overwriting existing files:"},
+	} {
+		if len(kinds[section.kind]) == 0 {
+			continue
 		}
 
-		baseName := filepath.Base(path)
-		if !flexiblePattern.MatchString(baseName) {
-			return nil
+		// Overwrites stand out and are printed even with -q, since they are
+		// confirmed on their own.
+		heading, printLine := section.heading, infof
+		if section.kind == renamer.OperationOverwrite {
+			heading, printLine = colorize(heading, ansiRed), printMessage
 		}
 
-		season, episode := extractSeasonAndEpisode(baseName)
-		if episode == 0 {
-			return nil
+		printLine(" %s\n", heading)
+		for _, operation := range kinds[section.kind] {
+			printLine("   %s\n", renameLine(operation.OldPath, operation.NewPath))
 		}
+	}
+}
 
-		files = append(files, FileInfo{
-			Path:      path,
-			Season:    season,
-			Episode:   episode,
-			Extension: ext,
-		})
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("walking folder %q: %w", folderPath, err)
+// confirmOverwrites asks again before a batch replaces existing files, so
+// they are not overwritten by answering the usual question out of habit.
+func confirmOverwrites(operations []renamer.RenameOperation) (bool, error) {
+	overwrites := len(renamer.ClassifyOperations(operations)[renamer.OperationOverwrite])
+	if overwrites == 0 {
+		return true, nil
 	}
 
-	return files, nil
+	return askYesNo(fmt.Sprintf("%d existing files will be overwritten. Overwrite them? (yes/no): ", overwrites))
 }
 
-func extractSeasonAndEpisode(filename string) (int, int) {
-	filenameWithoutExtension := strings.TrimSuffix(filename, filepath.Ext(filename))
+// printOperations lists the planned operations with dryRun, or what was
+// done once they have been carried out.
+func printOperations(operations []renamer.RenameOperation, dryRun bool, mode string) {
+	if dryRun {
+		for _, operation := range operations {
+			if operation.AlreadyNamed() {
+				infof("[dry-run] Already named: %s\n", operation.OldPath)
+				continue
+			}
 
-	for _, pattern := range episodePatterns {
-		match := pattern.regex.FindStringSubmatch(filenameWithoutExtension)
-		if len(match) <= pattern.episodeIndex {
-			continue
+			infof("[dry-run] %s\n", renameLine(operation.OldPath, operation.NewPath))
 		}
 
-		episode, err := strconv.Atoi(match[pattern.episodeIndex])
-		if err != nil || episode == 0 {
-			continue
+		return
+	}
+
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			infof("Already named: %s\n", operation.OldPath)
 		}
+	}
 
-		season := 1
-		if pattern.seasonIndex > 0 {
-			parsedSeason, parseErr := strconv.Atoi(match[pattern.seasonIndex])
-			if parseErr == nil && parsedSeason > 0 {
-				season = parsedSeason
-			}
+	if renamer.CountPendingOperations(operations) == 0 {
+		infof("No files need renaming.\n")
+		return
+	}
+
+	verb := "Renamed"
+	if renamer.KeepsSources(mode) {
+		verb = "Created"
+	}
+
+	for _, operation := range operations {
+		if !operation.AlreadyNamed() {
+			infof("%s: %s -> %s\n", verb, operation.OldPath, operation.NewPath)
 		}
+	}
+}
 
-		return season, episode
+func emitRunReport(
+	config AppConfig,
+	pairs []renamer.FilePair,
+	unmatched []renamer.FileInfo,
+	operations []renamer.RenameOperation,
+	runErr error,
+) {
+	if !config.JSON {
+		return
 	}
 
-	return 1, 0
+	report := renamer.BuildRunReport(pairs, unmatched, operations, config.DryRun, runErr)
+	if err := renamer.WriteRunReport(os.Stdout, report); err != nil {
+		fmt.Fprintf(messageOutput, "Warning: %v\n", err)
+	}
 }
 
-func createFilePairs(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo) {
-	pairs := []FilePair{}
-	unmatched := []FileInfo{}
-	subtitleMap := make(map[int]FileInfo)
+func loadConfig() (AppConfig, error) {
+	config, err := parseFlags(os.Args[1:])
+	if err != nil {
+		return AppConfig{}, err
+	}
 
-	for _, subtitle := range subtitleFiles {
-		key := subtitle.Season*1000 + subtitle.Episode
-		subtitleMap[key] = subtitle
+	if config.JSON {
+		messageOutput = os.Stderr
 	}
 
-	for _, video := range videoFiles {
-		key := video.Season*1000 + video.Episode
+	colorOutput = !config.NoColor && os.Getenv("NO_COLOR") == "" && isTerminal(messageOutput)
 
-		if subtitle, exists := subtitleMap[key]; exists {
-			pairs = append(pairs, FilePair{Video: video, Subtitle: subtitle})
-			delete(subtitleMap, key)
-		} else {
-			unmatched = append(unmatched, video)
+	renamer.Debugf = debugf
+	if config.Verbose {
+		currentLogLevel = logVerbose
+	} else if config.Quiet {
+		currentLogLevel = logQuiet
+	}
+
+	if config.FolderPath == "" {
+		config.FolderPath, err = getUserInputLine(
+			stdinReader,
+			messageOutput,
+			"Enter the path to the folder containing the videos and subtitles: ",
+		)
+		if err != nil {
+			return AppConfig{}, fmt.Errorf("reading folder path: %w", err)
 		}
 	}
 
-	for _, subtitle := range subtitleMap {
-		unmatched = append(unmatched, subtitle)
+	config.FolderPath, err = normalizePath(config.FolderPath)
+	if err != nil {
+		return AppConfig{}, err
 	}
 
-	return pairs, unmatched
-}
+	if err := validateFolderPath(config.FolderPath); err != nil {
+		return AppConfig{}, err
+	}
 
-func displayPairsAndUnmatched(pairs []FilePair, unmatched []FileInfo) {
-	fmt.Println("\nMatched pairs:")
+	if config.SubFolder != "" {
+		if err := validateFolderPath(config.SubFolder); err != nil {
+			return AppConfig{}, fmt.Errorf("-sub-folder: %w", err)
+		}
+	}
 
-	for i, pair := range pairs {
-		fmt.Printf(
-			"%d. Video: %s\n   Subtitle: %s\n",
-			i+1,
-			filepath.Base(pair.Video.Path),
-			filepath.Base(pair.Subtitle.Path),
-		)
+	if config.Undo || config.AnimeName == "" {
+		return config, nil
 	}
 
-	if len(unmatched) > 0 {
-		fmt.Println("\nUnmatched files:")
+	if err := renamer.ValidateAnimeName(config.AnimeName); err != nil {
+		return AppConfig{}, err
+	}
 
-		for i, file := range unmatched {
-			fmt.Printf("%d. %s\n", i+1, filepath.Base(file.Path))
-		}
+	if err := renamer.CheckAnimeNameEpisode(config.AnimeName); err != nil {
+		fmt.Fprintf(messageOutput, "Warning: %v\n", err)
 	}
+
+	return config, nil
 }
 
-func confirmRename() (bool, error) {
+// promptAnimeName asks for the anime name. A name holding an episode
+// number, most likely a pasted file name, is asked for again and only
+// kept when it is entered a second time.
+func promptAnimeName(suggestedName string) (string, error) {
+	prompt := "Enter the name of the anime: "
+	if suggestedName != "" {
+		prompt = fmt.Sprintf("Enter the name of the anime [%s]: ", suggestedName)
+	}
+
+	questioned := ""
 	for {
-		response, err := getUserInputLine("\nDo you want to proceed with renaming? (yes/no): ")
+		animeName, err := getUserInputLine(stdinReader, messageOutput, prompt)
 		if err != nil {
-			return false, err
+			return "", fmt.Errorf("reading anime name: %w", err)
 		}
 
-		response = strings.ToLower(strings.TrimSpace(response))
+		animeName = strings.TrimSpace(renamer.NormalizeWidth(animeName))
+		if animeName == "" {
+			animeName = suggestedName
+		}
 
-		if response == "yes" || response == "y" {
-			return true, nil
+		if err := renamer.ValidateAnimeName(animeName); err != nil {
+			return "", err
 		}
 
-		if response == "no" || response == "n" {
-			return false, nil
+		if err := renamer.CheckAnimeNameEpisode(animeName); err != nil && animeName != questioned {
+			fmt.Fprintf(messageOutput, "Warning: %v. Enter the name again, or the same name to keep it.\n", err)
+			questioned = animeName
+			continue
 		}
 
-		fmt.Println("Please answer with yes/y or no/n.")
+		return animeName, nil
 	}
 }
 
-func buildRenameOperations(pairs []FilePair, animeName string) []RenameOperation {
-	operations := make([]RenameOperation, 0, len(pairs)*2)
+// normalizePath tidies a path typed or pasted at a prompt: surrounding
+// quotes are dropped, a leading ~ is expanded to the home directory and
+// redundant separators are cleaned up.
+func normalizePath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if len(path) >= 2 && (path[0] == '"' || path[0] == '\'') && path[len(path)-1] == path[0] {
+		path = path[1 : len(path)-1]
+	}
 
-	for _, pair := range pairs {
-		newVideoName := fmt.Sprintf(
-			"%s - S%02dE%02d%s",
-			animeName,
-			pair.Video.Season,
-			pair.Video.Episode,
-			pair.Video.Extension,
-		)
+	if path == "" {
+		return "", nil
+	}
 
-		newSubtitleName := fmt.Sprintf(
-			"%s - S%02dE%02d%s",
-			animeName,
-			pair.Subtitle.Season,
-			pair.Subtitle.Episode,
-			pair.Subtitle.Extension,
-		)
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expanding ~ in %s: %w", path, err)
+		}
 
-		operations = append(operations, RenameOperation{
-			OldPath: pair.Video.Path,
-			NewPath: filepath.Join(filepath.Dir(pair.Video.Path), newVideoName),
-		})
+		path = filepath.Join(home, path[1:])
+	}
 
-		operations = append(operations, RenameOperation{
-			OldPath: pair.Subtitle.Path,
-			NewPath: filepath.Join(filepath.Dir(pair.Subtitle.Path), newSubtitleName),
-		})
+	return filepath.Clean(path), nil
+}
+
+func validateFolderPath(folderPath string) error {
+	if strings.TrimSpace(folderPath) == "" {
+		return errors.New("folder path is empty")
+	}
+
+	info, err := os.Stat(folderPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("folder does not exist: %s", folderPath)
+	}
+
+	if err != nil {
+		return fmt.Errorf("checking folder path: %w", err)
 	}
 
-	return operations
+	if !info.IsDir() {
+		return fmt.Errorf("folder path is a file, not a directory: %s", folderPath)
+	}
+
+	return nil
 }
 
-func preflightRenameOperations(operations []RenameOperation) error {
-	issues := []string{}
+// getUserInputLine writes prompt to output and reads one line from input,
+// which is wrapped with bufio.NewReader. That reuses a *bufio.Reader as is,
+// so pass the same one to every prompt to keep what it has buffered.
+func getUserInputLine(input io.Reader, output io.Writer, prompt string) (string, error) {
+	fmt.Fprint(output, prompt)
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
 
-	if len(operations) == 0 {
-		issues = append(issues, "no matched file pairs were found")
+	trimmedInput := strings.TrimSpace(line)
+	if errors.Is(err, io.EOF) && trimmedInput == "" {
+		return "", io.EOF
 	}
 
-	sourcePaths := map[string]struct{}{}
-	targetPaths := map[string]struct{}{}
+	return trimmedInput, nil
+}
 
-	for _, operation := range operations {
-		if strings.TrimSpace(operation.OldPath) == "" {
-			issues = append(issues, "operation contains empty source path")
-			continue
-		}
+func exitWithError(err error) {
+	fmt.Fprintf(messageOutput, "Error: %v\n", err)
+	os.Exit(1)
+}
+
+// confirmSimilarPairs asks about every pair made by file name similarity and
+// returns the files of rejected pairs to the unmatched list.
+func confirmSimilarPairs(
+	pairs []renamer.FilePair,
+	unmatched []renamer.FileInfo,
+) ([]renamer.FilePair, []renamer.FileInfo, error) {
+	kept := make([]renamer.FilePair, 0, len(pairs))
 
-		if strings.TrimSpace(operation.NewPath) == "" {
-			issues = append(issues, fmt.Sprintf("operation for %s contains empty target path", operation.OldPath))
+	for _, pair := range pairs {
+		if !pair.SimilarName {
+			kept = append(kept, pair)
 			continue
 		}
 
-		sourcePaths[operation.OldPath] = struct{}{}
+		prompt := fmt.Sprintf(
+			"\nPair %s with %s by name similarity? (yes/no): ",
+			filepath.Base(pair.Video.Path),
+			filepath.Base(pair.Subtitles[0].Path),
+		)
+		keep, err := askYesNo(prompt)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		if _, err := os.Stat(operation.OldPath); err != nil {
-			issues = append(issues, fmt.Sprintf("source file does not exist or is not readable: %s", operation.OldPath))
+		if keep {
+			kept = append(kept, pair)
 			continue
 		}
 
-		if operation.OldPath == operation.NewPath {
-			continue
+		unmatched = append(unmatched, pair.Video)
+		unmatched = append(unmatched, pair.Subtitles...)
+	}
+
+	return kept, unmatched, nil
+}
+
+func displayEpisodeCollisions(collisions [][]renamer.FileInfo) {
+	for _, files := range collisions {
+		fmt.Fprintf(
+			messageOutput,
+			"Warning: %d files parse as %s and will be skipped, rename them manually:\n",
+			len(files),
+			renamer.FormatEpisodeLabel(files[0]),
+		)
+
+		for _, file := range files {
+			fmt.Fprintf(messageOutput, " - %s\n", file.Path)
 		}
+	}
+}
 
-		if _, exists := targetPaths[operation.NewPath]; exists {
-			issues = append(issues, fmt.Sprintf("duplicate target path detected: %s", operation.NewPath))
-			continue
+func displayPairsAndUnmatched(pairs []renamer.FilePair, unmatched []renamer.FileInfo, noiseTokens []string) {
+	infof("\nMatched pairs:\n")
+
+	for i, pair := range pairs {
+		infof("%d. Video: %s\n", i+1, renamer.CleanFilename(filepath.Base(pair.Video.Path), noiseTokens))
+
+		for _, subtitle := range pair.Subtitles {
+			infof("   Subtitle: %s\n", renamer.CleanFilename(filepath.Base(subtitle.Path), noiseTokens))
+
+			for _, companion := range subtitle.Companions {
+				infof("   Companion: %s\n", filepath.Base(companion))
+			}
 		}
 
-		targetPaths[operation.NewPath] = struct{}{}
-	}
+		// The warnings name the video, as -q leaves them without the list.
+		videoName := filepath.Base(pair.Video.Path)
+		if pair.Fuzzy {
+			fmt.Fprintf(
+				messageOutput,
+				"   Warning: %s matched by episode number only, using season %d\n",
+				videoName,
+				pair.Video.Season,
+			)
+		}
 
-	for targetPath := range targetPaths {
-		if _, exists := sourcePaths[targetPath]; exists {
-			continue
+		if pair.SimilarName {
+			fmt.Fprintf(messageOutput, "   Warning: %s matched by file name similarity only, check this pair\n", videoName)
 		}
 
-		_, statErr := os.Stat(targetPath)
-		if statErr == nil {
-			issues = append(issues, fmt.Sprintf("target path already exists: %s", targetPath))
-			continue
+		if pair.PartialRange {
+			fmt.Fprintf(
+				messageOutput,
+				"   Warning: double episode %s matched with the subtitles of episode %d only, the rest stay unmatched\n",
+				videoName,
+				pair.Video.Episode,
+			)
 		}
+	}
+
+	if len(unmatched) > 0 {
+		infof("\nUnmatched files:\n")
 
-		if !errors.Is(statErr, os.ErrNotExist) {
-			issues = append(issues, fmt.Sprintf("unable to validate target path %s: %v", targetPath, statErr))
+		for i, file := range unmatched {
+			infof("%d. %s\n", i+1, renamer.CleanFilename(filepath.Base(file.Path), noiseTokens))
 		}
 	}
+}
 
-	if len(issues) > 0 {
-		return &PreflightError{Issues: issues}
+// confirmRename asks whether to go ahead. defaultAnswer, "yes" or "no", is
+// taken for a bare Enter; without one the question is repeated.
+func confirmRename(input io.Reader, output io.Writer, defaultAnswer string) (bool, error) {
+	choices := "yes/no"
+	switch defaultAnswer {
+	case "yes":
+		choices = "Y/n"
+	case "no":
+		choices = "y/N"
 	}
 
-	return nil
+	prompt := "\nDo you want to proceed with renaming? (" + choices + "): "
+	return askYesNoWithDefault(input, output, prompt, defaultAnswer)
 }
 
-func executeRenameOperations(operations []RenameOperation, dryRun bool) error {
-	return executeRenameOperationsWith(operations, dryRun, os.Rename)
+func askYesNo(prompt string) (bool, error) {
+	return askYesNoWithDefault(stdinReader, messageOutput, prompt, "")
 }
 
-func executeRenameOperationsWith(
-	operations []RenameOperation,
-	dryRun bool,
-	renameFn renameExecutor,
-) error {
-	if dryRun {
-		for _, operation := range operations {
-			if operation.OldPath == operation.NewPath {
-				fmt.Printf("[dry-run] No change: %s\n", operation.OldPath)
-				continue
-			}
+func askYesNoWithDefault(input io.Reader, output io.Writer, prompt string, defaultAnswer string) (bool, error) {
+	reader := bufio.NewReader(input)
+	for {
+		response, err := getUserInputLine(reader, output, prompt)
+		if err != nil {
+			return false, err
+		}
 
-			fmt.Printf("[dry-run] %s -> %s\n", operation.OldPath, operation.NewPath)
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response == "" {
+			response = defaultAnswer
 		}
 
-		return nil
+		if response == "yes" || response == "y" {
+			return true, nil
+		}
+
+		if response == "no" || response == "n" {
+			return false, nil
+		}
+
+		fmt.Fprintln(output, "Please answer with yes/y or no/n.")
 	}
+}
+
+func pairUnmatchedManually(
+	unmatched []renamer.FileInfo,
+	videoExtensions []string,
+) ([]renamer.FilePair, []renamer.FileInfo, error) {
+	videos := []renamer.FileInfo{}
+	subtitles := []renamer.FileInfo{}
 
-	states := make([]renameState, 0, len(operations))
+	for _, file := range unmatched {
+		if slices.Contains(videoExtensions, file.Extension) {
+			videos = append(videos, file)
+		} else {
+			subtitles = append(subtitles, file)
+		}
+	}
 
-	for index, operation := range operations {
-		if operation.OldPath == operation.NewPath {
-			fmt.Printf("No change: %s\n", operation.OldPath)
+	pairs := []renamer.FilePair{}
+	remainingVideos := []renamer.FileInfo{}
+
+	for _, video := range videos {
+		if len(subtitles) == 0 {
+			remainingVideos = append(remainingVideos, video)
 			continue
 		}
 
-		tempPath, err := buildTempPath(operation.OldPath, index)
+		fmt.Fprintf(messageOutput, "\nVideo: %s\n", filepath.Base(video.Path))
+		for index, subtitle := range subtitles {
+			fmt.Fprintf(messageOutput, "  %d. %s\n", index+1, filepath.Base(subtitle.Path))
+		}
+		fmt.Fprintln(messageOutput, "  0. skip")
+
+		choice, err := askChoice("Pick a subtitle for this video: ", len(subtitles))
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		states = append(states, renameState{
-			RenameOperation: operation,
-			TempPath:        tempPath,
-			CurrentPath:     operation.OldPath,
-		})
-	}
+		if choice == 0 {
+			remainingVideos = append(remainingVideos, video)
+			continue
+		}
 
-	if len(states) == 0 {
-		fmt.Println("No files need renaming.")
-		return nil
+		subtitle := renamer.NumberedLike(subtitles[choice-1], video)
+		subtitles = slices.Delete(subtitles, choice-1, choice)
+
+		pairs = append(pairs, renamer.FilePair{Video: video, Subtitles: []renamer.FileInfo{subtitle}})
 	}
 
-	for index := range states {
-		state := &states[index]
-		if err := renameFn(state.CurrentPath, state.TempPath); err != nil {
-			executionErr := &RenameExecutionError{
-				Phase: "phase-one",
-				From:  state.CurrentPath,
-				To:    state.TempPath,
-				Err:   err,
-			}
+	return pairs, append(remainingVideos, subtitles...), nil
+}
 
-			rollbackErr := rollbackRenameStates(states, renameFn)
-			if rollbackErr != nil {
-				return errors.Join(executionErr, fmt.Errorf("rollback failed: %w", rollbackErr))
-			}
+// reviewParsedEpisodes lists every parsed file and lets the user correct
+// the season and episode of any of them before pairing.
+func reviewParsedEpisodes(
+	videoFiles []renamer.FileInfo,
+	subtitleFiles []renamer.FileInfo,
+) ([]renamer.FileInfo, []renamer.FileInfo, error) {
+	files := append(slices.Clone(videoFiles), subtitleFiles...)
 
-			return executionErr
+	for {
+		fmt.Fprintln(messageOutput, "\nDetected episodes:")
+		for index, file := range files {
+			fmt.Fprintf(messageOutput, "  %d. %s: %s\n", index+1, renamer.FormatEpisodeLabel(file), filepath.Base(file.Path))
 		}
 
-		state.CurrentPath = state.TempPath
-	}
+		choice, err := askChoice("Enter a number to correct it, or 0 to continue: ", len(files))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if choice == 0 {
+			return files[:len(videoFiles)], files[len(videoFiles):], nil
+		}
 
-	for index := range states {
-		state := &states[index]
-		if err := renameFn(state.CurrentPath, state.NewPath); err != nil {
-			executionErr := &RenameExecutionError{
-				Phase: "phase-two",
-				From:  state.CurrentPath,
-				To:    state.NewPath,
-				Err:   err,
+		file := &files[choice-1]
+		for {
+			response, err := getUserInputLine(
+				stdinReader,
+				messageOutput,
+				fmt.Sprintf("New episode for %s (e.g. S01E05, 5 or 0): ", filepath.Base(file.Path)),
+			)
+			if err != nil {
+				return nil, nil, err
 			}
 
-			rollbackErr := rollbackRenameStates(states, renameFn)
-			if rollbackErr != nil {
-				return errors.Join(executionErr, fmt.Errorf("rollback failed: %w", rollbackErr))
+			if applyEpisodeOverride(file, response) {
+				break
 			}
 
-			return executionErr
+			fmt.Fprintln(messageOutput, "Please enter an episode like S01E05, 05, 07.5 or 0.")
 		}
-
-		state.CurrentPath = state.NewPath
-	}
-
-	for _, state := range states {
-		fmt.Printf("Renamed: %s -> %s\n", state.OldPath, state.NewPath)
 	}
-
-	return nil
 }
 
-func buildTempPath(oldPath string, index int) (string, error) {
-	dir := filepath.Dir(oldPath)
-	base := filepath.Base(oldPath)
+func applyEpisodeOverride(file *renamer.FileInfo, value string) bool {
+	match := episodeOverridePattern.FindStringSubmatch(strings.TrimSpace(renamer.NormalizeWidth(value)))
+	if match == nil {
+		return false
+	}
 
-	for attempt := range 1000 {
-		candidate := filepath.Join(
-			dir,
-			fmt.Sprintf(".anime-renamer-tmp-%d-%d-%s", os.Getpid(), index*1000+attempt, base),
-		)
+	episode, err := strconv.Atoi(match[2])
+	if err != nil {
+		return false
+	}
 
-		_, err := os.Stat(candidate)
-		if errors.Is(err, os.ErrNotExist) {
-			return candidate, nil
-		}
+	if match[1] != "" {
+		file.Season, _ = strconv.Atoi(match[1])
+		file.HasSeason = true
+	}
 
-		if err != nil {
-			return "", fmt.Errorf("checking temp path %s: %w", candidate, err)
-		}
+	file.Episode = episode
+	file.EpisodePart = 0
+	file.EpisodeEnd = 0
+	if match[3] != "" {
+		file.EpisodePart, _ = strconv.Atoi(match[3])
 	}
 
-	return "", fmt.Errorf("failed to allocate temp path for %s", oldPath)
+	return true
 }
 
-func rollbackRenameStates(states []renameState, renameFn renameExecutor) error {
-	rollbackErrors := []error{}
-
-	for index := len(states) - 1; index >= 0; index-- {
-		state := states[index]
-		if state.CurrentPath == state.OldPath {
-			continue
+func askChoice(prompt string, maxChoice int) (int, error) {
+	for {
+		response, err := getUserInputLine(stdinReader, messageOutput, prompt)
+		if err != nil {
+			return 0, err
 		}
 
-		_, statErr := os.Stat(state.CurrentPath)
-		if statErr != nil {
-			if errors.Is(statErr, os.ErrNotExist) {
-				rollbackErrors = append(
-					rollbackErrors,
-					fmt.Errorf("rollback source disappeared: %s", state.CurrentPath),
-				)
-				continue
-			}
-
-			rollbackErrors = append(
-				rollbackErrors,
-				fmt.Errorf("rollback stat failed for %s: %w", state.CurrentPath, statErr),
-			)
-			continue
+		choice, err := strconv.Atoi(response)
+		if err == nil && choice >= 0 && choice <= maxChoice {
+			return choice, nil
 		}
 
-		if err := renameFn(state.CurrentPath, state.OldPath); err != nil {
-			rollbackErrors = append(
-				rollbackErrors,
-				fmt.Errorf("rollback failed (%s -> %s): %w", state.CurrentPath, state.OldPath, err),
-			)
-		}
+		fmt.Fprintf(messageOutput, "Please enter a number between 0 and %d.\n", maxChoice)
 	}
+}
+
+func hasVideoAndSubtitle(files []renamer.FileInfo, videoExtensions []string) bool {
+	hasVideo := false
+	hasSubtitle := false
 
-	if len(rollbackErrors) > 0 {
-		return errors.Join(rollbackErrors...)
+	for _, file := range files {
+		if slices.Contains(videoExtensions, file.Extension) {
+			hasVideo = true
+		} else {
+			hasSubtitle = true
+		}
 	}
 
-	return nil
+	return hasVideo && hasSubtitle
 }
@@ -1,186 +1,904 @@
 package main
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"anime-renamer/thing/renamer"
 )
 
-func TestExtractSeasonAndEpisode(t *testing.T) {
+func TestNormalizePath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{input: "~", want: home},
+		{input: "~/Videos/Show/", want: filepath.Join(home, "Videos", "Show")},
+		{input: ` "/videos//show/" `, want: filepath.Clean("/videos/show")},
+		{input: "videos/./show", want: filepath.Join("videos", "show")},
+		{input: "~other/show", want: "~other/show"},
+		{input: "", want: ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			got, err := normalizePath(testCase.input)
+			if err != nil || got != testCase.want {
+				t.Fatalf("normalizePath(%q) = %q, %v, want %q", testCase.input, got, err, testCase.want)
+			}
+		})
+	}
+}
+
+func TestValidateFolderPath(t *testing.T) {
+	tempDir := t.TempDir()
+	file := filepath.Join(tempDir, "Show - 01.mkv")
+	if err := os.WriteFile(file, []byte("video"), 0o600); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+
+	if err := validateFolderPath(tempDir); err != nil {
+		t.Fatalf("expected existing folder to be valid, got %v", err)
+	}
+
+	if err := validateFolderPath(filepath.Join(tempDir, "missing")); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing folder error, got %v", err)
+	}
+
+	if err := validateFolderPath(file); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected a not a directory error, got %v", err)
+	}
+}
+
+func TestPairUnmatchedManually(t *testing.T) {
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+
+	// First video picks an invalid number, then the second subtitle; the
+	// second video is skipped.
+	stdinReader = bufio.NewReader(strings.NewReader("7\n2\n0\n"))
+
+	unmatched := []renamer.FileInfo{
+		{Path: "Show - 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+		{Path: "Show - 02.mkv", Season: 1, Episode: 2, Extension: ".mkv"},
+		{Path: "Other 13.srt", Season: 1, Episode: 13, Extension: ".srt"},
+		{Path: "Other 14.srt", Season: 1, Episode: 14, Extension: ".srt"},
+	}
+
+	pairs, remaining, err := pairUnmatchedManually(unmatched, renamer.VideoExtensions)
+	if err != nil {
+		t.Fatalf("manual pairing: %v", err)
+	}
+
+	if len(pairs) != 1 || pairs[0].Video.Path != "Show - 01.mkv" || pairs[0].Subtitles[0].Path != "Other 14.srt" {
+		t.Fatalf("unexpected manual pairs: %+v", pairs)
+	}
+
+	if pairs[0].Subtitles[0].Episode != 1 {
+		t.Fatalf("expected subtitle to take the video's episode, got %d", pairs[0].Subtitles[0].Episode)
+	}
+
+	if len(remaining) != 2 || remaining[0].Path != "Show - 02.mkv" || remaining[1].Path != "Other 13.srt" {
+		t.Fatalf("unexpected remaining files: %+v", remaining)
+	}
+}
+
+func TestPairUnmatchedManuallyNumbersSubtitlesLikeRangedVideos(t *testing.T) {
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	captureMessages(t, logNormal)
+	stdinReader = bufio.NewReader(strings.NewReader("1\n"))
+
+	video := renamer.FileInfo{
+		Path:       "Show S2 Part 2 - 01-02.mkv",
+		Season:     2,
+		HasSeason:  true,
+		Cour:       2,
+		Episode:    1,
+		EpisodeEnd: 2,
+		Extension:  ".mkv",
+	}
+	unmatched := []renamer.FileInfo{video, {Path: "Other 09.srt", Season: 1, Episode: 9, Extension: ".srt"}}
+
+	pairs, _, err := pairUnmatchedManually(unmatched, renamer.VideoExtensions)
+	if err != nil {
+		t.Fatalf("manual pairing: %v", err)
+	}
+
+	if len(pairs) != 1 {
+		t.Fatalf("expected one pair, got %+v", pairs)
+	}
+
+	subtitle := pairs[0].Subtitles[0]
+	if renamer.FormatEpisodeLabel(subtitle) != renamer.FormatEpisodeLabel(video) || !subtitle.HasSeason {
+		t.Fatalf("subtitle numbered %+v, want the numbering of %+v", subtitle, video)
+	}
+}
+
+func TestReviewParsedEpisodes(t *testing.T) {
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	captureMessages(t, logNormal)
+
+	// The subtitle gets a bad value first, then S02E05; the video keeps its
+	// season and becomes episode 5.
+	stdinReader = bufio.NewReader(strings.NewReader("2\nabc\nS02E05\n1\n5\n0\n"))
+
+	videoFiles := []renamer.FileInfo{{Path: "Show - 1080.mkv", Season: 2, Episode: 1080, HasSeason: true, Extension: ".mkv"}}
+	subtitleFiles := []renamer.FileInfo{{Path: "Show 5.srt", Season: 1, Episode: 3, Extension: ".srt"}}
+
+	videoFiles, subtitleFiles, err := reviewParsedEpisodes(videoFiles, subtitleFiles)
+	if err != nil {
+		t.Fatalf("review episodes: %v", err)
+	}
+
+	if len(videoFiles) != 1 || videoFiles[0].Season != 2 || videoFiles[0].Episode != 5 {
+		t.Fatalf("unexpected corrected video: %+v", videoFiles)
+	}
+
+	if len(subtitleFiles) != 1 || subtitleFiles[0].Season != 2 || subtitleFiles[0].Episode != 5 || !subtitleFiles[0].HasSeason {
+		t.Fatalf("unexpected corrected subtitle: %+v", subtitleFiles)
+	}
+
+	pairs, unmatched := renamer.Pair(videoFiles, subtitleFiles, renamer.PairOptions{})
+	if len(pairs) != 1 || len(unmatched) != 0 {
+		t.Fatalf("expected corrected files to pair, got %+v and %+v", pairs, unmatched)
+	}
+}
+
+func TestApplyEpisodeOverride(t *testing.T) {
+	testCases := []struct {
+		value     string
+		wantOK    bool
+		wantLabel string
+	}{
+		{value: "S02E05", wantOK: true, wantLabel: "S02E05"},
+		{value: "07.5", wantOK: true, wantLabel: "S01E07.5"},
+		{value: "0", wantOK: true, wantLabel: "S01E00"},
+		{value: "S03E00", wantOK: true, wantLabel: "S03E00"},
+		{value: "abc", wantLabel: "S01E09"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.value, func(t *testing.T) {
+			file := renamer.FileInfo{Path: "Show - 09.mkv", Season: 1, Episode: 9}
+			if ok := applyEpisodeOverride(&file, testCase.value); ok != testCase.wantOK {
+				t.Fatalf("applyEpisodeOverride(%q) = %t, want %t", testCase.value, ok, testCase.wantOK)
+			}
+
+			if label := renamer.FormatEpisodeLabel(file); label != testCase.wantLabel {
+				t.Fatalf("episode = %s, want %s", label, testCase.wantLabel)
+			}
+		})
+	}
+}
+
+func TestGetUserInputLine(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("  ~/Videos/Show \nShow Name"))
+	var output strings.Builder
+
+	folder, err := getUserInputLine(input, &output, "Folder: ")
+	if err != nil || folder != "~/Videos/Show" {
+		t.Fatalf("expected the trimmed first line, got %q (%v)", folder, err)
+	}
+
+	name, err := getUserInputLine(input, &output, "Name: ")
+	if err != nil || name != "Show Name" {
+		t.Fatalf("expected the last line without a newline, got %q (%v)", name, err)
+	}
+
+	if _, err := getUserInputLine(input, &output, "More: "); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF once the input is used up, got %v", err)
+	}
+
+	if output.String() != "Folder: Name: More: " {
+		t.Fatalf("unexpected prompts %q", output.String())
+	}
+}
+
+func TestConfirmRename(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		defaultAnswer string
+		want          bool
+		wantRetry     bool
+		wantErr       bool
+	}{
+		{name: "yes", input: "yes\n", want: true},
+		{name: "no", input: "n\n"},
+		{name: "invalid then yes", input: "maybe\nyes\n", want: true, wantRetry: true},
+		{name: "enter without default asks again", input: "\ny\n", want: true, wantRetry: true},
+		{name: "enter with default yes", input: "\n", defaultAnswer: "yes", want: true},
+		{name: "enter with default no", input: "\n", defaultAnswer: "no"},
+		{name: "explicit answer beats default", input: "no\n", defaultAnswer: "yes"},
+		{name: "end of input", input: "", defaultAnswer: "yes", wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var output strings.Builder
+
+			got, err := confirmRename(strings.NewReader(testCase.input), &output, testCase.defaultAnswer)
+			if (err != nil) != testCase.wantErr || got != testCase.want {
+				t.Fatalf("confirmRename(%q) = %t, %v, want %t", testCase.input, got, err, testCase.want)
+			}
+
+			if retried := strings.Contains(output.String(), "Please answer"); retried != testCase.wantRetry {
+				t.Fatalf("asked again = %t, want %t, output %q", retried, testCase.wantRetry, output.String())
+			}
+		})
+	}
+}
+
+func TestCountMismatchHint(t *testing.T) {
 	testCases := []struct {
-		name        string
-		filename    string
-		wantSeason  int
-		wantEpisode int
+		name          string
+		videoCount    int
+		subtitleCount int
+		want          string
 	}{
-		{
-			name:        "S and episode with dash",
-			filename:    "Show S2 - 03.mkv",
-			wantSeason:  2,
-			wantEpisode: 3,
-		},
-		{
-			name:        "S and E compact",
-			filename:    "Show S01E12.ass",
-			wantSeason:  1,
-			wantEpisode: 12,
-		},
-		{
-			name:        "episode only with E prefix",
-			filename:    "Show E09.mp4",
-			wantSeason:  1,
-			wantEpisode: 9,
-		},
-		{
-			name:        "trailing numeric episode",
-			filename:    "Show 021.srt",
-			wantSeason:  1,
-			wantEpisode: 21,
-		},
-		{
-			name:        "no episode",
-			filename:    "Show Finale.mkv",
-			wantSeason:  1,
-			wantEpisode: 0,
-		},
+		{name: "twice the subtitles", videoCount: 12, subtitleCount: 24, want: "subtitles appear to be 2x the videos"},
+		{name: "twice the videos", videoCount: 24, subtitleCount: 12, want: "videos appear to be 2x the subtitles"},
+		{name: "no whole multiple", videoCount: 12, subtitleCount: 13},
+		{name: "no subtitles", videoCount: 12},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			gotSeason, gotEpisode := extractSeasonAndEpisode(testCase.filename)
-			if gotSeason != testCase.wantSeason || gotEpisode != testCase.wantEpisode {
-				t.Fatalf(
-					"extractSeasonAndEpisode(%q) = (%d, %d), want (%d, %d)",
-					testCase.filename,
-					gotSeason,
-					gotEpisode,
-					testCase.wantSeason,
-					testCase.wantEpisode,
-				)
+			got := countMismatchHint(testCase.videoCount, testCase.subtitleCount)
+			if !strings.HasPrefix(got, testCase.want) || (testCase.want == "") != (got == "") {
+				t.Fatalf("countMismatchHint(%d, %d) = %q, want %q", testCase.videoCount, testCase.subtitleCount, got, testCase.want)
 			}
 		})
 	}
 }
 
-func TestPreflightRenameOperationsDetectsDuplicateTargets(t *testing.T) {
+func TestRunRenamesFolder(t *testing.T) {
 	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
 
-	sourceOne := filepath.Join(tempDir, "episode-01.mkv")
-	sourceTwo := filepath.Join(tempDir, "episode-01.srt")
-	duplicateTarget := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	for _, name := range []string{"[Group] Show - 01.mkv", "Show - 01.en.srt", "[Group] Show - 02.mkv", "Show - 02.en.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
 
-	if err := os.WriteFile(sourceOne, []byte("video"), 0o600); err != nil {
-		t.Fatalf("create source one: %v", err)
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
 	}
 
-	if err := os.WriteFile(sourceTwo, []byte("subtitle"), 0o600); err != nil {
-		t.Fatalf("create source two: %v", err)
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
 	}
 
-	operations := []RenameOperation{
-		{OldPath: sourceOne, NewPath: duplicateTarget},
-		{OldPath: sourceTwo, NewPath: duplicateTarget},
+	for _, name := range []string{
+		"Show - S01E01.mkv",
+		"Show - S01E01.en.srt",
+		"Show - S01E02.mkv",
+		"Show - S01E02.en.srt",
+		renamer.UndoJournalName,
+	} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s after run: %v", name, err)
+		}
+	}
+	if !strings.Contains(output.String(), "Files renamed:    4\n") {
+		t.Fatalf("expected a summary with four renamed files, got %q", output.String())
 	}
+}
+
+func TestRunRefusesShowNamesStartingWithADot(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
 
-	err := preflightRenameOperations(operations)
-	if err == nil {
-		t.Fatal("expected preflight error, got nil")
+	names := []string{"Show - 01.mkv", "Show - 01.en.srt"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
 	}
 
-	if !strings.Contains(err.Error(), "duplicate target path detected") {
-		t.Fatalf("expected duplicate target message, got: %v", err)
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", ".hack Sign", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	// Hidden targets would drop out of every later run, so each run refuses
+	// them and leaves the files where a rerun still finds them.
+	for range 2 {
+		if err := run(config); err == nil || !strings.Contains(err.Error(), "starts with a dot") {
+			t.Fatalf("expected the dot-leading name to be refused, got %v", err)
+		}
+
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+				t.Fatalf("expected %s left alone: %v", name, err)
+			}
+		}
 	}
 }
 
-func TestExecuteRenameOperationsWithDryRunDoesNotRename(t *testing.T) {
+func TestRunDryRunAsksNothing(t *testing.T) {
 	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
 
-	oldPath := filepath.Join(tempDir, "episode-01.mkv")
-	newPath := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	stdinReader = bufio.NewReader(strings.NewReader(""))
 
-	if err := os.WriteFile(oldPath, []byte("video"), 0o600); err != nil {
-		t.Fatalf("create source file: %v", err)
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
 	}
 
-	renameCalled := false
-	renameFn := func(oldPath string, newPath string) error {
-		renameCalled = true
-		return os.Rename(oldPath, newPath)
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-dry-run"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
 	}
 
-	err := executeRenameOperationsWith(
-		[]RenameOperation{{OldPath: oldPath, NewPath: newPath}},
-		true,
-		renameFn,
-	)
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if strings.Contains(output.String(), "review the detected episode numbers") {
+		t.Fatalf("expected a dry run to print the plan without prompts, got %q", output.String())
+	}
+}
+
+func TestRunNamesEachShowInAMixedFolder(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+
+	// Both suggested names are accepted with Enter.
+	stdinReader = bufio.NewReader(strings.NewReader("\n\n"))
+
+	for _, name := range []string{
+		"Alpha - 01.mkv", "Alpha - 01.srt", "Alpha - 02.mkv", "Alpha - 02.srt",
+		"Beta - 01.mkv", "Beta - 01.srt", "Beta - 02.mkv", "Beta - 02.srt",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{
+		"Alpha - S01E01.mkv", "Alpha - S01E01.srt", "Alpha - S01E02.mkv", "Alpha - S01E02.srt",
+		"Beta - S01E01.mkv", "Beta - S01E01.srt", "Beta - S01E02.mkv", "Beta - S01E02.srt",
+	} {
+		data, err := os.ReadFile(filepath.Join(tempDir, name))
+		if err != nil || !strings.HasPrefix(string(data), strings.Split(name, " ")[0]) {
+			t.Fatalf("expected %s to hold a file of the same show, got %q (%v)", name, data, err)
+		}
+	}
+
+	config.AnimeName = "Alpha"
+	if err := run(config); err == nil || !strings.Contains(err.Error(), "different shows") {
+		t.Fatalf("expected -name to be refused for a mixed folder, got %v", err)
+	}
+}
+
+func TestRunRenamesVideosWithoutSubtitles(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 02.mkv", "Show - 01.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-yes", "-no-subs"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{"Show - S01E01.mkv", "Show - S01E02.mkv", "Show - 01.srt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s after run: %v", name, err)
+		}
+	}
+
+	if strings.Contains(output.String(), "Warning") {
+		t.Fatalf("expected no subtitle count warning, got %q", output.String())
+	}
+}
+
+func TestRunBacksUpOriginals(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	originals := []string{"Show - 01.mkv", "Show - 01.srt"}
+	for _, name := range originals {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-yes", "-backup"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(tempDir, renamer.BackupDirName, "*"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected one backup folder, got %v (%v)", backups, err)
+	}
+
+	for _, name := range originals {
+		data, err := os.ReadFile(filepath.Join(backups[0], name))
+		if err != nil || string(data) != name {
+			t.Fatalf("expected a backup of %s, got %q (%v)", name, data, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "Show - S01E01.mkv")); err != nil {
+		t.Fatalf("expected the video to be renamed: %v", err)
+	}
+
+	if _, err := parseFlagsWith([]string{"-folder", tempDir, "-backup", "-mode", "copy"}, ""); err == nil {
+		t.Fatal("expected -backup to be rejected with -mode copy")
+	}
+}
+
+func TestRunConvertsSubtitlesToUTF8(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
+
+	files := map[string]string{
+		"Show - 01.mkv": "video",
+		"Show - 01.srt": "1\n00:00:01,000 --> 00:00:02,000\n\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-yes", "-convert-utf8"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "Show - S01E01.srt"))
+	if err != nil || string(data) != "1\n00:00:01,000 --> 00:00:02,000\nこんにちは\n" {
+		t.Fatalf("expected the renamed subtitle in UTF-8, got %q (%v)", data, err)
+	}
+
+	if !strings.Contains(output.String(), "from Shift-JIS to UTF-8") {
+		t.Fatalf("expected the conversion to be reported, got %q", output.String())
+	}
+}
+
+func TestRunWritesMpvPlaylist(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	names := []string{"[Group] Show - 01.mkv", "Show - 01.en.srt", "[Group] Show - 02.mkv", "Show - 02.en.srt"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	playlist := filepath.Join(t.TempDir(), "play.sh")
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-yes", "-mpv-playlist", playlist}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	script, err := os.ReadFile(playlist)
+	if err != nil {
+		t.Fatalf("read playlist: %v", err)
+	}
+
+	for _, episode := range []string{"01", "02"} {
+		line := fmt.Sprintf(
+			"mpv --sub-file='%s' -- '%s'\n",
+			filepath.Join(tempDir, "Show - "+episode+".en.srt"),
+			filepath.Join(tempDir, "[Group] Show - "+episode+".mkv"),
+		)
+		if !strings.Contains(string(script), line) {
+			t.Fatalf("expected %q in the playlist, got %q", line, script)
+		}
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s to keep its name: %v", name, err)
+		}
+	}
+}
+
+func TestRunRenamesOnlyTheSelectedSeason(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
+
+	names := []string{"Show S01E01.mkv", "Show S01E01.srt", "Show S02E01.mkv", "Show S02E01.srt", "Show - 02.mkv"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-yes", "-season", "2"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{"Anime - S02E01.mkv", "Anime - S02E01.srt", names[0], names[1], names[4]} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s after run: %v", name, err)
+		}
+	}
+
+	if !strings.Contains(output.String(), "Leaving out 3 files from other seasons than season 2.") {
+		t.Fatalf("expected the left out files to be counted, got %q", output.String())
+	}
+
+	if strings.Contains(output.String(), "Warning: found") {
+		t.Fatalf("expected no count mismatch for the filtered files, got %q", output.String())
+	}
+}
+
+func TestRunDryRunDoesNotRename(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logNormal)
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Show", "-yes", "-dry-run"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s to remain after a dry run: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, renamer.UndoJournalName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no undo journal after a dry run, got: %v", err)
+	}
+
+	wantLine := "[dry-run] " + filepath.Join(tempDir, "Show - 01.mkv") + " -> " + filepath.Join(tempDir, "Show - S01E01.mkv")
+	if !strings.Contains(output.String(), wantLine) {
+		t.Fatalf("expected the planned rename in the output, got %q", output.String())
+	}
+}
+
+func TestRunBatchRenamesEachShowFolder(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+
+	// Both folders take their suggested names with Enter.
+	stdinReader = bufio.NewReader(strings.NewReader("\n\n"))
+
+	files := map[string][]string{
+		"Alpha":   {"[Group] Alpha - 01.mkv", "[Group] Alpha - 01.srt", "[Group] Alpha - 02.mkv", "[Group] Alpha - 02.srt"},
+		"Beta":    {"Beta 01.mkv", "Beta 01.ass", "Beta 02.mkv", "Beta 02.ass"},
+		"Empty":   nil,
+		".hidden": {"Hidden - 01.mkv"},
+	}
+	for folder, names := range files {
+		if err := os.Mkdir(filepath.Join(tempDir, folder), 0o755); err != nil {
+			t.Fatalf("create %s: %v", folder, err)
+		}
+
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(tempDir, folder, name), []byte(name), 0o600); err != nil {
+				t.Fatalf("create %s: %v", name, err)
+			}
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-batch", "-yes"}, "")
 	if err != nil {
-		t.Fatalf("execute dry-run: %v", err)
+		t.Fatalf("parse flags: %v", err)
 	}
 
-	if renameCalled {
-		t.Fatal("expected rename function to not be called in dry-run mode")
+	err = runBatch(config)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 folders failed") || !strings.Contains(err.Error(), "Empty") {
+		t.Fatalf("expected only the empty folder to fail, got %v", err)
 	}
 
-	if _, err := os.Stat(oldPath); err != nil {
-		t.Fatalf("expected original file to remain: %v", err)
+	for _, path := range []string{
+		filepath.Join("Alpha", "Alpha - S01E01.mkv"), filepath.Join("Alpha", "Alpha - S01E01.srt"),
+		filepath.Join("Alpha", "Alpha - S01E02.mkv"), filepath.Join("Alpha", "Alpha - S01E02.srt"),
+		filepath.Join("Beta", "Beta - S01E01.mkv"), filepath.Join("Beta", "Beta - S01E01.ass"),
+		filepath.Join("Beta", "Beta - S01E02.mkv"), filepath.Join("Beta", "Beta - S01E02.ass"),
+		filepath.Join(".hidden", "Hidden - 01.mkv"),
+	} {
+		if _, err := os.Stat(filepath.Join(tempDir, path)); err != nil {
+			t.Fatalf("expected %s: %v", path, err)
+		}
 	}
+}
 
-	if _, err := os.Stat(newPath); !errors.Is(err, os.ErrNotExist) {
-		t.Fatalf("expected target file to not exist, got: %v", err)
+func TestRunReturnsErrorForEmptyFolder(t *testing.T) {
+	captureMessages(t, logNormal)
+
+	config, err := parseFlagsWith([]string{"-folder", t.TempDir(), "-name", "Show", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err == nil {
+		t.Fatal("expected an error for a folder without videos or subtitles")
 	}
 }
 
-func TestExecuteRenameOperationsWithRollback(t *testing.T) {
+func TestRunReturnsErrorWhenRenamingFails(t *testing.T) {
 	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
 
-	oldVideo := filepath.Join(tempDir, "episode-01.mkv")
-	oldSubtitle := filepath.Join(tempDir, "episode-01.srt")
-	newVideo := filepath.Join(tempDir, "Anime - S01E01.mkv")
-	newSubtitle := filepath.Join(tempDir, "Anime - S01E01.srt")
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	// A file where the output folder should be makes every rename fail.
+	blocked := filepath.Join(t.TempDir(), "renamed")
+	if err := os.WriteFile(blocked, nil, 0o600); err != nil {
+		t.Fatalf("create %s: %v", blocked, err)
+	}
 
-	if err := os.WriteFile(oldVideo, []byte("video"), 0o600); err != nil {
-		t.Fatalf("create video file: %v", err)
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-output-dir", blocked, "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
 	}
 
-	if err := os.WriteFile(oldSubtitle, []byte("subtitle"), 0o600); err != nil {
-		t.Fatalf("create subtitle file: %v", err)
+	if err := run(config); err == nil {
+		t.Fatal("expected the failed renames to be returned as an error")
 	}
 
-	renameFn := func(oldPath string, newPath string) error {
-		if newPath == newSubtitle {
-			return errors.New("forced failure for rollback test")
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s to stay in place: %v", name, err)
 		}
+	}
 
-		return os.Rename(oldPath, newPath)
+	if _, err := renamer.ReadUndoJournal(tempDir); err == nil {
+		t.Fatal("expected no undo journal for a failed run")
 	}
+}
 
-	err := executeRenameOperationsWith(
-		[]RenameOperation{
-			{OldPath: oldVideo, NewPath: newVideo},
-			{OldPath: oldSubtitle, NewPath: newSubtitle},
-		},
-		false,
-		renameFn,
+func TestRunFlagsCollidingCopiesWithDuplicates(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logQuiet)
+
+	contents := map[string]string{
+		"Show - 01.mkv":        "episode one",
+		"Show - 01 - copy.mkv": "episode one",
+		"Show - 02.mkv":        "episode two",
+		"Show - 02.srt":        "subtitles two",
+	}
+	for name, content := range contents {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	args := []string{"-folder", tempDir, "-name", "Anime", "-duplicates", "-dry-run", "-yes", "-q"}
+	config, err := parseFlagsWith(args, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	want := fmt.Sprintf(
+		"%s looks like a copy of %s",
+		filepath.Join(tempDir, "Show - 01 - copy.mkv"),
+		filepath.Join(tempDir, "Show - 01.mkv"),
 	)
-	if err == nil {
-		t.Fatal("expected execution error, got nil")
+	if !strings.Contains(output.String(), want) {
+		t.Fatalf("output = %q, want a warning that %q", output.String(), want)
+	}
+}
+
+func TestRunStopsAtMaxFilesWithoutForce(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	names := []string{"Show - 01.mkv", "Show - 01.srt", "Show - 02.mkv", "Show - 02.srt"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-max-files", "3", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("expected an error pointing at -force, got %v", err)
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s to stay in place: %v", name, err)
+		}
+	}
+
+	config.Force = true
+	if err := run(config); err != nil {
+		t.Fatalf("run with -force: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "Anime - S01E02.mkv")); err != nil {
+		t.Fatalf("expected the files to be renamed with -force: %v", err)
 	}
+}
+
+func TestRunSkipsAlreadyNamedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	for _, name := range []string{"Anime - S01E01.mkv", "Anime - S01E01.srt", "Show - 02.mkv", "Show - 02.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := run(config); err != nil {
+			t.Fatalf("run %d: %v", attempt, err)
+		}
 
-	if _, statErr := os.Stat(oldVideo); statErr != nil {
-		t.Fatalf("expected video file restored to original name: %v", statErr)
+		journal, err := renamer.ReadUndoJournal(tempDir)
+		if err != nil {
+			t.Fatalf("read journal after run %d: %v", attempt, err)
+		}
+
+		if len(journal.Operations) != 2 {
+			t.Fatalf("expected the journal to keep the two real renames after run %d, got %+v", attempt, journal.Operations)
+		}
 	}
 
-	if _, statErr := os.Stat(oldSubtitle); statErr != nil {
-		t.Fatalf("expected subtitle file restored to original name: %v", statErr)
+	for _, name := range []string{"Anime - S01E01.mkv", "Anime - S01E01.srt", "Anime - S01E02.mkv", "Anime - S01E02.srt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
 	}
+}
+
+func TestPromptAnimeNameQuestionsNamesWithAnEpisode(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "corrected", input: "Show - S01E01\nShow\n", want: "Show"},
+		{name: "kept", input: "Show - 01\nShow - 01\n", want: "Show - 01"},
+		{name: "clean", input: "Mob Psycho 100\n", want: "Mob Psycho 100"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			output := captureMessages(t, logNormal)
+
+			previousReader := stdinReader
+			t.Cleanup(func() { stdinReader = previousReader })
+			stdinReader = bufio.NewReader(strings.NewReader(testCase.input))
+
+			animeName, err := promptAnimeName("")
+			if err != nil {
+				t.Fatalf("prompt: %v", err)
+			}
+
+			if animeName != testCase.want {
+				t.Fatalf("anime name = %q, want %q", animeName, testCase.want)
+			}
+
+			warned := strings.Contains(output.String(), "Warning:")
+			if want := testCase.name != "clean"; warned != want {
+				t.Fatalf("warned = %t, want %t: %q", warned, want, output.String())
+			}
+		})
+	}
+}
+
+func TestPrintPlanSetsApartMovesAndOverwrites(t *testing.T) {
+	tempDir := t.TempDir()
+	output := captureMessages(t, logQuiet)
+
+	existing := filepath.Join(tempDir, "Anime - S01E02.mkv")
+	if err := os.WriteFile(existing, nil, 0o600); err != nil {
+		t.Fatalf("create %s: %v", existing, err)
+	}
+
+	operations := []renamer.RenameOperation{
+		{OldPath: filepath.Join(tempDir, "Show - 01.mkv"), NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv")},
+		{OldPath: filepath.Join(tempDir, "Show - 02.mkv"), NewPath: existing},
+		{OldPath: filepath.Join(tempDir, "Show - 03.mkv"), NewPath: filepath.Join(tempDir, "Season 01", "Anime - S01E03.mkv")},
+	}
+
+	printPlan(operations)
+
+	// -q hides the plan but not the files about to be overwritten.
+	want := " Overwriting existing files:\n   " + filepath.Join(tempDir, "Show - 02.mkv") + " -> " + existing + "\n"
+	if output.String() != want {
+		t.Fatalf("output = %q, want %q", output.String(), want)
+	}
+
+	previousReader := stdinReader
+	t.Cleanup(func() { stdinReader = previousReader })
+	stdinReader = bufio.NewReader(strings.NewReader("no\n"))
 
-	if _, statErr := os.Stat(newVideo); !errors.Is(statErr, os.ErrNotExist) {
-		t.Fatalf("expected renamed video to not exist after rollback, got: %v", statErr)
+	confirmed, err := confirmOverwrites(operations)
+	if err != nil || confirmed {
+		t.Fatalf("expected the overwrite to be refused, got %t (%v)", confirmed, err)
 	}
 
-	if _, statErr := os.Stat(newSubtitle); !errors.Is(statErr, os.ErrNotExist) {
-		t.Fatalf("expected renamed subtitle to not exist after rollback, got: %v", statErr)
+	if confirmed, err := confirmOverwrites(operations[:1]); err != nil || !confirmed {
+		t.Fatalf("expected no question without overwrites, got %t (%v)", confirmed, err)
 	}
 }
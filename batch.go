@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runBatch runs every show folder directly inside config.FolderPath on its
+// own, each with its own name, plan and confirmation. A folder that fails
+// is reported and the rest still run; the failures are returned together
+// at the end.
+func runBatch(config AppConfig) error {
+	folders, err := showFolders(config.FolderPath)
+	if err != nil {
+		return err
+	}
+
+	if len(folders) == 0 {
+		return fmt.Errorf("no show folders found in %s", config.FolderPath)
+	}
+
+	var failures []error
+	for i, folder := range folders {
+		infof("\n[%d/%d] %s\n", i+1, len(folders), folder)
+
+		folderConfig := config
+		folderConfig.FolderPath = folder
+		if err := run(folderConfig); err != nil {
+			fmt.Fprintf(messageOutput, "Error: %v\n", err)
+			failures = append(failures, fmt.Errorf("%s: %w", filepath.Base(folder), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d folders failed:\n%w", len(failures), len(folders), errors.Join(failures...))
+	}
+
+	return nil
+}
+
+// showFolders lists the folders directly inside parent in name order,
+// leaving out hidden ones like the backup folder.
+func showFolders(parent string) ([]string, error) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil, fmt.Errorf("reading folder %s: %w", parent, err)
+	}
+
+	folders := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			folders = append(folders, filepath.Join(parent, entry.Name()))
+		}
+	}
+
+	return folders, nil
+}
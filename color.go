@@ -0,0 +1,25 @@
+package main
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// colorOutput turns on colored old and new names in the plan. It is only
+// set for a terminal, unless -no-color or NO_COLOR turns it off.
+var colorOutput = false
+
+func colorize(text string, color string) string {
+	if !colorOutput {
+		return text
+	}
+
+	return color + text + ansiReset
+}
+
+// renameLine shows an operation as "old -> new", the old name in red and
+// the new one in green when colors are on.
+func renameLine(oldPath string, newPath string) string {
+	return colorize(oldPath, ansiRed) + " -> " + colorize(newPath, ansiGreen)
+}
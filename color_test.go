@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"anime-renamer/thing/renamer"
+)
+
+func TestPlanColors(t *testing.T) {
+	operations := []renamer.RenameOperation{
+		{OldPath: "Show - 01.mkv", NewPath: "Show - S01E01.mkv"},
+		{OldPath: "Show - S01E02.mkv", NewPath: "Show - S01E02.mkv"},
+	}
+
+	testCases := []struct {
+		name      string
+		color     bool
+		wantLines []string
+	}{
+		{
+			name:      "no color",
+			wantLines: []string{"  Show - 01.mkv -> Show - S01E01.mkv\n", "[dry-run] Show - 01.mkv -> Show - S01E01.mkv\n"},
+		},
+		{
+			name:  "color",
+			color: true,
+			wantLines: []string{
+				"  \x1b[31mShow - 01.mkv\x1b[0m -> \x1b[32mShow - S01E01.mkv\x1b[0m\n",
+				"[dry-run] \x1b[31mShow - 01.mkv\x1b[0m -> \x1b[32mShow - S01E01.mkv\x1b[0m\n",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			output := captureMessages(t, logNormal)
+			previousColor := colorOutput
+			t.Cleanup(func() {
+				colorOutput = previousColor
+			})
+			colorOutput = testCase.color
+
+			printPlan(operations)
+			printOperations(operations, true, renamer.ModeRename)
+
+			for _, line := range testCase.wantLines {
+				if !strings.Contains(output.String(), line) {
+					t.Fatalf("expected %q in %q", line, output.String())
+				}
+			}
+
+			if !testCase.color && strings.Contains(output.String(), "\x1b[") {
+				t.Fatalf("expected no ANSI escapes without color, got %q", output.String())
+			}
+		})
+	}
+}
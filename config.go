@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"anime-renamer/thing/renamer"
+)
+
+type namingPreset struct {
+	Template         string
+	SeasonSubfolders bool
+}
+
+var namingPresets = map[string]namingPreset{
+	"plex":     {Template: "{name} - s{season}e{episode} - {title}{ext}"},
+	"jellyfin": {Template: "{name} S{season}E{episode}{ext}", SeasonSubfolders: true},
+}
+
+type fileConfig struct {
+	Folder             string   `json:"folder"`
+	Name               string   `json:"name"`
+	Case               string   `json:"case"`
+	Template           string   `json:"template"`
+	VideoExtensions    []string `json:"videoExtensions"`
+	SubtitleExtensions []string `json:"subtitleExtensions"`
+	NoiseTokens        []string `json:"noiseTokens"`
+
+	EpisodePatterns      []string `json:"episodePatterns"`
+	EpisodePatternsFirst bool     `json:"episodePatternsFirst"`
+	PatternOrder         []string `json:"patternOrder"`
+}
+
+func parseFlags(args []string) (AppConfig, error) {
+	return parseFlagsWith(args, defaultConfigPath())
+}
+
+func parseFlagsWith(args []string, defaultConfigFile string) (AppConfig, error) {
+	config := AppConfig{}
+	var seasonCountsValue string
+	var patternOrderValue string
+	var configPath string
+
+	flagSet := flag.NewFlagSet("anime-renamer", flag.ContinueOnError)
+	flagSet.StringVar(&configPath, "config", "", "path to a JSON config file (default: user config dir)")
+	flagSet.StringVar(&config.FolderPath, "folder", "", "folder containing the videos and subtitles")
+	flagSet.StringVar(&config.SubFolder, "sub-folder", "", "folder containing the subtitles, if not the video folder")
+	flagSet.StringVar(&config.AnimeName, "name", "", "name of the anime used for the new file names")
+	flagSet.StringVar(&config.NameCase, "case", renamer.NameCaseAsIs, "case given to the anime name: lower, upper, title or asis")
+	flagSet.BoolVar(&config.AssumeYes, "yes", false, "rename without asking for confirmation")
+	flagSet.StringVar(&config.DefaultAnswer, "default-answer", "", "answer taken when Enter is pressed at the confirmation: yes or no")
+	flagSet.BoolVar(&config.DryRun, "dry-run", false, "print planned renames without changing files")
+	flagSet.BoolVar(&config.Batch, "batch", false, "rename each subfolder of the folder as a show of its own")
+	flagSet.BoolVar(&config.Undo, "undo", false, "revert the most recent rename batch in the folder")
+	flagSet.BoolVar(&config.JSON, "json", false, "print a JSON report to stdout and all other output to stderr")
+	flagSet.BoolVar(&config.Verbose, "v", false, "print how every scanned file was parsed")
+	flagSet.BoolVar(&config.Quiet, "q", false, "only print warnings, errors and prompts")
+	flagSet.BoolVar(&config.NoColor, "no-color", false, "never color the old and new names in the plan")
+	flagSet.StringVar(&config.Template, "template", renamer.DefaultTemplate, "naming template for renamed files")
+	flagSet.StringVar(&config.Preset, "preset", "", "naming preset for a media server: plex or jellyfin")
+	flagSet.BoolVar(&config.SeasonSubfolders, "seasons-subfolders", false, "move renamed files into \"Season NN\" folders")
+	flagSet.StringVar(&config.Mode, "mode", renamer.ModeRename, "how renamed files are produced: rename, copy, hardlink or symlink")
+	flagSet.StringVar(&config.OutputDir, "output-dir", "", "folder for the renamed files instead of the scanned folder")
+	flagSet.StringVar(&config.LinkDir, "link-dir", "", "folder for the symbolic links created by -mode symlink")
+	flagSet.BoolVar(&config.KeepModTimes, "keep-mtime", true, "give renamed files and copies the modification time of the original")
+	flagSet.BoolVar(&config.ContinueOnError, "continue-on-error", false, "keep renaming after a failure instead of rolling back")
+	flagSet.BoolVar(&config.ConvertUTF8, "convert-utf8", false, "rewrite text subtitles in other encodings as UTF-8")
+	flagSet.StringVar(&config.MpvPlaylist, "mpv-playlist", "", "write a script playing each pair in mpv to this file instead of renaming")
+	flagSet.StringVar(&config.Orphans, "orphans", "", "what to do with subtitles that matched no video after renaming: move or delete")
+	flagSet.BoolVar(&config.Backup, "backup", false, "save the originals to a timestamped backup folder before renaming")
+	flagSet.BoolVar(&config.ReplaceLinks, "replace-links", false, "replace existing symbolic links in -link-dir")
+	flagSet.IntVar(&config.Workers, "workers", runtime.NumCPU(), "number of files parsed in parallel while scanning")
+	flagSet.IntVar(&config.MaxFiles, "max-files", 1000, "stop when a scan finds more files than this, 0 for no limit")
+	flagSet.BoolVar(
+		&config.Force,
+		"force",
+		false,
+		"rename even when the scan finds more files than -max-files, and with -yes delete -orphans without asking",
+	)
+	flagSet.BoolVar(&config.Recursive, "recursive", false, "scan subdirectories of the folder as well")
+	flagSet.BoolVar(&config.FoldParts, "fold-parts", false, "number \"Part N\"/\"Cour N\" releases as separate seasons")
+	flagSet.BoolVar(&config.FuzzyNames, "fuzzy-names", false, "pair leftover files by file name similarity")
+	flagSet.BoolVar(&config.FindDuplicates, "duplicates", false, "flag unmatched files that are copies of paired files")
+	flagSet.BoolVar(&config.Sniff, "sniff", false, "tell videos and subtitles apart by their content, not their extension")
+	flagSet.BoolVar(&config.NoSubs, "no-subs", false, "rename videos alone, without looking for subtitles")
+	flagSet.BoolVar(&config.SubsOnly, "subs-only", false, "leave the videos alone and name each subtitle after its video")
+	flagSet.StringVar(&config.TitlesFile, "titles", "", "JSON file of episode titles by season and episode for {title}")
+	flagSet.StringVar(&config.MapFile, "map", "", "CSV or JSON file giving listed files their season and episode")
+	flagSet.IntVar(&config.Season, "season", 0, "only rename the files of this season")
+	flagSet.IntVar(&config.FinalSeason, "final-season", 0, "season number of files from a \"Final Season\"")
+	flagSet.IntVar(&config.SeasonOffset, "season-offset", 0, "number added to subtitle seasons before pairing (e.g. -1)")
+	flagSet.BoolVar(&config.GroupByDir, "group-by-dir", false, "pair files only with files from the same directory")
+	flagSet.StringVar(&patternOrderValue, "pattern-order", "", "episode patterns to try first (e.g. trailing,episode)")
+	flagSet.StringVar(
+		&seasonCountsValue,
+		"season-counts",
+		"",
+		"comma-separated episode counts per season for absolute numbering (e.g. 12,13)",
+	)
+
+	positional, err := parseInterspersedFlags(flagSet, args)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	setFlags := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	positionalFolder, positionalName, err := parsePositionalArgs(positional)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	if positionalFolder != "" {
+		if setFlags["folder"] {
+			return AppConfig{}, errors.New("the folder was given both as -folder and as an argument")
+		}
+
+		config.FolderPath = positionalFolder
+		setFlags["folder"] = true
+	}
+
+	if positionalName != "" {
+		if setFlags["name"] {
+			return AppConfig{}, errors.New("the anime name was given both as -name and as an argument")
+		}
+
+		config.AnimeName = positionalName
+		setFlags["name"] = true
+	}
+
+	fileValues, err := loadFileConfig(configPath, defaultConfigFile)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	applyFileConfig(&config, fileValues, setFlags)
+
+	// The config file's name belongs to a single show, not to every folder
+	// of a batch.
+	if config.Batch && !setFlags["name"] {
+		config.AnimeName = ""
+	}
+
+	if setFlags["pattern-order"] {
+		config.PatternOrder = strings.Split(patternOrderValue, ",")
+	}
+
+	if err := renamer.ValidatePatternOrder(config.PatternOrder); err != nil {
+		return AppConfig{}, err
+	}
+
+	for _, expression := range config.EpisodePatterns {
+		if err := renamer.ValidateEpisodePattern(expression); err != nil {
+			return AppConfig{}, fmt.Errorf("config file: %w", err)
+		}
+	}
+
+	if config.Preset != "" {
+		preset, ok := namingPresets[strings.ToLower(config.Preset)]
+		if !ok {
+			return AppConfig{}, fmt.Errorf("unknown -preset %q", config.Preset)
+		}
+
+		if !setFlags["template"] {
+			config.Template = preset.Template
+		}
+
+		config.SeasonSubfolders = config.SeasonSubfolders || preset.SeasonSubfolders
+	}
+
+	seasonCounts, err := parseSeasonCounts(seasonCountsValue)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	if err := renamer.ValidateTemplate(config.Template); err != nil {
+		return AppConfig{}, err
+	}
+
+	if config.Season < 0 {
+		return AppConfig{}, fmt.Errorf("-season must be a season number, got %d", config.Season)
+	}
+
+	if config.FinalSeason < 0 {
+		return AppConfig{}, fmt.Errorf("-final-season must be a season number, got %d", config.FinalSeason)
+	}
+
+	if config.MaxFiles < 0 {
+		return AppConfig{}, fmt.Errorf("-max-files must be 0 or more, got %d", config.MaxFiles)
+	}
+
+	if config.Workers < 1 {
+		return AppConfig{}, fmt.Errorf("-workers must be at least 1, got %d", config.Workers)
+	}
+
+	config.NameCase = strings.ToLower(strings.TrimSpace(config.NameCase))
+	if !slices.Contains(renamer.NameCases, config.NameCase) {
+		return AppConfig{}, fmt.Errorf(
+			"unknown -case %q, expected one of %s",
+			config.NameCase,
+			strings.Join(renamer.NameCases, ", "),
+		)
+	}
+
+	config.Mode = strings.ToLower(strings.TrimSpace(config.Mode))
+	if !slices.Contains(renamer.TransferModes, config.Mode) {
+		return AppConfig{}, fmt.Errorf(
+			"unknown -mode %q, expected one of %s",
+			config.Mode,
+			strings.Join(renamer.TransferModes, ", "),
+		)
+	}
+
+	if config.LinkDir, err = normalizePath(config.LinkDir); err != nil {
+		return AppConfig{}, err
+	}
+	if (config.Mode == renamer.ModeSymlink) != (config.LinkDir != "") {
+		return AppConfig{}, errors.New("-mode symlink and -link-dir must be used together")
+	}
+
+	if config.Mode == renamer.ModeSymlink && config.OutputDir != "" {
+		return AppConfig{}, errors.New("-output-dir cannot be used with -mode symlink, use -link-dir")
+	}
+
+	config.DefaultAnswer = strings.ToLower(strings.TrimSpace(config.DefaultAnswer))
+	if config.DefaultAnswer != "" && config.DefaultAnswer != "yes" && config.DefaultAnswer != "no" {
+		return AppConfig{}, fmt.Errorf("-default-answer must be yes or no, got %q", config.DefaultAnswer)
+	}
+
+	if config.ContinueOnError && config.Mode != renamer.ModeRename {
+		return AppConfig{}, errors.New("-continue-on-error only works with -mode rename")
+	}
+
+	if config.ConvertUTF8 && config.Mode == renamer.ModeSymlink {
+		return AppConfig{}, errors.New("-convert-utf8 cannot be used with -mode symlink, a link has no content of its own")
+	}
+
+	if config.MpvPlaylist, err = normalizePath(config.MpvPlaylist); err != nil {
+		return AppConfig{}, err
+	}
+
+	if config.MapFile, err = normalizePath(config.MapFile); err != nil {
+		return AppConfig{}, err
+	}
+
+	if config.TitlesFile, err = normalizePath(config.TitlesFile); err != nil {
+		return AppConfig{}, err
+	}
+
+	if config.MpvPlaylist != "" && (config.NoSubs || config.SubsOnly) {
+		return AppConfig{}, errors.New("-mpv-playlist cannot be used with -no-subs or -subs-only")
+	}
+
+	if config.Orphans != "" && config.Orphans != orphansMove && config.Orphans != orphansDelete {
+		return AppConfig{}, fmt.Errorf("unknown -orphans %q, want move or delete", config.Orphans)
+	}
+
+	if config.Orphans != "" && config.Mode != renamer.ModeRename {
+		return AppConfig{}, errors.New("-orphans only works with -mode rename, the other modes leave the folder as it is")
+	}
+
+	if config.Backup && config.Mode != renamer.ModeRename {
+		return AppConfig{}, errors.New("-backup only works with -mode rename, the other modes keep the originals")
+	}
+
+	batchConflict := config.Undo || config.JSON || config.SubFolder != "" || config.MpvPlaylist != "" || setFlags["name"]
+	if config.Batch && batchConflict {
+		return AppConfig{}, errors.New(
+			"-batch names every show folder on its own and cannot be used with -undo, -json, -sub-folder, -mpv-playlist or -name",
+		)
+	}
+
+	if config.Verbose && config.Quiet {
+		return AppConfig{}, errors.New("-v and -q cannot be used together")
+	}
+
+	if config.GroupByDir && !config.Recursive {
+		return AppConfig{}, errors.New("-group-by-dir requires -recursive")
+	}
+
+	if config.NoSubs && config.SubFolder != "" {
+		return AppConfig{}, errors.New("-no-subs cannot be used with -sub-folder")
+	}
+
+	if config.SubsOnly && (config.NoSubs || config.SeasonSubfolders || config.OutputDir != "" || config.LinkDir != "") {
+		return AppConfig{}, errors.New(
+			"-subs-only keeps subtitles next to their videos and cannot be used with " +
+				"-no-subs, season subfolders, -output-dir or -link-dir",
+		)
+	}
+
+	if config.GroupByDir && config.SubFolder != "" {
+		return AppConfig{}, errors.New("-group-by-dir cannot be used with -sub-folder")
+	}
+
+	config.SeasonCounts = seasonCounts
+	config.FolderPath = strings.TrimSpace(config.FolderPath)
+	config.AnimeName = strings.TrimSpace(config.AnimeName)
+	if config.OutputDir, err = normalizePath(config.OutputDir); err != nil {
+		return AppConfig{}, err
+	}
+
+	if config.SubFolder, err = normalizePath(config.SubFolder); err != nil {
+		return AppConfig{}, err
+	}
+
+	return config, nil
+}
+
+// parseInterspersedFlags parses the flags in args and returns the other
+// arguments, so flags may also follow them, as in "anime-renamer show -yes".
+// Everything after "--" is an argument.
+func parseInterspersedFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if flagSet.NArg() == 0 {
+			return positional, nil
+		}
+
+		consumed := len(args) - flagSet.NArg()
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, flagSet.Args()...), nil
+		}
+
+		positional = append(positional, flagSet.Arg(0))
+		args = flagSet.Args()[1:]
+	}
+}
+
+// parsePositionalArgs takes the folder and, optionally, the anime name
+// from the arguments left after the flags.
+func parsePositionalArgs(args []string) (string, string, error) {
+	switch len(args) {
+	case 0:
+		return "", "", nil
+	case 1:
+		return args[0], "", nil
+	case 2:
+		return args[0], args[1], nil
+	default:
+		return "", "", fmt.Errorf("expected at most a folder and an anime name, got %d arguments", len(args))
+	}
+}
+
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "anime-renamer", "config.json")
+}
+
+// loadFileConfig reads the config file given with -config, which must exist,
+// or falls back to the default location, which is optional.
+func loadFileConfig(explicitPath string, defaultPath string) (fileConfig, error) {
+	path := explicitPath
+	if path == "" {
+		path = defaultPath
+	}
+
+	if path == "" {
+		return fileConfig{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && explicitPath == "" {
+		return fileConfig{}, nil
+	}
+
+	if err != nil {
+		return fileConfig{}, fmt.Errorf("reading config file: %w", err)
+	}
+
+	values := fileConfig{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fileConfig{}, fmt.Errorf("decoding config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func applyFileConfig(config *AppConfig, values fileConfig, setFlags map[string]bool) {
+	if !setFlags["folder"] && values.Folder != "" {
+		config.FolderPath = values.Folder
+	}
+
+	if !setFlags["name"] && values.Name != "" {
+		config.AnimeName = values.Name
+	}
+
+	if !setFlags["case"] && values.Case != "" {
+		config.NameCase = values.Case
+	}
+
+	if !setFlags["template"] && values.Template != "" {
+		config.Template = values.Template
+	}
+
+	config.VideoExtensions = renamer.VideoExtensions
+	if len(values.VideoExtensions) > 0 {
+		config.VideoExtensions = normalizeExtensions(values.VideoExtensions)
+	}
+
+	config.SubtitleExtensions = renamer.SubtitleExtensions
+	if len(values.SubtitleExtensions) > 0 {
+		config.SubtitleExtensions = normalizeExtensions(values.SubtitleExtensions)
+	}
+
+	config.NoiseTokens = renamer.ReleaseNoiseTokens
+	if len(values.NoiseTokens) > 0 {
+		config.NoiseTokens = values.NoiseTokens
+	}
+
+	config.EpisodePatterns = values.EpisodePatterns
+	config.EpisodePatternsFirst = values.EpisodePatternsFirst
+	config.PatternOrder = values.PatternOrder
+}
+
+func normalizeExtensions(extensions []string) []string {
+	normalized := make([]string, 0, len(extensions))
+
+	for _, extension := range extensions {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if extension == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+
+		normalized = append(normalized, extension)
+	}
+
+	return normalized
+}
+
+func parseSeasonCounts(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	counts := []int{}
+	for _, field := range strings.Split(value, ",") {
+		count, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid season episode count %q in -season-counts", field)
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anime-renamer/thing/renamer"
+)
+
+func TestParseFlags(t *testing.T) {
+	config, err := parseFlagsWith(
+		[]string{"-folder", "/videos/show", "-name", "My Show", "-yes", "-season-counts", "12,13"},
+		"",
+	)
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if config.FolderPath != "/videos/show" || config.AnimeName != "My Show" || !config.AssumeYes {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	if len(config.SeasonCounts) != 2 || config.SeasonCounts[0] != 12 || config.SeasonCounts[1] != 13 {
+		t.Fatalf("unexpected season counts: %v", config.SeasonCounts)
+	}
+
+	config, err = parseFlagsWith(nil, "")
+	if err != nil {
+		t.Fatalf("parse empty flags: %v", err)
+	}
+
+	if config.FolderPath != "" || config.AnimeName != "" || config.AssumeYes {
+		t.Fatalf("expected empty config without flags, got %+v", config)
+	}
+
+	if config.Template != renamer.DefaultTemplate || len(config.VideoExtensions) != len(renamer.VideoExtensions) {
+		t.Fatalf("expected built-in defaults, got %+v", config)
+	}
+
+	config, err = parseFlagsWith([]string{"-preset", "plex", "-seasons-subfolders"}, "")
+	if err != nil {
+		t.Fatalf("parse preset flags: %v", err)
+	}
+
+	if config.Template != namingPresets["plex"].Template || !config.SeasonSubfolders {
+		t.Fatalf("expected plex preset with season subfolders, got %+v", config)
+	}
+
+	config, err = parseFlagsWith([]string{"-preset", "jellyfin"}, "")
+	if err != nil {
+		t.Fatalf("parse jellyfin preset: %v", err)
+	}
+
+	if config.Template != namingPresets["jellyfin"].Template || !config.SeasonSubfolders {
+		t.Fatalf("expected jellyfin preset to imply season subfolders, got %+v", config)
+	}
+
+	if _, err := parseFlagsWith([]string{"-mode", "symlink"}, ""); err == nil {
+		t.Fatal("expected -mode symlink without -link-dir to fail")
+	}
+
+	if _, err := parseFlagsWith([]string{"-mode", "move"}, ""); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+
+	if _, err := parseFlagsWith([]string{"-preset", "unknown"}, ""); err == nil {
+		t.Fatal("expected an error for an unknown preset")
+	}
+
+	if _, err := parseFlagsWith([]string{"-v", "-q"}, ""); err == nil {
+		t.Fatal("expected an error when -v and -q are combined")
+	}
+
+	if _, err := parseFlagsWith([]string{"-recursive", "-group-by-dir", "-sub-folder", "subs"}, ""); err == nil {
+		t.Fatal("expected an error when -group-by-dir is combined with -sub-folder")
+	}
+
+	if _, err := parseFlagsWith([]string{"-default-answer", "maybe"}, ""); err == nil {
+		t.Fatal("expected an error for a -default-answer other than yes or no")
+	}
+
+	if _, err := parseFlagsWith([]string{"-pattern-order", "trailing,sideways"}, ""); err == nil {
+		t.Fatal("expected an error for an unknown pattern in -pattern-order")
+	}
+
+	if _, err := parseFlagsWith([]string{"-case", "snake"}, ""); err == nil {
+		t.Fatal("expected an error for an unknown -case")
+	}
+}
+
+func TestParsePositionalArgs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		args       []string
+		wantFolder string
+		wantName   string
+		wantErr    bool
+	}{
+		{name: "none"},
+		{name: "folder", args: []string{"/videos/show"}, wantFolder: "/videos/show"},
+		{name: "folder and name", args: []string{"/videos/show", "My Show"}, wantFolder: "/videos/show", wantName: "My Show"},
+		{name: "too many", args: []string{"/videos/show", "My Show", "extra"}, wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			folder, name, err := parsePositionalArgs(testCase.args)
+			if (err != nil) != testCase.wantErr || folder != testCase.wantFolder || name != testCase.wantName {
+				t.Fatalf("parsePositionalArgs(%q) = %q, %q, %v", testCase.args, folder, name, err)
+			}
+		})
+	}
+}
+
+func TestParseFlagsWithPositionalArgs(t *testing.T) {
+	config, err := parseFlagsWith([]string{"-dry-run", "/videos/show", "My Show", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if config.FolderPath != "/videos/show" || config.AnimeName != "My Show" || !config.DryRun || !config.AssumeYes {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	config, err = parseFlagsWith([]string{"-yes", "--", "-odd folder"}, "")
+	if err != nil || config.FolderPath != "-odd folder" {
+		t.Fatalf("expected the argument after -- to be the folder, got %q (%v)", config.FolderPath, err)
+	}
+
+	if _, err := parseFlagsWith([]string{"-folder", "/videos/show", "/videos/other"}, ""); err == nil {
+		t.Fatal("expected an error for a folder given twice")
+	}
+}
+
+func TestParseFlagsConfigPrecedence(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+
+	content := `{
+		"folder": "/from/config",
+		"name": "Config Show",
+		"template": "{name} S{season}E{episode}",
+		"videoExtensions": ["MKV", ".mp4"]
+	}`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	config, err := parseFlagsWith([]string{"-config", configPath, "-name", "Flag Show"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if config.AnimeName != "Flag Show" {
+		t.Fatalf("expected flag to override config name, got %q", config.AnimeName)
+	}
+
+	if config.FolderPath != "/from/config" || config.Template != "{name} S{season}E{episode}" {
+		t.Fatalf("expected config values where no flag was given, got %+v", config)
+	}
+
+	if len(config.VideoExtensions) != 2 || config.VideoExtensions[0] != ".mkv" {
+		t.Fatalf("expected normalized config extensions, got %v", config.VideoExtensions)
+	}
+
+	if len(config.SubtitleExtensions) != len(renamer.SubtitleExtensions) {
+		t.Fatalf("expected built-in subtitle extensions, got %v", config.SubtitleExtensions)
+	}
+
+	config, err = parseFlagsWith([]string{"-name", "Flag Show"}, configPath)
+	if err != nil {
+		t.Fatalf("parse flags with default config: %v", err)
+	}
+
+	if config.FolderPath != "/from/config" {
+		t.Fatalf("expected default config file to be used, got %+v", config)
+	}
+}
+
+func TestParseFlagsConfigFileErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+
+	if _, err := parseFlagsWith([]string{"-config", missing}, ""); err == nil {
+		t.Fatal("expected error for missing explicit config file")
+	}
+
+	if _, err := parseFlagsWith(nil, missing); err != nil {
+		t.Fatalf("expected missing default config to be ignored, got: %v", err)
+	}
+
+	for _, pattern := range []string{`#(\\d+`, `#(\\d+)`} {
+		configPath := filepath.Join(t.TempDir(), "config.json")
+		data := []byte(`{"episodePatterns": ["` + pattern + `"]}`)
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		if _, err := parseFlagsWith([]string{"-config", configPath}, ""); err == nil {
+			t.Fatalf("expected error for episode pattern %s", pattern)
+		}
+	}
+}
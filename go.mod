@@ -1,3 +1,5 @@
 module anime-renamer/thing
 
 go 1.22.0
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type logLevel int
+
+const (
+	logQuiet logLevel = iota
+	logNormal
+	logVerbose
+)
+
+var currentLogLevel = logNormal
+
+var messageMutex sync.Mutex
+
+// infof prints the regular progress output, which -q silences. Warnings,
+// errors and prompts are always printed.
+func infof(format string, args ...any) {
+	if currentLogLevel >= logNormal {
+		printMessage(format, args...)
+	}
+}
+
+// debugf prints per-file details that are only shown with -v. It is called
+// from the scanning workers, so output is serialized to keep lines intact.
+func debugf(format string, args ...any) {
+	if currentLogLevel >= logVerbose {
+		printMessage("Debug: "+format, args...)
+	}
+}
+
+func printMessage(format string, args ...any) {
+	messageMutex.Lock()
+	defer messageMutex.Unlock()
+
+	fmt.Fprintf(messageOutput, format, args...)
+}
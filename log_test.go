@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"anime-renamer/thing/renamer"
+)
+
+func captureMessages(t *testing.T, level logLevel) *bytes.Buffer {
+	t.Helper()
+
+	previousOutput := messageOutput
+	previousLevel := currentLogLevel
+	t.Cleanup(func() {
+		messageOutput = previousOutput
+		currentLogLevel = previousLevel
+	})
+
+	var output bytes.Buffer
+	messageOutput = &output
+	currentLogLevel = level
+
+	return &output
+}
+
+func TestLogLevels(t *testing.T) {
+	testCases := []struct {
+		name      string
+		level     logLevel
+		wantInfo  bool
+		wantDebug bool
+	}{
+		{name: "quiet", level: logQuiet},
+		{name: "normal", level: logNormal, wantInfo: true},
+		{name: "verbose", level: logVerbose, wantInfo: true, wantDebug: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			output := captureMessages(t, testCase.level)
+
+			infof("info line\n")
+			debugf("debug line\n")
+
+			if got := strings.Contains(output.String(), "info line"); got != testCase.wantInfo {
+				t.Fatalf("info printed = %t, want %t", got, testCase.wantInfo)
+			}
+
+			if got := strings.Contains(output.String(), "Debug: debug line"); got != testCase.wantDebug {
+				t.Fatalf("debug printed = %t, want %t", got, testCase.wantDebug)
+			}
+		})
+	}
+}
+
+func TestQuietKeepsPairWarnings(t *testing.T) {
+	output := captureMessages(t, logQuiet)
+
+	pairs := []renamer.FilePair{
+		{Video: renamer.FileInfo{Path: "Show - 01.mkv", Season: 2}, Fuzzy: true},
+		{Video: renamer.FileInfo{Path: "Other.mkv"}, SimilarName: true},
+	}
+	displayPairsAndUnmatched(pairs, nil, nil)
+
+	wants := []string{"Show - 01.mkv matched by episode number only", "Other.mkv matched by file name similarity"}
+	for _, want := range wants {
+		if !strings.Contains(output.String(), want) {
+			t.Fatalf("expected %q with -q, got %q", want, output.String())
+		}
+	}
+
+	if strings.Contains(output.String(), "Matched pairs") {
+		t.Fatalf("expected -q to leave out the pair list, got %q", output.String())
+	}
+}
+
+func TestScanVerboseOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 02.mkv", "Show Finale 1.mkv"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	output := captureMessages(t, logVerbose)
+
+	previousDebugf := renamer.Debugf
+	t.Cleanup(func() { renamer.Debugf = previousDebugf })
+	renamer.Debugf = debugf
+
+	if _, err := renamer.Scan(tempDir, renamer.ScanOptions{Workers: 4}); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected one debug line per file, got %q", output.String())
+	}
+
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Debug: ") {
+			t.Fatalf("expected intact debug lines, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"anime-renamer/thing/renamer"
+)
+
+// The -orphans values.
+const (
+	orphansMove   = "move"
+	orphansDelete = "delete"
+)
+
+// handleOrphans deals with the subtitles no video was found for once the
+// renames are done. They are moved into the unmatched folder or, after a
+// confirmation, deleted, as -orphans asks, and otherwise only counted.
+// -yes only accepts the renames, so deleting without asking takes -force
+// too. The moves are returned so they are journaled with the renames.
+func handleOrphans(config AppConfig, unmatched []renamer.FileInfo) ([]renamer.RenameOperation, error) {
+	orphans := []renamer.FileInfo{}
+	for _, file := range unmatched {
+		if slices.Contains(config.SubtitleExtensions, file.Extension) {
+			orphans = append(orphans, file)
+		}
+	}
+
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+
+	switch config.Orphans {
+	case orphansMove:
+		operations := renamer.OrphanOperations(config.FolderPath, orphans)
+		executeOptions := renamer.ExecuteOptions{Mode: renamer.ModeRename}
+		if err := renamer.Preflight(operations, executeOptions); err != nil {
+			return nil, fmt.Errorf("checking the moves of unmatched subtitles: %w", err)
+		}
+
+		if err := renamer.Execute(operations, executeOptions); err != nil {
+			return nil, fmt.Errorf("moving unmatched subtitles: %w", err)
+		}
+
+		infof("\nMoved %d unmatched subtitles:\n", len(orphans))
+		printOperations(operations, false, renamer.ModeRename)
+		return operations, nil
+	case orphansDelete:
+		fmt.Fprintf(messageOutput, "\n%d subtitles matched no video:\n", len(orphans))
+		for _, orphan := range orphans {
+			fmt.Fprintf(messageOutput, "  %s\n", orphan.Path)
+		}
+
+		switch {
+		case !config.AssumeYes:
+			confirmed, err := askYesNo("Delete them? (yes/no): ")
+			if err != nil || !confirmed {
+				return nil, err
+			}
+		case !config.Force:
+			fmt.Fprintln(messageOutput, "Not deleting them: -yes only accepts the renames, add -force to delete them too.")
+			return nil, nil
+		}
+
+		// The companions go first, so a subtitle is only deleted once
+		// nothing is left of it, and whole, as some are folders of fonts.
+		for _, orphan := range orphans {
+			for _, companion := range orphan.Companions {
+				if err := os.RemoveAll(companion); err != nil {
+					return nil, fmt.Errorf("deleting unmatched subtitle: %w", err)
+				}
+			}
+
+			if err := os.Remove(orphan.Path); err != nil {
+				return nil, fmt.Errorf("deleting unmatched subtitle: %w", err)
+			}
+		}
+
+		infof("Deleted %d unmatched subtitles.\n", len(orphans))
+		return nil, nil
+	default:
+		if config.Mode == renamer.ModeRename {
+			infof(
+				"\n%d subtitles matched no video, -orphans move puts them in an %q folder.\n",
+				len(orphans),
+				renamer.UnmatchedDirName,
+			)
+		}
+
+		return nil, nil
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anime-renamer/thing/renamer"
+)
+
+func TestRunMovesOrphanedSubtitles(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt", "Show - 07.srt", "Show - 08.sub", "Show - 08.idx"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-orphans", "move", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, path := range []string{
+		"Anime - S01E01.mkv",
+		"Anime - S01E01.srt",
+		filepath.Join(renamer.UnmatchedDirName, "Show - 07.srt"),
+		filepath.Join(renamer.UnmatchedDirName, "Show - 08.sub"),
+		filepath.Join(renamer.UnmatchedDirName, "Show - 08.idx"),
+	} {
+		if _, err := os.Stat(filepath.Join(tempDir, path)); err != nil {
+			t.Fatalf("expected %s: %v", path, err)
+		}
+	}
+
+	result, err := renamer.Scan(tempDir, renamer.ScanOptions{Recursive: true})
+	if err != nil || len(result.Subtitles) != 1 {
+		t.Fatalf("expected a later scan to leave out the unmatched folder, got %+v (%v)", result.Subtitles, err)
+	}
+
+	// -undo puts the orphans back with the renamed files.
+	config.Undo = true
+	if err := runUndo(config); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.srt", "Show - 07.srt", "Show - 08.sub", "Show - 08.idx"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s back after undo: %v", name, err)
+		}
+	}
+}
+
+func TestRunDeletesOrphansWithTheirFontsFolder(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	fontsDir := filepath.Join(tempDir, "Show - 07.fonts")
+	if err := os.Mkdir(fontsDir, 0o755); err != nil {
+		t.Fatalf("create fonts folder: %v", err)
+	}
+
+	names := []string{"Show - 01.mkv", "Show - 01.srt", "Show - 07.ass", filepath.Join("Show - 07.fonts", "a.ttf")}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	args := []string{"-folder", tempDir, "-name", "Anime", "-orphans", "delete", "-yes"}
+	config, err := parseFlagsWith(args, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	// -yes alone only accepts the renames and keeps the orphans.
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{"Show - 07.ass", filepath.Join("Show - 07.fonts", "a.ttf")} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected -yes to keep %s: %v", name, err)
+		}
+	}
+
+	if config, err = parseFlagsWith(append(args, "-force"), ""); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, name := range []string{"Show - 07.ass", "Show - 07.fonts"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be deleted, got %v", name, err)
+		}
+	}
+}
+
+func TestRunNumbersOrphansWhoseNameIsTaken(t *testing.T) {
+	tempDir := t.TempDir()
+	captureMessages(t, logNormal)
+
+	unmatchedDir := filepath.Join(tempDir, renamer.UnmatchedDirName)
+	if err := os.Mkdir(unmatchedDir, 0o755); err != nil {
+		t.Fatalf("create unmatched folder: %v", err)
+	}
+
+	files := map[string]string{
+		"Show - 01.mkv":    "video",
+		"Show - 01.srt":    "subtitle",
+		"Show - 07.en.srt": "NEW",
+		filepath.Join(renamer.UnmatchedDirName, "Show - 07.en.srt"): "OLD",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	config, err := parseFlagsWith([]string{"-folder", tempDir, "-name", "Anime", "-orphans", "move", "-yes"}, "")
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := run(config); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for name, want := range map[string]string{"Show - 07.en.srt": "OLD", "Show - 07 (2).en.srt": "NEW"} {
+		content, err := os.ReadFile(filepath.Join(unmatchedDir, name))
+		if err != nil || string(content) != want {
+			t.Fatalf("%s holds %q (%v), want %q", name, content, err, want)
+		}
+	}
+}
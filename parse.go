@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"anime-renamer/thing/renamer"
+)
+
+// runParse is the parse subcommand. It prints the season and episode read
+// from each file name given, and the pattern that found them, without
+// touching any file. The episode patterns and pattern order of the config
+// file are used.
+func runParse(args []string, output io.Writer, defaultConfigFile string) error {
+	var configPath string
+
+	flagSet := flag.NewFlagSet("anime-renamer parse", flag.ContinueOnError)
+	flagSet.SetOutput(messageOutput)
+	flagSet.StringVar(&configPath, "config", "", "path to a JSON config file (default: user config dir)")
+
+	names, err := parseInterspersedFlags(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return errors.New("parse needs at least one file name, e.g. anime-renamer parse \"Show - 05.mkv\"")
+	}
+
+	fileValues, err := loadFileConfig(configPath, defaultConfigFile)
+	if err != nil {
+		return err
+	}
+
+	options := renamer.ScanOptions{
+		SubtitleExtensions:   normalizeExtensions(fileValues.SubtitleExtensions),
+		EpisodePatterns:      fileValues.EpisodePatterns,
+		EpisodePatternsFirst: fileValues.EpisodePatternsFirst,
+		PatternOrder:         fileValues.PatternOrder,
+	}
+
+	for _, name := range names {
+		parse, err := renamer.ParseName(name, options)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(output, "%s: %s\n", name, describeParse(parse))
+	}
+
+	return nil
+}
+
+func describeParse(parse renamer.NameParse) string {
+	switch {
+	case parse.Extra != "":
+		return fmt.Sprintf("creditless extra %s, skipped", parse.Extra)
+	case !parse.Found():
+		return "no episode number found, skipped"
+	}
+
+	description := renamer.FormatEpisodeLabel(parse.FileInfo)
+	if parse.Version > 0 {
+		description += fmt.Sprintf(" v%d", parse.Version)
+	}
+
+	if parse.Special {
+		return description + ", special"
+	}
+
+	if strings.HasPrefix(parse.PatternName, "custom ") {
+		return description + fmt.Sprintf(", pattern %d (custom): %s", parse.Pattern, parse.Expression)
+	}
+
+	return description + fmt.Sprintf(", pattern %d (%s): %s", parse.Pattern, parse.PatternName, parse.Expression)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunParse(t *testing.T) {
+	var output strings.Builder
+	names := []string{"[Group] Show - 05v2 [1080p].mkv", "Show OVA 02.mkv", "NCOP1.mkv", "Pilot.mkv"}
+	if err := runParse(names, &output, ""); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := "[Group] Show - 05v2 [1080p].mkv: S01E05 v2, pattern 4 (dash): " +
+		`\s-\s\(?(?P<episode>\d+)(?:\.(?P<part>\d)\b)?\)?` + "\n" +
+		"Show OVA 02.mkv: S00E02, special\n" +
+		"NCOP1.mkv: creditless extra NCOP1, skipped\n" +
+		"Pilot.mkv: no episode number found, skipped\n"
+	if output.String() != want {
+		t.Fatalf("output =\n%s\nwant\n%s", output.String(), want)
+	}
+}
+
+func TestRunParseUsesConfigFilePatterns(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{"episodePatterns": ["No\\.(?P<episode>\\d+)"], "episodePatternsFirst": true}`
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("create config: %v", err)
+	}
+
+	var output strings.Builder
+	if err := runParse([]string{"-config", configPath, "Show No.07.mkv"}, &output, ""); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if want := "Show No.07.mkv: S01E07, pattern 1 (custom): No\\.(?P<episode>\\d+)\n"; output.String() != want {
+		t.Fatalf("output = %q, want %q", output.String(), want)
+	}
+
+	if err := runParse(nil, &output, ""); err == nil {
+		t.Fatal("expected an error without file names")
+	}
+}
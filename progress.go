@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"anime-renamer/thing/renamer"
+)
+
+// progressLineSteps is how many lines a batch prints when the output isn't
+// a terminal, so logs show progress without a line per file.
+const progressLineSteps = 10
+
+// newProgress returns a progress reporter for a batch, or nil with -q. On a
+// terminal it rewrites one line in place, elsewhere it prints a plain line
+// every tenth of the batch.
+func newProgress(verb string) renamer.ProgressFunc {
+	if currentLogLevel < logNormal {
+		return nil
+	}
+
+	return progressWriter(messageOutput, verb, isTerminal(messageOutput))
+}
+
+func progressWriter(output io.Writer, verb string, terminal bool) renamer.ProgressFunc {
+	return func(done int, total int) {
+		if terminal {
+			fmt.Fprintf(output, "\r\x1b[K%s %d/%d", verb, done, total)
+			if done == total {
+				fmt.Fprintln(output)
+			}
+			return
+		}
+
+		step := max(1, total/progressLineSteps)
+		if done%step == 0 || done == total {
+			fmt.Fprintf(output, "%s %d/%d\n", verb, done, total)
+		}
+	}
+}
+
+// isTerminal reports whether output is a character device like a terminal
+// rather than a pipe or file.
+func isTerminal(output io.Writer) bool {
+	file, ok := output.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
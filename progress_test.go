@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgressWriter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		terminal bool
+		total    int
+		want     []string
+	}{
+		{
+			name:  "periodic lines",
+			total: 30,
+			want: []string{
+				"Renaming 3/30", "Renaming 6/30", "Renaming 9/30", "Renaming 12/30", "Renaming 15/30",
+				"Renaming 18/30", "Renaming 21/30", "Renaming 24/30", "Renaming 27/30", "Renaming 30/30",
+			},
+		},
+		{name: "small batch", total: 2, want: []string{"Renaming 1/2", "Renaming 2/2"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var output bytes.Buffer
+			progress := progressWriter(&output, "Renaming", false)
+			for done := 1; done <= testCase.total; done++ {
+				progress(done, testCase.total)
+			}
+
+			if strings.ContainsAny(output.String(), "\r\x1b") {
+				t.Fatalf("expected plain lines without terminal codes, got %q", output.String())
+			}
+
+			lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+			if strings.Join(lines, "|") != strings.Join(testCase.want, "|") {
+				t.Fatalf("unexpected progress lines %q, want %q", lines, testCase.want)
+			}
+		})
+	}
+}
+
+func TestProgressWriterRewritesTerminalLine(t *testing.T) {
+	var output bytes.Buffer
+	progress := progressWriter(&output, "Creating", true)
+	progress(1, 2)
+	progress(2, 2)
+
+	if want := "\r\x1b[KCreating 1/2\r\x1b[KCreating 2/2\n"; output.String() != want {
+		t.Fatalf("unexpected terminal progress %q, want %q", output.String(), want)
+	}
+
+	if isTerminal(&output) {
+		t.Fatal("expected a buffer not to be a terminal")
+	}
+}
+
+func TestNewProgressRespectsQuiet(t *testing.T) {
+	captureMessages(t, logQuiet)
+
+	if newProgress("Renaming") != nil {
+		t.Fatal("expected no progress with -q")
+	}
+}
@@ -0,0 +1,78 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupDirName is the folder, inside the folder being renamed, that
+// BackupOriginals keeps its timestamped backups in. Scan never looks
+// inside it.
+const BackupDirName = ".anime-renamer-backup"
+
+const backupTimeFormat = "20060102-150405"
+
+// BackupOriginals saves the original of every pending operation into a
+// new folder named after at, under BackupDirName in folderPath, and
+// returns that folder. Files are hard linked where possible and copied
+// otherwise, and keep their path relative to folderPath. A failed backup
+// removes the folder again, so nothing is left half done.
+func BackupOriginals(folderPath string, operations []RenameOperation, at time.Time) (string, error) {
+	return backupOriginalsWith(folderPath, operations, at, linkFile)
+}
+
+func backupOriginalsWith(
+	folderPath string,
+	operations []RenameOperation,
+	at time.Time,
+	backupFn renameExecutor,
+) (string, error) {
+	backupRoot := filepath.Join(folderPath, BackupDirName)
+	if err := os.MkdirAll(backupRoot, 0o755); err != nil {
+		return "", fmt.Errorf("creating backup folder %s: %w", backupRoot, err)
+	}
+
+	backupDir := filepath.Join(backupRoot, at.Format(backupTimeFormat))
+	if err := os.Mkdir(backupDir, 0o755); err != nil {
+		return "", fmt.Errorf("creating backup folder %s: %w", backupDir, err)
+	}
+
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		backupPath := filepath.Join(backupDir, backupRelativePath(folderPath, operation.OldPath))
+		err := os.MkdirAll(filepath.Dir(backupPath), 0o755)
+		if err == nil {
+			err = backupFn(operation.OldPath, backupPath)
+		}
+
+		if err != nil {
+			backupErr := fmt.Errorf("backing up %s: %w", operation.OldPath, err)
+			if removeErr := os.RemoveAll(backupDir); removeErr != nil {
+				return "", errors.Join(backupErr, fmt.Errorf("removing incomplete backup %s: %w", backupDir, removeErr))
+			}
+
+			return "", backupErr
+		}
+	}
+
+	return backupDir, nil
+}
+
+// backupRelativePath keeps a file's place below folderPath, so files with
+// the same name in different season folders don't clash. Files outside
+// the folder are kept by name.
+func backupRelativePath(folderPath string, path string) string {
+	relativePath, err := filepath.Rel(folderPath, path)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return filepath.Base(path)
+	}
+
+	return relativePath
+}
@@ -0,0 +1,92 @@
+package renamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupOriginalsKeepsCopiesOfSources(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "Season 2"), 0o755); err != nil {
+		t.Fatalf("create season folder: %v", err)
+	}
+
+	sources := createSourceFiles(t, tempDir, "Show - 01.mkv", filepath.Join("Season 2", "Show - 01.mkv"))
+	named := createSourceFiles(t, tempDir, "Anime - S01E02.mkv")[0]
+	operations := []RenameOperation{
+		{OldPath: sources[0], NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv")},
+		{OldPath: sources[1], NewPath: filepath.Join(tempDir, "Season 2", "Anime - S02E01.mkv")},
+		{OldPath: named, NewPath: named},
+	}
+
+	at := time.Date(2024, 3, 9, 14, 5, 7, 0, time.Local)
+	backupDir, err := BackupOriginals(tempDir, operations, at)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+
+	if want := filepath.Join(tempDir, BackupDirName, "20240309-140507"); backupDir != want {
+		t.Fatalf("backup folder = %s, want %s", backupDir, want)
+	}
+
+	for _, name := range []string{"Show - 01.mkv", filepath.Join("Season 2", "Show - 01.mkv")} {
+		data, err := os.ReadFile(filepath.Join(backupDir, name))
+		if err != nil {
+			t.Fatalf("read backup of %s: %v", name, err)
+		}
+
+		if string(data) != name {
+			t.Fatalf("backup of %s holds %q", name, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(backupDir, "Anime - S01E02.mkv")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected already named files to be left out of the backup, got %v", err)
+	}
+
+	if err := executeOperations(operations, ExecuteOptions{}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	videos, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("find files: %v", err)
+	}
+
+	if len(videos) != 3 {
+		t.Fatalf("expected the backup folder to be skipped while scanning, got %v", videos)
+	}
+}
+
+func TestBackupOriginalsRemovesIncompleteBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	sources := createSourceFiles(t, tempDir, "Show - 01.mkv", "Show - 02.mkv")
+	operations := []RenameOperation{
+		{OldPath: sources[0], NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv")},
+		{OldPath: sources[1], NewPath: filepath.Join(tempDir, "Anime - S01E02.mkv")},
+	}
+
+	failing := func(oldPath string, newPath string) error {
+		if oldPath == sources[1] {
+			return errors.New("disk full")
+		}
+
+		return copyFile(oldPath, newPath)
+	}
+
+	if _, err := backupOriginalsWith(tempDir, operations, time.Now(), failing); err == nil {
+		t.Fatal("expected the failed backup to return an error")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(tempDir, BackupDirName))
+	if err != nil {
+		t.Fatalf("read backup root: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected the incomplete backup to be removed, got %v", entries)
+	}
+}
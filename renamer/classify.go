@@ -0,0 +1,62 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// OperationKind tells apart the operations of a plan by how much they
+// change, so the risky ones can be shown apart before confirming.
+type OperationKind string
+
+const (
+	// OperationRename renames a file within its folder.
+	OperationRename OperationKind = "rename"
+	// OperationMove puts a file in another folder, as season subfolders
+	// and -output-dir do.
+	OperationMove OperationKind = "move"
+	// OperationOverwrite replaces a file that already exists, like an old
+	// link with -replace-links.
+	OperationOverwrite OperationKind = "overwrite"
+)
+
+// ClassifyOperations sorts the pending operations by kind, keeping their
+// order. A target counts as overwritten when something exists there that
+// isn't moved away by another operation of the batch.
+func ClassifyOperations(operations []RenameOperation) map[OperationKind][]RenameOperation {
+	return classifyOperationsWith(operations, os.Lstat)
+}
+
+func classifyOperationsWith(
+	operations []RenameOperation,
+	statTarget func(string) (os.FileInfo, error),
+) map[OperationKind][]RenameOperation {
+	sources := map[string]struct{}{}
+	for _, operation := range operations {
+		if !operation.AlreadyNamed() {
+			sources[operation.OldPath] = struct{}{}
+		}
+	}
+
+	kinds := map[OperationKind][]RenameOperation{}
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		kind := OperationRename
+		if _, freed := sources[operation.NewPath]; !freed {
+			if _, err := statTarget(operation.NewPath); err == nil {
+				kind = OperationOverwrite
+			}
+		}
+
+		if kind == OperationRename && filepath.Dir(operation.OldPath) != filepath.Dir(operation.NewPath) {
+			kind = OperationMove
+		}
+
+		kinds[kind] = append(kinds[kind], operation)
+	}
+
+	return kinds
+}
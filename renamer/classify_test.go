@@ -0,0 +1,56 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyOperations(t *testing.T) {
+	folder := filepath.Join("anime", "Show")
+	existing := map[string]bool{
+		filepath.Join(folder, "Anime - S01E03.mkv"): true,
+		filepath.Join(folder, "Show - 04.mkv"):      true,
+	}
+
+	statTarget := func(path string) (os.FileInfo, error) {
+		if existing[path] {
+			return nil, nil
+		}
+
+		return nil, os.ErrNotExist
+	}
+
+	operations := []RenameOperation{
+		{OldPath: filepath.Join(folder, "Show - 01.mkv"), NewPath: filepath.Join(folder, "Anime - S01E01.mkv")},
+		{OldPath: filepath.Join(folder, "Show - 02.mkv"), NewPath: filepath.Join(folder, "Season 01", "Anime - S01E02.mkv")},
+		{OldPath: filepath.Join(folder, "Show - 03.mkv"), NewPath: filepath.Join(folder, "Anime - S01E03.mkv")},
+		// Renamed onto a file the batch moves away, which is no overwrite.
+		{OldPath: filepath.Join(folder, "Show - 05.mkv"), NewPath: filepath.Join(folder, "Show - 04.mkv")},
+		{OldPath: filepath.Join(folder, "Show - 04.mkv"), NewPath: filepath.Join(folder, "Anime - S01E04.mkv")},
+		{OldPath: filepath.Join(folder, "Anime - S01E06.mkv"), NewPath: filepath.Join(folder, "Anime - S01E06.mkv")},
+	}
+
+	kinds := classifyOperationsWith(operations, statTarget)
+
+	want := map[OperationKind][]string{
+		OperationRename:    {"Show - 01.mkv", "Show - 05.mkv", "Show - 04.mkv"},
+		OperationMove:      {"Show - 02.mkv"},
+		OperationOverwrite: {"Show - 03.mkv"},
+	}
+	for kind, names := range want {
+		if len(kinds[kind]) != len(names) {
+			t.Fatalf("%s operations = %+v, want %v", kind, kinds[kind], names)
+		}
+
+		for index, name := range names {
+			if got := filepath.Base(kinds[kind][index].OldPath); got != name {
+				t.Fatalf("%s operation %d = %s, want %s", kind, index, got, name)
+			}
+		}
+	}
+
+	if len(kinds) != len(want) {
+		t.Fatalf("expected the already named file to be left out, got %v", kinds)
+	}
+}
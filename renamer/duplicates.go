@@ -0,0 +1,161 @@
+package renamer
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// quickHashChunk is how much of the start and of the end of a file is
+// hashed to tell copies apart, which keeps hashing whole episodes cheap.
+const quickHashChunk = 64 * 1024
+
+// Duplicate is a file left out of the pairs with the same content as
+// Original, like a "Show 01 - copy.mkv" left by a second download.
+type Duplicate struct {
+	File     FileInfo
+	Original string
+}
+
+// FindDuplicates looks for probable copies among candidates, the files left
+// out of pairs: unmatched files, and the episode collisions and superseded
+// versions of ScanResult. Each candidate is compared with the paired files
+// and with the other candidates, shortest name first, so of "Show 01.mkv"
+// and "Show 01 - copy.mkv" colliding as one episode the copy is reported.
+// Only files of the same size are compared, by a hash of their size and the
+// start and end of their content, so a match is very likely but not certain.
+func FindDuplicates(pairs []FilePair, candidates []FileInfo) ([]Duplicate, error) {
+	sizeOf := func(path string) (int64, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, fmt.Errorf("checking file %s: %w", path, err)
+		}
+
+		return info.Size(), nil
+	}
+
+	seenBySize := map[int64][]string{}
+	for _, pair := range pairs {
+		for _, file := range append([]FileInfo{pair.Video}, pair.Subtitles...) {
+			if file.Path == "" {
+				continue
+			}
+
+			size, err := sizeOf(file.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			seenBySize[size] = append(seenBySize[size], file.Path)
+		}
+	}
+
+	candidates = slices.Clone(candidates)
+	slices.SortStableFunc(candidates, func(a FileInfo, b FileInfo) int {
+		lengthOrder := cmp.Compare(len(filepath.Base(a.Path)), len(filepath.Base(b.Path)))
+		return cmp.Or(lengthOrder, strings.Compare(a.Path, b.Path))
+	})
+
+	hashes := map[string]string{}
+	hashOf := func(path string, size int64) (string, error) {
+		if hash, ok := hashes[path]; ok {
+			return hash, nil
+		}
+
+		hash, err := quickHash(path, size)
+		hashes[path] = hash
+		return hash, err
+	}
+
+	duplicates := []Duplicate{}
+	checked := map[string]bool{}
+	for _, file := range candidates {
+		if checked[file.Path] {
+			continue
+		}
+
+		checked[file.Path] = true
+		size, err := sizeOf(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		original, err := findOriginal(file.Path, size, seenBySize[size], hashOf)
+		if err != nil {
+			return nil, err
+		}
+
+		if original != "" {
+			duplicates = append(duplicates, Duplicate{File: file, Original: original})
+			continue
+		}
+
+		seenBySize[size] = append(seenBySize[size], file.Path)
+	}
+
+	return duplicates, nil
+}
+
+// findOriginal returns the first of others with the same content as the
+// file at path, or "" when there is none.
+func findOriginal(
+	path string,
+	size int64,
+	others []string,
+	hashOf func(path string, size int64) (string, error),
+) (string, error) {
+	if len(others) == 0 {
+		return "", nil
+	}
+
+	hash, err := hashOf(path, size)
+	if err != nil {
+		return "", err
+	}
+
+	for _, other := range others {
+		otherHash, err := hashOf(other, size)
+		if err != nil {
+			return "", err
+		}
+
+		if otherHash == hash {
+			return other, nil
+		}
+	}
+
+	return "", nil
+}
+
+// quickHash hashes the size of the file at path and the first and last
+// quickHashChunk bytes of it, or the whole file when it is smaller.
+func quickHash(path string, size int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n", size)
+
+	if size <= 2*quickHashChunk {
+		_, err = io.Copy(hash, file)
+	} else {
+		_, err = io.Copy(hash, io.NewSectionReader(file, 0, quickHashChunk))
+		if err == nil {
+			_, err = io.Copy(hash, io.NewSectionReader(file, size-quickHashChunk, quickHashChunk))
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,74 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindDuplicatesFlagsCopiesOfPairedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	contents := map[string][]byte{
+		"Show - 01.mkv":        bytes.Repeat([]byte("episode one "), 20000),
+		"Show - 01.srt":        []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"),
+		"Show 01 - copy.mkv":   bytes.Repeat([]byte("episode one "), 20000),
+		"Show Extra.mkv":       bytes.Repeat([]byte("episode two "), 20000),
+		"Show Subtitle.en.srt": []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"),
+	}
+	for name, content := range contents {
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	file := func(name string) FileInfo {
+		return FileInfo{Path: filepath.Join(tempDir, name)}
+	}
+
+	pairs := []FilePair{{Video: file("Show - 01.mkv"), Subtitles: []FileInfo{file("Show - 01.srt")}}}
+	unmatched := []FileInfo{file("Show 01 - copy.mkv"), file("Show Extra.mkv"), file("Show Subtitle.en.srt")}
+
+	duplicates, err := FindDuplicates(pairs, unmatched)
+	if err != nil {
+		t.Fatalf("find duplicates: %v", err)
+	}
+
+	want := map[string]string{
+		"Show 01 - copy.mkv":   "Show - 01.mkv",
+		"Show Subtitle.en.srt": "Show - 01.srt",
+	}
+	if len(duplicates) != len(want) {
+		t.Fatalf("duplicates = %+v, want %v", duplicates, want)
+	}
+
+	for _, duplicate := range duplicates {
+		if want[filepath.Base(duplicate.File.Path)] != filepath.Base(duplicate.Original) {
+			t.Fatalf("%s flagged as a copy of %s, want %v", duplicate.File.Path, duplicate.Original, want)
+		}
+	}
+}
+
+func TestFindDuplicatesComparesCandidatesWithEachOther(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"Show - 03 - copy.mkv", "Show - 03.mkv"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("episode three"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	collision := []FileInfo{
+		{Path: filepath.Join(tempDir, "Show - 03 - copy.mkv")},
+		{Path: filepath.Join(tempDir, "Show - 03.mkv")},
+	}
+
+	duplicates, err := FindDuplicates(nil, collision)
+	if err != nil {
+		t.Fatalf("find duplicates: %v", err)
+	}
+
+	if len(duplicates) != 1 || duplicates[0].File.Path != collision[0].Path || duplicates[0].Original != collision[1].Path {
+		t.Fatalf("duplicates = %+v, want the copy flagged against the original", duplicates)
+	}
+}
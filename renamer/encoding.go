@@ -0,0 +1,134 @@
+package renamer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// TextSubtitleExtensions are the subtitle formats ConvertToUTF8 rewrites.
+// Image based formats like .sub have no text to convert.
+var TextSubtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// IsTextSubtitle reports whether path is a subtitle ConvertToUTF8 handles.
+func IsTextSubtitle(path string) bool {
+	return slices.Contains(TextSubtitleExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// ConvertToUTF8 rewrites a text subtitle in another encoding as UTF-8 and
+// returns the name of the encoding it was in. Files that are already
+// UTF-8 or plain ASCII are left alone and "" is returned. The file is
+// replaced in one step, so a hard link to the original keeps the old
+// content.
+func ConvertToUTF8(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading subtitle %s: %w", path, err)
+	}
+
+	name, textEncoding := detectSubtitleEncoding(data)
+	if textEncoding == nil {
+		return "", nil
+	}
+
+	converted, err := textEncoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("decoding %s as %s: %w", path, name, err)
+	}
+
+	if err := replaceFileContent(path, converted); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// detectSubtitleEncoding guesses the encoding of a subtitle that isn't
+// UTF-8. A byte order mark settles it; otherwise the text is taken for
+// Shift-JIS when it decodes cleanly and holds kana, and for Windows-1252,
+// which accepts any byte, when it doesn't. A nil encoding means the text
+// is UTF-8 already.
+func detectSubtitleEncoding(data []byte) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return "UTF-16LE", textunicode.UTF16(textunicode.LittleEndian, textunicode.ExpectBOM)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return "UTF-16BE", textunicode.UTF16(textunicode.BigEndian, textunicode.ExpectBOM)
+	case utf8.Valid(data):
+		return "", nil
+	}
+
+	if decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data); err == nil && looksJapanese(decoded) {
+		return "Shift-JIS", japanese.ShiftJIS
+	}
+
+	return "Windows-1252", charmap.Windows1252
+}
+
+// looksJapanese rejects Shift-JIS decodings of Latin text, which turn
+// accented letters into half-width katakana or stray kanji but never into
+// hiragana or full-width katakana.
+func looksJapanese(text []byte) bool {
+	hasKana := false
+	for _, char := range string(text) {
+		switch {
+		case char == utf8.RuneError:
+			return false
+		case char >= '\uFF61' && char <= '\uFF9F':
+			return false
+		case unicode.In(char, unicode.Hiragana, unicode.Katakana):
+			hasKana = true
+		}
+	}
+
+	return hasKana
+}
+
+// replaceFileContent writes data next to path and renames it over path,
+// keeping the permissions and modification time of the original.
+func replaceFileContent(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("checking subtitle %s: %w", path, err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".utf8-*"+filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("creating converted subtitle for %s: %w", path, err)
+	}
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(temp.Name(), info.Mode().Perm())
+	}
+
+	if err == nil {
+		err = os.Chtimes(temp.Name(), time.Time{}, info.ModTime())
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("writing converted subtitle %s: %w", path, err)
+	}
+
+	return nil
+}
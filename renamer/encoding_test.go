@@ -0,0 +1,108 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// shiftJISSubtitle is "進撃の巨人、はじまり" in an .srt saved as Shift-JIS.
+const shiftJISSubtitle = "1\n00:00:01,000 --> 00:00:02,000\n" +
+	"\x90i\x8c\x82\x82\xcc\x8b\x90\x90l\x81A\x82\xcd\x82\xb6\x82\xdc\x82\xe8\n"
+
+func TestConvertToUTF8(t *testing.T) {
+	testCases := []struct {
+		name         string
+		content      string
+		wantEncoding string
+		wantContent  string
+	}{
+		{
+			name:         "shift-jis",
+			content:      shiftJISSubtitle,
+			wantEncoding: "Shift-JIS",
+			wantContent:  "1\n00:00:01,000 --> 00:00:02,000\n進撃の巨人、はじまり\n",
+		},
+		{
+			name:         "windows-1252",
+			content:      "1\n00:00:01,000 --> 00:00:02,000\nD\xe9j\xe0 vu, caf\xe9\n",
+			wantEncoding: "Windows-1252",
+			wantContent:  "1\n00:00:01,000 --> 00:00:02,000\nDéjà vu, café\n",
+		},
+		{
+			name:         "utf-16 with byte order mark",
+			content:      "\xff\xfeH\x00i\x00\n\x00",
+			wantEncoding: "UTF-16LE",
+			wantContent:  "Hi\n",
+		},
+		{
+			name:        "utf-8 is left alone",
+			content:     "1\n00:00:01,000 --> 00:00:02,000\n進撃の巨人\n",
+			wantContent: "1\n00:00:01,000 --> 00:00:02,000\n進撃の巨人\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Show - S01E01.srt")
+			if err := os.WriteFile(path, []byte(testCase.content), 0o640); err != nil {
+				t.Fatalf("create subtitle: %v", err)
+			}
+
+			modTime := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+			if err := os.Chtimes(path, time.Time{}, modTime); err != nil {
+				t.Fatalf("set modification time: %v", err)
+			}
+
+			gotEncoding, err := ConvertToUTF8(path)
+			if err != nil {
+				t.Fatalf("convert: %v", err)
+			}
+
+			if gotEncoding != testCase.wantEncoding {
+				t.Fatalf("encoding = %q, want %q", gotEncoding, testCase.wantEncoding)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read subtitle: %v", err)
+			}
+
+			if string(data) != testCase.wantContent {
+				t.Fatalf("content = %q, want %q", data, testCase.wantContent)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat subtitle: %v", err)
+			}
+
+			if !info.ModTime().Equal(modTime) {
+				t.Fatalf("modification time = %v, want %v", info.ModTime(), modTime)
+			}
+		})
+	}
+}
+
+func TestConvertToUTF8KeepsHardLinkedOriginal(t *testing.T) {
+	tempDir := t.TempDir()
+	original := filepath.Join(tempDir, "Show - 01.srt")
+	if err := os.WriteFile(original, []byte(shiftJISSubtitle), 0o600); err != nil {
+		t.Fatalf("create subtitle: %v", err)
+	}
+
+	target := filepath.Join(tempDir, "Anime - S01E01.srt")
+	if err := os.Link(original, target); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	if _, err := ConvertToUTF8(target); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+
+	data, err := os.ReadFile(original)
+	if err != nil || string(data) != shiftJISSubtitle {
+		t.Fatalf("expected the original to keep its Shift-JIS content, got %q (%v)", data, err)
+	}
+}
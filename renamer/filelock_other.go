@@ -0,0 +1,9 @@
+//go:build !windows
+
+package renamer
+
+// checkFileNotInUse has nothing to check outside Windows, where open files
+// can still be renamed.
+func checkFileNotInUse(path string) error {
+	return nil
+}
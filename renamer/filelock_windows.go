@@ -0,0 +1,27 @@
+//go:build windows
+
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const errorSharingViolation syscall.Errno = 32
+
+// checkFileNotInUse catches files another program holds open, like a video
+// that is still playing, which Windows refuses to rename.
+func checkFileNotInUse(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, errorSharingViolation) {
+		return fmt.Errorf("source file is in use by another program: %s", path)
+	}
+
+	if err == nil {
+		file.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package renamer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the file in a scanned folder listing glob patterns, one
+// per line like .gitignore, for files that are never renamed. A pattern
+// matches the base name or the path relative to the folder, and one ending
+// in / matches directories only.
+const IgnoreFileName = ".renamerignore"
+
+type ignorePattern struct {
+	Glob          string
+	DirectoryOnly bool
+}
+
+func loadIgnorePatterns(folderPath string) ([]ignorePattern, error) {
+	ignorePath := filepath.Join(folderPath, IgnoreFileName)
+
+	data, err := os.ReadFile(ignorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading ignore file %s: %w", ignorePath, err)
+	}
+
+	patterns := []ignorePattern{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := ignorePattern{Glob: strings.TrimPrefix(strings.TrimSuffix(line, "/"), "/")}
+		pattern.DirectoryOnly = strings.HasSuffix(line, "/")
+
+		if _, err := path.Match(pattern.Glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %w", line, ignorePath, err)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// ignored reports whether a path, relative to the scanned folder, matches
+// any of the patterns.
+func ignored(patterns []ignorePattern, relativePath string, isDir bool) bool {
+	relativePath = filepath.ToSlash(relativePath)
+
+	for _, pattern := range patterns {
+		if pattern.DirectoryOnly && !isDir {
+			continue
+		}
+
+		if matched, _ := path.Match(pattern.Glob, path.Base(relativePath)); matched {
+			return true
+		}
+
+		if matched, _ := path.Match(pattern.Glob, relativePath); matched {
+			return true
+		}
+	}
+
+	return false
+}
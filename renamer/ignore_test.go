@@ -0,0 +1,87 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindFilesSkipsIgnoredFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	extrasDir := filepath.Join(tempDir, "Extras")
+
+	if err := os.Mkdir(extrasDir, 0o755); err != nil {
+		t.Fatalf("create extras dir: %v", err)
+	}
+
+	ignoreFile := "# never rename these\n*sample*\nNCOP*\n\nExtras/\n"
+	if err := os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte(ignoreFile), 0o600); err != nil {
+		t.Fatalf("create ignore file: %v", err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(tempDir, "Show - 01.mkv"),
+		filepath.Join(tempDir, "Show - 01.srt"),
+		filepath.Join(tempDir, "Show - 01 [sample].mkv"),
+		filepath.Join(tempDir, "Show - 01 [sample].srt"),
+		filepath.Join(tempDir, "NCOP1.mkv"),
+		filepath.Join(tempDir, "NCOP1.ass"),
+		filepath.Join(extrasDir, "Show - 02.mkv"),
+	} {
+		if err := os.WriteFile(path, []byte("file"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	videoFiles, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("find videos: %v", err)
+	}
+
+	subtitleFiles, err := findFiles(tempDir, findOptions{Extensions: SubtitleExtensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("find subtitles: %v", err)
+	}
+
+	if len(videoFiles) != 1 || filepath.Base(videoFiles[0].Path) != "Show - 01.mkv" {
+		t.Fatalf("expected only the episode video, got %+v", videoFiles)
+	}
+
+	if len(subtitleFiles) != 1 || filepath.Base(subtitleFiles[0].Path) != "Show - 01.srt" {
+		t.Fatalf("expected only the episode subtitle, got %+v", subtitleFiles)
+	}
+}
+
+func TestIgnoredMatchesBaseNameAndRelativePath(t *testing.T) {
+	patterns := []ignorePattern{{Glob: "Season 2/*.ass"}, {Glob: "Bonus", DirectoryOnly: true}}
+
+	testCases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: filepath.Join("Season 2", "Show - 01.ass"), want: true},
+		{path: filepath.Join("Season 1", "Show - 01.ass")},
+		{path: "Bonus", isDir: true, want: true},
+		{path: "Bonus"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			if got := ignored(patterns, testCase.path, testCase.isDir); got != testCase.want {
+				t.Fatalf("ignored(%q) = %t, want %t", testCase.path, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestLoadIgnorePatternsRejectsBadPatterns(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte("[sample\n"), 0o600); err != nil {
+		t.Fatalf("create ignore file: %v", err)
+	}
+
+	if _, err := loadIgnorePatterns(tempDir); err == nil {
+		t.Fatal("expected an error for an unterminated character class")
+	}
+}
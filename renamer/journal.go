@@ -0,0 +1,96 @@
+package renamer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const UndoJournalName = ".anime-renamer-undo.json"
+
+type UndoJournal struct {
+	CreatedAt  time.Time         `json:"createdAt"`
+	Operations []RenameOperation `json:"operations"`
+}
+
+func WriteUndoJournal(folderPath string, operations []RenameOperation) error {
+	journal := UndoJournal{
+		CreatedAt:  time.Now(),
+		Operations: []RenameOperation{},
+	}
+
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		oldPath, err := filepath.Abs(operation.OldPath)
+		if err != nil {
+			return fmt.Errorf("resolving journal path %s: %w", operation.OldPath, err)
+		}
+
+		newPath, err := filepath.Abs(operation.NewPath)
+		if err != nil {
+			return fmt.Errorf("resolving journal path %s: %w", operation.NewPath, err)
+		}
+
+		journal.Operations = append(journal.Operations, RenameOperation{OldPath: oldPath, NewPath: newPath})
+	}
+
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding undo journal: %w", err)
+	}
+
+	journalPath := filepath.Join(folderPath, UndoJournalName)
+	if err := os.WriteFile(journalPath, data, 0o644); err != nil {
+		return fmt.Errorf("writing undo journal %s: %w", journalPath, err)
+	}
+
+	return nil
+}
+
+func ReadUndoJournal(folderPath string) (UndoJournal, error) {
+	journalPath := filepath.Join(folderPath, UndoJournalName)
+
+	data, err := os.ReadFile(journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return UndoJournal{}, fmt.Errorf("no undo journal found in %s", folderPath)
+	}
+
+	if err != nil {
+		return UndoJournal{}, fmt.Errorf("reading undo journal %s: %w", journalPath, err)
+	}
+
+	journal := UndoJournal{}
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return UndoJournal{}, fmt.Errorf("decoding undo journal %s: %w", journalPath, err)
+	}
+
+	return journal, nil
+}
+
+func BuildUndoOperations(journal UndoJournal) []RenameOperation {
+	operations := make([]RenameOperation, 0, len(journal.Operations))
+
+	for _, operation := range journal.Operations {
+		operations = append(operations, RenameOperation{
+			OldPath: operation.NewPath,
+			NewPath: operation.OldPath,
+		})
+	}
+
+	return operations
+}
+
+func RemoveUndoJournal(folderPath string) error {
+	journalPath := filepath.Join(folderPath, UndoJournalName)
+	if err := os.Remove(journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing undo journal %s: %w", journalPath, err)
+	}
+
+	return nil
+}
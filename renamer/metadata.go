@@ -0,0 +1,155 @@
+package renamer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// MetadataProvider looks up the episode titles of a season of a show, for
+// the {title} token of files whose names don't hold one. A provider backed
+// by an online episode list, like AniList or TheTVDB, is best wrapped in a
+// CachedProvider so each season is only fetched once.
+type MetadataProvider interface {
+	EpisodeTitles(animeName string, season int) (map[int]string, error)
+}
+
+// TitleList is a MetadataProvider that needs no network: it holds the
+// titles of every season by season and episode, whatever the anime name.
+type TitleList map[int]map[int]string
+
+// EpisodeTitles returns the titles of season.
+func (titles TitleList) EpisodeTitles(_ string, season int) (map[int]string, error) {
+	return titles[season], nil
+}
+
+// LoadTitleList reads a JSON title list like
+// {"1": {"1": "The Beginning", "2": "The Journey"}}, seasons holding
+// episodes.
+func LoadTitleList(path string) (TitleList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading title list %s: %w", path, err)
+	}
+
+	var titles TitleList
+	if err := json.Unmarshal(data, &titles); err != nil {
+		return nil, fmt.Errorf("decoding title list %s: %w", path, err)
+	}
+
+	return titles, nil
+}
+
+// CachedProvider remembers the titles provider returned, in memory and, when
+// Path is set, in a JSON file kept between runs.
+type CachedProvider struct {
+	Provider MetadataProvider
+	Path     string
+
+	mutex  sync.Mutex
+	loaded bool
+	cache  map[string]map[int]string
+}
+
+// EpisodeTitles returns the cached titles of season, asking Provider only
+// for seasons it hasn't returned before.
+func (cached *CachedProvider) EpisodeTitles(animeName string, season int) (map[int]string, error) {
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+
+	if !cached.loaded {
+		if err := cached.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	key := animeName + "|" + strconv.Itoa(season)
+	if titles, ok := cached.cache[key]; ok {
+		return titles, nil
+	}
+
+	titles, err := cached.Provider.EpisodeTitles(animeName, season)
+	if err != nil {
+		return nil, err
+	}
+
+	cached.cache[key] = titles
+	return titles, cached.save()
+}
+
+func (cached *CachedProvider) load() error {
+	cached.cache = map[string]map[int]string{}
+	cached.loaded = true
+	if cached.Path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cached.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading title cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cached.cache); err != nil {
+		return fmt.Errorf("decoding title cache %s: %w", cached.Path, err)
+	}
+
+	return nil
+}
+
+func (cached *CachedProvider) save() error {
+	if cached.Path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cached.cache)
+	if err != nil {
+		return fmt.Errorf("encoding title cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached.Path), 0o755); err != nil {
+		return fmt.Errorf("creating title cache folder: %w", err)
+	}
+
+	if err := os.WriteFile(cached.Path, data, 0o644); err != nil {
+		return fmt.Errorf("writing title cache: %w", err)
+	}
+
+	return nil
+}
+
+// attachProviderTitles gives the pairs without an episode title in their
+// names the title provider has for their episode.
+func attachProviderTitles(pairs []FilePair, animeName string, provider MetadataProvider) ([]FilePair, error) {
+	seasons := map[int]map[int]string{}
+	titled := make([]FilePair, 0, len(pairs))
+
+	for _, pair := range pairs {
+		if pairTitle(pair) != "" || pair.Video.EpisodePart != 0 {
+			titled = append(titled, pair)
+			continue
+		}
+
+		titles, ok := seasons[pair.Video.Season]
+		if !ok {
+			var err error
+			if titles, err = provider.EpisodeTitles(animeName, pair.Video.Season); err != nil {
+				return nil, fmt.Errorf("looking up the titles of season %d: %w", pair.Video.Season, err)
+			}
+
+			seasons[pair.Video.Season] = titles
+		}
+
+		pair.Video.Title = titles[pair.Video.Episode]
+		titled = append(titled, pair)
+	}
+
+	return titled, nil
+}
@@ -0,0 +1,117 @@
+package renamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mockProvider struct {
+	titles TitleList
+	calls  int
+}
+
+func (provider *mockProvider) EpisodeTitles(animeName string, season int) (map[int]string, error) {
+	provider.calls++
+	if animeName != "Anime" {
+		return nil, errors.New("unknown anime")
+	}
+
+	return provider.titles[season], nil
+}
+
+func TestPlanFillsTitlesFromMetadata(t *testing.T) {
+	folder := filepath.Join(string(filepath.Separator), "anime")
+	pairs := []FilePair{
+		{Video: FileInfo{Path: filepath.Join(folder, "Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"}},
+		{Video: FileInfo{Path: filepath.Join(folder, "Show - 02.mkv"), Season: 1, Episode: 2, Extension: ".mkv"}},
+		{
+			Video: FileInfo{
+				Path:      filepath.Join(folder, "Show - 03 - Own Title.mkv"),
+				Season:    1,
+				Episode:   3,
+				Extension: ".mkv",
+				Title:     "Own Title",
+			},
+		},
+		{Video: FileInfo{Path: filepath.Join(folder, "Show - 04.mkv"), Season: 1, Episode: 4, Extension: ".mkv"}},
+	}
+
+	provider := &mockProvider{titles: TitleList{1: {1: "The Beginning", 2: "The Journey", 3: "Listed Title"}}}
+	operations, err := Plan(pairs, PlanOptions{
+		AnimeName: "Anime",
+		Template:  "{name} - S{season}E{episode} - {title}{ext}",
+		Metadata:  provider,
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+
+	want := []string{
+		"Anime - S01E01 - The Beginning.mkv",
+		"Anime - S01E02 - The Journey.mkv",
+		"Anime - S01E03 - Own Title.mkv",
+		"Anime - S01E04.mkv",
+	}
+	if len(operations) != len(want) {
+		t.Fatalf("operations = %+v, want %v", operations, want)
+	}
+
+	for i, operation := range operations {
+		if filepath.Base(operation.NewPath) != want[i] {
+			t.Fatalf("operation %d = %s, want %s", i, filepath.Base(operation.NewPath), want[i])
+		}
+	}
+
+	if provider.calls != 1 {
+		t.Fatalf("provider asked %d times, want once for the one season", provider.calls)
+	}
+
+	if _, err := Plan(pairs, PlanOptions{AnimeName: "Other", Metadata: provider}); err == nil {
+		t.Fatal("expected the provider's error to fail the plan")
+	}
+}
+
+func TestCachedProviderAsksOncePerSeason(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache", "titles.json")
+	provider := &mockProvider{titles: TitleList{1: {1: "The Beginning"}, 2: {1: "The Return"}}}
+	cached := &CachedProvider{Provider: provider, Path: cachePath}
+
+	for _, season := range []int{1, 2, 1, 2} {
+		if _, err := cached.EpisodeTitles("Anime", season); err != nil {
+			t.Fatalf("titles of season %d: %v", season, err)
+		}
+	}
+
+	if provider.calls != 2 {
+		t.Fatalf("provider asked %d times, want 2", provider.calls)
+	}
+
+	// A later run reads the cache file instead of asking again.
+	offline := &mockProvider{}
+	titles, err := (&CachedProvider{Provider: offline, Path: cachePath}).EpisodeTitles("Anime", 2)
+	if err != nil {
+		t.Fatalf("titles from the cache file: %v", err)
+	}
+
+	if titles[1] != "The Return" || offline.calls != 0 {
+		t.Fatalf("titles = %v after %d calls, want the cached season 2", titles, offline.calls)
+	}
+}
+
+func TestLoadTitleList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "titles.json")
+	if err := os.WriteFile(path, []byte(`{"1": {"1": "The Beginning"}, "2": {"3": "The Return"}}`), 0o600); err != nil {
+		t.Fatalf("create title list: %v", err)
+	}
+
+	titles, err := LoadTitleList(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if titles[1][1] != "The Beginning" || titles[2][3] != "The Return" {
+		t.Fatalf("titles = %v", titles)
+	}
+}
@@ -0,0 +1,58 @@
+package renamer
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// WriteMpvScript writes a shell script that plays the pairs in episode
+// order, one mpv command each, with the subtitles loaded through
+// --sub-file. It is for media that can't be renamed, since mpv only finds
+// subtitles on its own when they share the video's name. Paths are made
+// absolute so the script can be run from anywhere.
+func WriteMpvScript(w io.Writer, pairs []FilePair) error {
+	sorted := slices.Clone(pairs)
+	slices.SortStableFunc(sorted, func(a FilePair, b FilePair) int {
+		return cmp.Or(
+			cmp.Compare(a.Video.Season, b.Video.Season),
+			cmp.Compare(a.Video.Episode, b.Video.Episode),
+			cmp.Compare(a.Video.EpisodePart, b.Video.EpisodePart),
+		)
+	})
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n# Plays every episode with its subtitles, written by anime-renamer.\n")
+
+	for _, pair := range sorted {
+		script.WriteString("mpv")
+
+		for _, subtitle := range pair.Subtitles {
+			path, err := filepath.Abs(subtitle.Path)
+			if err != nil {
+				return fmt.Errorf("resolving subtitle path %s: %w", subtitle.Path, err)
+			}
+
+			script.WriteString(" --sub-file=" + shellQuote(path))
+		}
+
+		path, err := filepath.Abs(pair.Video.Path)
+		if err != nil {
+			return fmt.Errorf("resolving video path %s: %w", pair.Video.Path, err)
+		}
+
+		script.WriteString(" -- " + shellQuote(path) + "\n")
+	}
+
+	_, err := io.WriteString(w, script.String())
+	return err
+}
+
+// shellQuote wraps text in single quotes for a POSIX shell, which keeps
+// the spaces, brackets and ampersands of release names as they are.
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
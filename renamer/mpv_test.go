@@ -0,0 +1,38 @@
+package renamer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteMpvScript(t *testing.T) {
+	folder := filepath.Join(string(filepath.Separator), "anime", "Show")
+	pairs := []FilePair{
+		{
+			Video: FileInfo{Path: filepath.Join(folder, "[Group] Show - 02.mkv"), Season: 1, Episode: 2},
+			Subtitles: []FileInfo{
+				{Path: filepath.Join(folder, "Show - 02.en.srt"), Season: 1, Episode: 2},
+				{Path: filepath.Join(folder, "Show - 02.ja.ass"), Season: 1, Episode: 2},
+			},
+		},
+		{
+			Video:     FileInfo{Path: filepath.Join(folder, "[Group] Show - 01.mkv"), Season: 1, Episode: 1},
+			Subtitles: []FileInfo{{Path: filepath.Join(folder, "Show's - 01.srt"), Season: 1, Episode: 1}},
+		},
+	}
+
+	var script strings.Builder
+	if err := WriteMpvScript(&script, pairs); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	want := "#!/bin/sh\n# Plays every episode with its subtitles, written by anime-renamer.\n" +
+		"mpv --sub-file='" + filepath.Join(folder, `Show'\''s - 01.srt`) + "' -- '" +
+		filepath.Join(folder, "[Group] Show - 01.mkv") + "'\n" +
+		"mpv --sub-file='" + filepath.Join(folder, "Show - 02.en.srt") + "' --sub-file='" +
+		filepath.Join(folder, "Show - 02.ja.ass") + "' -- '" + filepath.Join(folder, "[Group] Show - 02.mkv") + "'\n"
+	if script.String() != want {
+		t.Fatalf("script =\n%s\nwant\n%s", script.String(), want)
+	}
+}
@@ -0,0 +1,374 @@
+package renamer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var bracketedTagPattern = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+
+var trailingCRCPattern = regexp.MustCompile(`[\s_.-]+[0-9A-Fa-f]{8}$`)
+
+var ReleaseNoiseTokens = []string{
+	"480p", "576p", "720p", "1080p", "2160p", "4k",
+	"x264", "x265", "h264", "h.264", "h265", "h.265", "hevc", "avc", "10bit",
+	"aac", "flac", "opus", "web-dl", "webrip", "bdrip", "bluray",
+}
+
+var seasonFolderPattern = regexp.MustCompile(`(?i)^(?:season|s)\s*\d+$`)
+
+// The cases ApplyNameCase can give an anime name. NameCaseAsIs keeps it
+// as it was entered.
+const (
+	NameCaseAsIs  = "asis"
+	NameCaseLower = "lower"
+	NameCaseUpper = "upper"
+	NameCaseTitle = "title"
+)
+
+var NameCases = []string{NameCaseAsIs, NameCaseLower, NameCaseUpper, NameCaseTitle}
+
+// smallTitleWords stay lowercase in title case unless they start or end the
+// name or follow a colon.
+var smallTitleWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true, "by": true, "for": true,
+	"in": true, "no": true, "nor": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+	"vs": true, "wa": true, "with": true,
+}
+
+// ApplyNameCase gives animeName the case nameCase, one of NameCases, so
+// names entered as "my hero academia" or "MY HERO ACADEMIA" come out the
+// same. An empty nameCase keeps the name as it is.
+func ApplyNameCase(animeName string, nameCase string) (string, error) {
+	switch nameCase {
+	case "", NameCaseAsIs:
+		return animeName, nil
+	case NameCaseLower:
+		return strings.ToLower(animeName), nil
+	case NameCaseUpper:
+		return strings.ToUpper(animeName), nil
+	case NameCaseTitle:
+		return titleCase(animeName), nil
+	default:
+		return "", fmt.Errorf("unknown name case %q, expected one of %s", nameCase, strings.Join(NameCases, ", "))
+	}
+}
+
+func titleCase(name string) string {
+	words := strings.Split(strings.ToLower(name), " ")
+	last := len(words) - 1
+	for last > 0 && words[last] == "" {
+		last--
+	}
+
+	afterColon := true
+	for i, word := range words {
+		if word == "" {
+			continue
+		}
+
+		if afterColon || i == last || !smallTitleWords[word] {
+			first, size := utf8.DecodeRuneInString(word)
+			words[i] = string(unicode.ToTitle(first)) + word[size:]
+		}
+
+		afterColon = strings.HasSuffix(word, ":")
+	}
+
+	return strings.Join(words, " ")
+}
+
+// InferAnimeName guesses the show title from the text in front of the episode
+// token, picking the title most of the files agree on. It falls back to the
+// folder name when the files don't yield one. patterns are the episode
+// patterns the files were scanned with, ScanResult.Patterns, or the built-in
+// ones when nil.
+func InferAnimeName(files []FileInfo, folderPath string, noiseTokens []string, patterns []*regexp.Regexp) string {
+	if len(patterns) == 0 {
+		patterns = episodePatterns
+	}
+
+	counts := map[string]int{}
+	bestName := ""
+
+	for _, file := range files {
+		name := titleBeforeEpisode(filepath.Base(file.Path), noiseTokens, patterns)
+		if name == "" {
+			continue
+		}
+
+		counts[name]++
+		if counts[name] > counts[bestName] || (counts[name] == counts[bestName] && name < bestName) {
+			bestName = name
+		}
+	}
+
+	if bestName != "" {
+		return bestName
+	}
+
+	folderName := filepath.Base(filepath.Clean(folderPath))
+	if seasonFolderPattern.MatchString(folderName) {
+		folderName = filepath.Base(filepath.Dir(filepath.Clean(folderPath)))
+	}
+
+	if folderName == "." || folderName == string(filepath.Separator) {
+		return ""
+	}
+
+	return stripReleaseNoise(folderName, noiseTokens)
+}
+
+// ShowGroup holds the videos and subtitles of one show in a folder.
+type ShowGroup struct {
+	Videos    []FileInfo
+	Subtitles []FileInfo
+}
+
+// groupByShow splits the files of a folder holding several shows by the
+// name in front of the episode token, so episodes only pair within a show.
+// The files are only split when at least two shows have both videos and
+// subtitles and share an episode number. Otherwise a subtitle release named
+// differently from its videos, or new episodes next to already renamed
+// ones, would be torn apart, so one group holds everything.
+func groupByShow(
+	videoFiles []FileInfo,
+	subtitleFiles []FileInfo,
+	noiseTokens []string,
+	patterns []*regexp.Regexp,
+) []ShowGroup {
+	keys := []string{}
+	groups := map[string]*ShowGroup{}
+	group := func(file FileInfo) *ShowGroup {
+		key := showKey(filepath.Base(file.Path), noiseTokens, patterns)
+		if groups[key] == nil {
+			keys = append(keys, key)
+			groups[key] = &ShowGroup{}
+		}
+
+		return groups[key]
+	}
+
+	for _, file := range videoFiles {
+		showGroup := group(file)
+		showGroup.Videos = append(showGroup.Videos, file)
+	}
+
+	for _, file := range subtitleFiles {
+		showGroup := group(file)
+		showGroup.Subtitles = append(showGroup.Subtitles, file)
+	}
+
+	complete := 0
+	overlapping := false
+	episodeShows := map[episodeKey]string{}
+	for _, key := range keys {
+		if len(groups[key].Videos) > 0 && len(groups[key].Subtitles) > 0 {
+			complete++
+		}
+
+		for _, file := range groups[key].Videos {
+			show, seen := episodeShows[fileEpisodeKey(file)]
+			overlapping = overlapping || (seen && show != key)
+			episodeShows[fileEpisodeKey(file)] = key
+		}
+	}
+
+	if complete < 2 || !overlapping {
+		return []ShowGroup{{Videos: videoFiles, Subtitles: subtitleFiles}}
+	}
+
+	showGroups := make([]ShowGroup, 0, len(keys))
+	for _, key := range keys {
+		showGroups = append(showGroups, *groups[key])
+	}
+
+	return showGroups
+}
+
+// showKey normalizes the show name of a file so "Show.Name" and "show name"
+// end up in the same group.
+func showKey(filename string, noiseTokens []string, patterns []*regexp.Regexp) string {
+	title := titleBeforeEpisode(filename, noiseTokens, patterns)
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	return strings.Join(words, " ")
+}
+
+// NormalizeWidth turns full-width ASCII, like the digits in "Show ０１" or
+// "Ｓ０２Ｅ０３", into plain ASCII and ideographic spaces into spaces, since
+// the episode patterns only know ASCII digits and spaces.
+func NormalizeWidth(text string) string {
+	return strings.Map(func(char rune) rune {
+		switch {
+		case char >= '\uFF01' && char <= '\uFF5E':
+			return char - 0xFEE0
+		case char == '\u3000':
+			return ' '
+		default:
+			return char
+		}
+	}, text)
+}
+
+func titleBeforeEpisode(filename string, noiseTokens []string, patterns []*regexp.Regexp) string {
+	name, _, _ := splitSubtitleTags(NormalizeWidth(filename))
+	name = strings.TrimSuffix(CleanFilename(name, noiseTokens), filepath.Ext(name))
+	searchName := maskNumberNoise(name)
+
+	cut := -1
+	if location := specialPattern.FindStringIndex(searchName); location != nil {
+		cut = location[0]
+	} else {
+		for _, pattern := range patterns {
+			if location := pattern.FindStringIndex(searchName); location != nil {
+				cut = location[0]
+				break
+			}
+		}
+	}
+
+	if cut < 0 {
+		return ""
+	}
+
+	title := courPattern.ReplaceAllString(name[:cut], "")
+	return strings.Trim(strings.Join(strings.Fields(title), " "), " -_.")
+}
+
+// titleAfterEpisode returns the episode title that follows the episode token,
+// like "The Beginning" in "Show - 01 - The Beginning [1080p].mkv".
+func titleAfterEpisode(filename string, noiseTokens []string, patterns []*regexp.Regexp) string {
+	name, _, _ := splitSubtitleTags(NormalizeWidth(filename))
+	name = strings.TrimSuffix(CleanFilename(name, noiseTokens), filepath.Ext(name))
+
+	searchName := maskNumberNoise(name)
+
+	end := -1
+	if location := specialPattern.FindStringIndex(searchName); location != nil {
+		end = location[1]
+	} else {
+		for _, pattern := range patterns {
+			if location := pattern.FindStringIndex(searchName); location != nil {
+				end = location[1]
+				break
+			}
+		}
+	}
+
+	if end < 0 {
+		return ""
+	}
+
+	rest := name[end:]
+	if location := episodeRangePattern.FindStringIndex(rest); location != nil {
+		rest = rest[location[1]:]
+	}
+
+	if location := versionPattern.FindStringIndex(rest); location != nil {
+		rest = rest[location[1]:]
+	}
+
+	return stripReleaseNoise(rest, noiseTokens)
+}
+
+func attachEpisodeTitles(files []FileInfo, noiseTokens []string, patterns []*regexp.Regexp) []FileInfo {
+	titled := make([]FileInfo, 0, len(files))
+
+	for _, file := range files {
+		file.Title = titleAfterEpisode(filepath.Base(file.Path), noiseTokens, patterns)
+		titled = append(titled, file)
+	}
+
+	return titled
+}
+
+// nameSimilarity scores two names from 0 to 1 by their edit distance
+// relative to the longer name.
+func nameSimilarity(a string, b string) float64 {
+	longest := max(len([]rune(a)), len([]rune(b)))
+	if longest == 0 {
+		return 0
+	}
+
+	return 1 - float64(levenshteinDistance(a, b))/float64(longest)
+}
+
+func levenshteinDistance(a string, b string) int {
+	first := []rune(a)
+	second := []rune(b)
+
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for index := range previous {
+		previous[index] = index
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(second)]
+}
+
+// CleanFilename strips release noise such as [Group] tags, (1080p) style
+// parentheticals, resolution and codec tokens and trailing CRC32 hashes,
+// keeping the extension.
+func CleanFilename(filename string, noiseTokens []string) string {
+	extension := filepath.Ext(filename)
+	name := strings.TrimSuffix(filename, extension)
+
+	// Scene releases separate words with dots or underscores instead of spaces.
+	if !strings.Contains(name, " ") {
+		name = strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	}
+
+	cleaned := stripReleaseNoise(name, noiseTokens)
+	if cleaned == "" {
+		return filename
+	}
+
+	return cleaned + extension
+}
+
+func stripReleaseNoise(name string, noiseTokens []string) string {
+	name = bracketedTagPattern.ReplaceAllString(name, " ")
+
+	if pattern := noiseTokenPattern(noiseTokens); pattern != nil {
+		name = pattern.ReplaceAllString(name, " ")
+	}
+
+	name = strings.Join(strings.Fields(name), " ")
+	name = trailingCRCPattern.ReplaceAllString(name, "")
+
+	return strings.Trim(name, " -_.")
+}
+
+func noiseTokenPattern(noiseTokens []string) *regexp.Regexp {
+	if len(noiseTokens) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, 0, len(noiseTokens))
+	for _, token := range noiseTokens {
+		quoted = append(quoted, regexp.QuoteMeta(token))
+	}
+
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
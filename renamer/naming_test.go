@@ -0,0 +1,233 @@
+package renamer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInferAnimeName(t *testing.T) {
+	testCases := []struct {
+		name       string
+		filenames  []string
+		folderPath string
+		want       string
+	}{
+		{
+			name: "fansub tags and resolution",
+			filenames: []string{
+				"[HorribleSubs] Attack on Titan - 01 [1080p].mkv",
+				"[HorribleSubs] Attack on Titan - 02 [1080p].mkv",
+			},
+			folderPath: "downloads",
+			want:       "Attack on Titan",
+		},
+		{
+			name:       "crc hash and parenthesized quality",
+			filenames:  []string{"[SubsPlease] Frieren - 01 (1080p) [ABCD1234].mkv"},
+			folderPath: "downloads",
+			want:       "Frieren",
+		},
+		{
+			name:       "dotted scene name",
+			filenames:  []string{"Show.Name.S01E01.1080p.x264.mkv"},
+			folderPath: "downloads",
+			want:       "Show Name",
+		},
+		{
+			name:       "split season part",
+			filenames:  []string{"Show Part 2 - 03.mkv"},
+			folderPath: "downloads",
+			want:       "Show",
+		},
+		{
+			name:       "number in the title",
+			filenames:  []string{"Mob Psycho 100 - 01.mkv"},
+			folderPath: "downloads",
+			want:       "Mob Psycho 100",
+		},
+		{
+			name:       "folder fallback",
+			filenames:  []string{"01.mkv"},
+			folderPath: filepath.Join("anime", "Attack on Titan"),
+			want:       "Attack on Titan",
+		},
+		{
+			name:       "season folder falls back to show folder",
+			filenames:  nil,
+			folderPath: filepath.Join("anime", "Attack on Titan", "Season 2"),
+			want:       "Attack on Titan",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			files := []FileInfo{}
+			for _, filename := range testCase.filenames {
+				files = append(files, FileInfo{Path: filepath.Join(testCase.folderPath, filename)})
+			}
+
+			if got := InferAnimeName(files, testCase.folderPath, ReleaseNoiseTokens, nil); got != testCase.want {
+				t.Fatalf("InferAnimeName(%v) = %q, want %q", testCase.filenames, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestGroupByShow(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "[Group] Alpha Show - 01 [1080p].mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+		{Path: "Beta.Show.S01E01.mkv", Season: 1, Episode: 1, HasSeason: true, Extension: ".mkv"},
+		{Path: "[Group] Alpha Show - 02 [1080p].mkv", Season: 1, Episode: 2, Extension: ".mkv"},
+		{Path: "Beta.Show.S01E02.mkv", Season: 1, Episode: 2, HasSeason: true, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: "Alpha Show - 01.srt", Season: 1, Episode: 1, Extension: ".srt"},
+		{Path: "Beta Show - 01.srt", Season: 1, Episode: 1, Extension: ".srt"},
+		{Path: "Alpha Show - 02.srt", Season: 1, Episode: 2, Extension: ".srt"},
+		{Path: "Beta Show - 02.srt", Season: 1, Episode: 2, Extension: ".srt"},
+	}
+
+	groups := groupByShow(videoFiles, subtitleFiles, ReleaseNoiseTokens, episodePatterns)
+	if len(groups) != 2 {
+		t.Fatalf("expected two shows, got %+v", groups)
+	}
+
+	for _, group := range groups {
+		pairs, unmatched := createFilePairs(group.Videos, group.Subtitles)
+		if len(pairs) != 2 || len(unmatched) != 0 {
+			t.Fatalf("expected both episodes to pair within the show, got %+v and %+v", pairs, unmatched)
+		}
+
+		for _, pair := range pairs {
+			videoShow := showKey(pair.Video.Path, ReleaseNoiseTokens, episodePatterns)
+			subtitleShow := showKey(pair.Subtitles[0].Path, ReleaseNoiseTokens, episodePatterns)
+			if videoShow != subtitleShow {
+				t.Fatalf("paired %s with %s across shows", pair.Video.Path, pair.Subtitles[0].Path)
+			}
+		}
+	}
+
+	// New episodes next to already renamed ones stay together, since the
+	// two names never share an episode.
+	groups = groupByShow(
+		[]FileInfo{videoFiles[0], {Path: "Alpha - S01E03.mkv", Season: 1, Episode: 3, Extension: ".mkv"}},
+		[]FileInfo{subtitleFiles[0], {Path: "Alpha - S01E03.srt", Season: 1, Episode: 3, Extension: ".srt"}},
+		ReleaseNoiseTokens,
+		episodePatterns,
+	)
+	if len(groups) != 1 {
+		t.Fatalf("expected a single group for a folder renamed before, got %+v", groups)
+	}
+
+	// Subtitles named after another title than the videos stay together
+	// with them, since only one "show" has both kinds of files.
+	subtitle := FileInfo{Path: "Alpha no Show - 01.srt", Episode: 1}
+	groups = groupByShow(videoFiles[:1], []FileInfo{subtitle}, ReleaseNoiseTokens, episodePatterns)
+	if len(groups) != 1 || len(groups[0].Videos) != 1 || len(groups[0].Subtitles) != 1 {
+		t.Fatalf("expected a single group, got %+v", groups)
+	}
+}
+
+func TestTitleAfterEpisode(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "Show - 01 - The Beginning.mkv", want: "The Beginning"},
+		{filename: "[Group] Show - 02 - Rise [1080p][ABCD1234].mkv", want: "Rise"},
+		{filename: "Show.S01E03.The.End.1080p.WEB-DL.mkv", want: "The End"},
+		{filename: "Show - 04 - Farewell.en.srt", want: "Farewell"},
+		{filename: "Show - 05-06 - Double Feature.mkv", want: "Double Feature"},
+		{filename: "Show - 07 [1080p].mkv", want: ""},
+		{filename: "Show - 08.mkv", want: ""},
+		{filename: "Show (2023) - 09 - New Year.mkv", want: "New Year"},
+		{filename: "Show - 2nd Season - 10 - Homecoming.mkv", want: "Homecoming"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			if got := titleAfterEpisode(testCase.filename, ReleaseNoiseTokens, episodePatterns); got != testCase.want {
+				t.Fatalf("titleAfterEpisode(%q) = %q, want %q", testCase.filename, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if got := levenshteinDistance("kitten", "sitting"); got != 3 {
+		t.Fatalf("levenshteinDistance(kitten, sitting) = %d, want 3", got)
+	}
+
+	if got := nameSimilarity("show - 05 - jupiter jazz", "show - 17 - jupiter jazz"); got < similarNameThreshold {
+		t.Fatalf("expected renumbered names to be similar, got %.2f", got)
+	}
+
+	if got := nameSimilarity("show - 06 - ganymede elegy", "completely different release 18"); got >= similarNameThreshold {
+		t.Fatalf("expected unrelated names to be dissimilar, got %.2f", got)
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "[SubsPlease] Frieren - 01 (1080p) [ABCD1234].mkv", want: "Frieren - 01.mkv"},
+		{filename: "[Erai-raws] Spy x Family - 05 [720p][HEVC][Multiple Subtitle].mkv", want: "Spy x Family - 05.mkv"},
+		{filename: "Show.Name.S01E02.1080p.WEB-DL.x264.mkv", want: "Show Name S01E02.mkv"},
+		{filename: "Show - 03 2160p HEVC 1A2B3C4D.ass", want: "Show - 03.ass"},
+		{filename: "Plain Show - 04.srt", want: "Plain Show - 04.srt"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			if got := CleanFilename(testCase.filename, ReleaseNoiseTokens); got != testCase.want {
+				t.Fatalf("CleanFilename(%q) = %q, want %q", testCase.filename, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestCleanFilenameUsesGivenTokens(t *testing.T) {
+	got := CleanFilename("Show - 01 REMUX 1080p.mkv", []string{"remux"})
+	if got != "Show - 01 1080p.mkv" {
+		t.Fatalf("expected only the configured token to be removed, got %q", got)
+	}
+}
+
+func TestApplyNameCase(t *testing.T) {
+	testCases := []struct {
+		nameCase string
+		want     string
+	}{
+		{nameCase: NameCaseAsIs, want: "attack ON titan: the war OF the worlds"},
+		{nameCase: NameCaseLower, want: "attack on titan: the war of the worlds"},
+		{nameCase: NameCaseUpper, want: "ATTACK ON TITAN: THE WAR OF THE WORLDS"},
+		{nameCase: NameCaseTitle, want: "Attack on Titan: The War of the Worlds"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.nameCase, func(t *testing.T) {
+			got, err := ApplyNameCase("attack ON titan: the war OF the worlds", testCase.nameCase)
+			if err != nil {
+				t.Fatalf("apply case: %v", err)
+			}
+
+			if got != testCase.want {
+				t.Fatalf("ApplyNameCase(%q) = %q, want %q", testCase.nameCase, got, testCase.want)
+			}
+		})
+	}
+
+	if got, _ := ApplyNameCase("the world god only knows", NameCaseTitle); got != "The World God Only Knows" {
+		t.Fatalf("title case = %q, want the first word capitalized", got)
+	}
+
+	if got, _ := ApplyNameCase("what are you looking at", NameCaseTitle); got != "What Are You Looking At" {
+		t.Fatalf("title case = %q, want the last word capitalized", got)
+	}
+
+	if _, err := ApplyNameCase("Show", "snake"); err == nil {
+		t.Fatal("expected an error for an unknown case")
+	}
+}
@@ -0,0 +1,78 @@
+package renamer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// UnmatchedDirName is the folder orphaned subtitles are moved into, inside
+// the scanned folder. Scans skip it.
+const UnmatchedDirName = "unmatched"
+
+// OrphanOperations plans moving subtitles that matched no video, together
+// with companions like the .idx of a .sub, into the UnmatchedDirName
+// folder of folder. Subtitles inside folder keep their relative path there
+// and others only their name. A name already taken there, say by an orphan
+// of an earlier run, gets a number, like "Show - 07 (2).en.srt".
+func OrphanOperations(folder string, subtitles []FileInfo) []RenameOperation {
+	unmatchedDir := filepath.Join(folder, UnmatchedDirName)
+	taken := map[string]bool{}
+
+	operations := []RenameOperation{}
+	for _, subtitle := range subtitles {
+		paths := append([]string{subtitle.Path}, subtitle.Companions...)
+		targets := make([]string, len(paths))
+		for i, path := range paths {
+			target := filepath.Base(path)
+			if relativePath, err := filepath.Rel(folder, path); err == nil && !strings.HasPrefix(relativePath, "..") {
+				target = relativePath
+			}
+
+			targets[i] = filepath.Join(unmatchedDir, target)
+		}
+
+		numbered := slices.Clone(targets)
+		for copyNumber := 2; orphanTargetsTaken(numbered, taken); copyNumber++ {
+			for i, target := range targets {
+				numbered[i] = numberedOrphanTarget(target, subtitleTagSuffix(subtitle), copyNumber)
+			}
+		}
+
+		for i, path := range paths {
+			taken[numbered[i]] = true
+			operations = append(operations, RenameOperation{OldPath: path, NewPath: numbered[i]})
+		}
+	}
+
+	return operations
+}
+
+// numberedOrphanTarget puts copyNumber in front of the extension and the
+// subtitle tags of target.
+func numberedOrphanTarget(target string, tags string, copyNumber int) string {
+	extension := filepath.Ext(target)
+	stem := strings.TrimSuffix(target, extension)
+	if len(stem) > len(tags) && strings.EqualFold(stem[len(stem)-len(tags):], tags) {
+		tags = stem[len(stem)-len(tags):]
+		stem = stem[:len(stem)-len(tags)]
+	} else {
+		tags = ""
+	}
+
+	return fmt.Sprintf("%s (%d)%s%s", stem, copyNumber, tags, extension)
+}
+
+// orphanTargetsTaken reports whether any of targets already exists or is
+// the target of another orphan.
+func orphanTargetsTaken(targets []string, taken map[string]bool) bool {
+	for _, target := range targets {
+		if _, err := os.Lstat(target); err == nil || taken[target] {
+			return true
+		}
+	}
+
+	return false
+}
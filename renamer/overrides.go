@@ -0,0 +1,154 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EpisodeOverride is the season and episode a mapping file gives a file,
+// taken instead of whatever its name parses as.
+type EpisodeOverride struct {
+	Season  int `json:"season"`
+	Episode int `json:"episode"`
+}
+
+// Overrides maps a file name, or a path relative to the scanned folder, to
+// the episode it holds.
+type Overrides map[string]EpisodeOverride
+
+// LoadOverrides reads a mapping file for folders auto-detection gets wrong.
+// A .json file holds an object like {"Show 01.mkv": {"season": 1,
+// "episode": 5}}, with both keys required; any other file is read as CSV
+// with the columns name, season and episode, an optional header line and #
+// comments.
+func LoadOverrides(path string) (Overrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mapping file %s: %w", path, err)
+	}
+
+	var overrides Overrides
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		overrides, err = parseOverridesJSON(data)
+	} else {
+		overrides, err = parseOverridesCSV(data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing mapping file %s: %w", path, err)
+	}
+
+	for name, override := range overrides {
+		if override.Episode < 0 || override.Season < 0 {
+			return nil, fmt.Errorf(
+				"mapping file %s gives %s season %d episode %d, want a season and an episode of 0 or more",
+				path,
+				name,
+				override.Season,
+				override.Episode,
+			)
+		}
+	}
+
+	return overrides, nil
+}
+
+// parseOverridesJSON reads a JSON mapping file. Every file needs both a
+// season and an episode, since 0 is a valid value of each and a missing key
+// mustn't quietly read as one.
+func parseOverridesJSON(data []byte) (Overrides, error) {
+	var entries map[string]struct {
+		Season  *int `json:"season"`
+		Episode *int `json:"episode"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	overrides := make(Overrides, len(entries))
+	for name, entry := range entries {
+		if entry.Season == nil || entry.Episode == nil {
+			return nil, fmt.Errorf("%s needs both a \"season\" and an \"episode\"", name)
+		}
+
+		overrides[name] = EpisodeOverride{Season: *entry.Season, Episode: *entry.Episode}
+	}
+
+	return overrides, nil
+}
+
+func parseOverridesCSV(data []byte) (Overrides, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	overrides := Overrides{}
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return overrides, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		season, seasonErr := strconv.Atoi(strings.TrimSpace(record[1]))
+		episode, episodeErr := strconv.Atoi(strings.TrimSpace(record[2]))
+		if seasonErr != nil || episodeErr != nil {
+			if first {
+				continue
+			}
+
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: season and episode must be numbers, got %q and %q", line, record[1], record[2])
+		}
+
+		overrides[strings.TrimSpace(record[0])] = EpisodeOverride{Season: season, Episode: episode}
+	}
+}
+
+// lookup finds the override for path, by its path relative to folderPath
+// first and by its base name otherwise.
+func (overrides Overrides) lookup(folderPath string, path string) (EpisodeOverride, bool) {
+	if relativePath, err := filepath.Rel(folderPath, path); err == nil {
+		if override, ok := overrides[filepath.ToSlash(relativePath)]; ok {
+			return override, true
+		}
+	}
+
+	override, ok := overrides[filepath.Base(path)]
+	return override, ok
+}
+
+// overriddenFileInfo builds the FileInfo of a file listed in a mapping
+// file. Only the extension and subtitle tags still come from its name.
+func overriddenFileInfo(
+	path string,
+	extensionSet map[string]struct{},
+	subtitleExtensions []string,
+	override EpisodeOverride,
+) (FileInfo, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, exists := extensionSet[ext]; !exists {
+		return FileInfo{}, false
+	}
+
+	file := FileInfo{Path: path, Season: override.Season, Episode: override.Episode, Extension: ext, HasSeason: true}
+	if slices.Contains(subtitleExtensions, ext) {
+		_, file.Language, file.Qualifiers = splitSubtitleTags(NormalizeWidth(filepath.Base(path)))
+	}
+
+	Debugf("%s: season %d, episode %d from the mapping file\n", path, file.Season, file.Episode)
+	return file, true
+}
@@ -0,0 +1,150 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		want    Overrides
+		wantErr string
+	}{
+		{
+			name:    "csv with header and comments",
+			file:    "map.csv",
+			content: "name,season,episode\n# the pilot aired last\n\"Show, Pilot.mkv\", 1, 13\nSeason 2/Ep A.ass,2,1\n",
+			want: Overrides{
+				"Show, Pilot.mkv":   {Season: 1, Episode: 13},
+				"Season 2/Ep A.ass": {Season: 2, Episode: 1},
+			},
+		},
+		{
+			name:    "json",
+			file:    "map.json",
+			content: `{"Show OVA.mkv": {"season": 0, "episode": 2}}`,
+			want:    Overrides{"Show OVA.mkv": {Season: 0, Episode: 2}},
+		},
+		{
+			name:    "csv with a bad number",
+			file:    "map.csv",
+			content: "Show A.mkv,1,5\nShow B.mkv,1,five\n",
+			wantErr: "line 2",
+		},
+		{
+			name:    "episode zero",
+			file:    "map.csv",
+			content: "Show Prologue.mkv,1,0\n",
+			want:    Overrides{"Show Prologue.mkv": {Season: 1, Episode: 0}},
+		},
+		{
+			name:    "json without a season",
+			file:    "map.json",
+			content: `{"Show A.mkv": {"episode": 5}}`,
+			wantErr: `Show A.mkv needs both a "season" and an "episode"`,
+		},
+		{
+			name:    "json without an episode",
+			file:    "map.json",
+			content: `{"Show A.mkv": {"season": 1}}`,
+			wantErr: `Show A.mkv needs both a "season" and an "episode"`,
+		},
+		{
+			name:    "negative episode",
+			file:    "map.json",
+			content: `{"Show A.mkv": {"season": 1, "episode": -1}}`,
+			wantErr: "episode of 0 or more",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), testCase.file)
+			if err := os.WriteFile(path, []byte(testCase.content), 0o600); err != nil {
+				t.Fatalf("create mapping file: %v", err)
+			}
+
+			overrides, err := LoadOverrides(path)
+			if testCase.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, testCase.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if len(overrides) != len(testCase.want) {
+				t.Fatalf("overrides = %v, want %v", overrides, testCase.want)
+			}
+
+			for name, want := range testCase.want {
+				if overrides[name] != want {
+					t.Fatalf("override of %q = %+v, want %+v", name, overrides[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestScanPrefersOverridesOverParsedEpisodes(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "Extra"), 0o755); err != nil {
+		t.Fatalf("create extra folder: %v", err)
+	}
+
+	createSourceFiles(
+		t,
+		tempDir,
+		"Show - 01.mkv",
+		"Show - 01.en.srt",
+		"Show - 02.mkv",
+		"Show Ep A.mkv",
+		filepath.Join("Extra", "Show - 02.srt"),
+	)
+
+	result, err := Scan(tempDir, ScanOptions{
+		Recursive: true,
+		Overrides: Overrides{
+			"Show - 01.mkv":             {Season: 1, Episode: 4},
+			"Show - 01.en.srt":          {Season: 1, Episode: 4},
+			"Show Ep A.mkv":             {Season: 0, Episode: 1},
+			"Extra/Show - 02.srt":       {Season: 1, Episode: 3},
+			"Not in the folder - 9.mkv": {Season: 1, Episode: 9},
+		},
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, file := range append(result.Videos, result.Subtitles...) {
+		relativePath, _ := filepath.Rel(tempDir, file.Path)
+		got[filepath.ToSlash(relativePath)] = FormatEpisodeLabel(file) + " " + file.Language
+	}
+
+	want := map[string]string{
+		"Show - 01.mkv":       "S01E04 ",
+		"Show - 01.en.srt":    "S01E04 en",
+		"Show - 02.mkv":       "S01E02 ",
+		"Show Ep A.mkv":       "S00E01 ",
+		"Extra/Show - 02.srt": "S01E03 ",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	for path, label := range want {
+		if got[path] != label {
+			t.Fatalf("%s = %q, want %q (all: %v)", path, got[path], label, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package renamer
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// NameParse explains how a single file name is read, for checking names
+// without scanning a folder.
+type NameParse struct {
+	FileInfo
+
+	// Pattern is the position of the episode pattern that matched in the
+	// search order, counting from 1, and Expression is its regular
+	// expression. PatternName names it, like "dash", or "custom" followed by
+	// the expression for a pattern of the config file. Pattern is 0 when
+	// none matched, or for specials, which Special marks instead.
+	Pattern     int
+	PatternName string
+	Expression  string
+	Special     bool
+
+	// Extra labels a creditless opening or ending, like "NCOP1", which is
+	// skipped rather than renamed.
+	Extra string
+
+	found bool
+}
+
+// Found reports whether an episode number was found, which may be 0.
+func (parse NameParse) Found() bool {
+	return parse.Extra == "" && parse.found
+}
+
+// ParseName reads the season and episode of path the way Scan does,
+// including the season of the folders in it. Only the episode patterns of
+// options are used.
+func ParseName(path string, options ScanOptions) (NameParse, error) {
+	patterns, err := scanEpisodePatterns(options)
+	if err != nil {
+		return NameParse{}, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	parse := NameParse{FileInfo: FileInfo{Path: path, Extension: ext}}
+
+	baseName := NormalizeWidth(filepath.Base(path))
+	if slices.Contains(orDefault(options.SubtitleExtensions, SubtitleExtensions), ext) {
+		baseName, parse.Language, parse.Qualifiers = splitSubtitleTags(baseName)
+	}
+
+	if extra, ok := classifyExtra(baseName); ok {
+		parse.Extra = extra
+		return parse, nil
+	}
+
+	match, pattern := matchEpisode(baseName, patterns)
+	if pattern != 0 && !match.HasSeason {
+		match.Season, match.HasSeason = seasonFromDirectory(filepath.Dir(path), "")
+		if !match.HasSeason {
+			match.Season = 1
+		}
+	}
+
+	parse.Season = match.Season
+	parse.Episode = match.Episode
+	parse.EpisodePart = match.EpisodePart
+	parse.EpisodeEnd = match.EpisodeEnd
+	parse.Cour = match.Cour
+	parse.Version = match.Version
+	parse.HasSeason = match.HasSeason
+	parse.FinalSeason = match.FinalSeason && !match.HasSeason
+	parse.found = pattern != 0
+	parse.Special = pattern == specialMatch
+	if pattern > 0 {
+		parse.Pattern = pattern
+		parse.PatternName = episodePatternName(patterns, pattern)
+		parse.Expression = patterns[pattern-1].String()
+	}
+
+	return parse, nil
+}
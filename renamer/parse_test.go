@@ -0,0 +1,85 @@
+package renamer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseName(t *testing.T) {
+	testCases := []struct {
+		path        string
+		wantLabel   string
+		wantPattern int
+		wantSpecial bool
+		wantExtra   string
+	}{
+		{path: "Show S2 - 03.mkv", wantLabel: "S02E03", wantPattern: 1},
+		{path: "Show E09.en.srt", wantLabel: "S01E09", wantPattern: 3},
+		{path: filepath.Join("Show", "Season 3", "Show - 04.mkv"), wantLabel: "S03E04", wantPattern: 4},
+		{path: "Show #05.mkv", wantLabel: "S01E05", wantPattern: 6},
+		{path: "Show 1080p 05.mkv", wantLabel: "S01E05", wantPattern: 8},
+		{path: "Show OVA 01.mkv", wantLabel: "S00E01", wantSpecial: true},
+		{path: "NCED2.mkv", wantExtra: "NCED2"},
+		{path: "Pilot.mkv"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			parse, err := ParseName(testCase.path, ScanOptions{})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			label := ""
+			if parse.Found() {
+				label = FormatEpisodeLabel(parse.FileInfo)
+			}
+
+			if label != testCase.wantLabel || parse.Pattern != testCase.wantPattern ||
+				parse.Special != testCase.wantSpecial || parse.Extra != testCase.wantExtra {
+				t.Fatalf(
+					"got %s pattern %d special %t extra %q, want %s pattern %d special %t extra %q",
+					label, parse.Pattern, parse.Special, parse.Extra,
+					testCase.wantLabel, testCase.wantPattern, testCase.wantSpecial, testCase.wantExtra,
+				)
+			}
+
+			if testCase.wantPattern > 0 && parse.Expression != episodePatterns[testCase.wantPattern-1].String() {
+				t.Fatalf("expression = %s, want pattern %d", parse.Expression, testCase.wantPattern)
+			}
+		})
+	}
+}
+
+func TestParseNameFollowsPatternOrder(t *testing.T) {
+	testCases := []struct {
+		name        string
+		order       []string
+		wantLabel   string
+		wantPattern string
+	}{
+		{name: "default order", wantLabel: "S01E10", wantPattern: "episode"},
+		{name: "trailing first", order: []string{"trailing"}, wantLabel: "S01E05", wantPattern: "trailing"},
+		{name: "episode first", order: []string{"Episode", "trailing"}, wantLabel: "S01E10", wantPattern: "episode"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			parse, err := ParseName("Show E10 Remaster 05.mkv", ScanOptions{PatternOrder: testCase.order})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			label := FormatEpisodeLabel(parse.FileInfo)
+			if label != testCase.wantLabel || parse.PatternName != testCase.wantPattern {
+				t.Fatalf("got %s by %s, want %s by %s", label, parse.PatternName, testCase.wantLabel, testCase.wantPattern)
+			}
+		})
+	}
+
+	for _, order := range [][]string{{"trailing", "sideways"}, {"dash", "dash"}} {
+		if _, err := ParseName("Show - 05.mkv", ScanOptions{PatternOrder: order}); err == nil {
+			t.Fatalf("expected an error for the pattern order %v", order)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partialDownloadSuffixes mark files that are still being downloaded, like
+// "Show 01.mkv.part" from Firefox, ".crdownload" from Chrome or ".!qB"
+// from qBittorrent. Some clients also keep a placeholder with the final
+// name next to them, which must not be renamed either.
+var partialDownloadSuffixes = []string{".part", ".partial", ".crdownload", ".download", ".!qB", ".!ut", ".aria2"}
+
+// partialDownload reports whether path is an incomplete download of a file
+// with one of the scanned extensions, either by its own suffix or because
+// a file with a download suffix sits next to it. It returns the file that
+// gave it away.
+func partialDownload(path string, extensionSet map[string]struct{}) (string, bool) {
+	hasExtension := func(name string) bool {
+		_, exists := extensionSet[strings.ToLower(filepath.Ext(name))]
+		return exists
+	}
+
+	for _, suffix := range partialDownloadSuffixes {
+		if strings.HasSuffix(strings.ToLower(path), strings.ToLower(suffix)) {
+			return path, hasExtension(path[:len(path)-len(suffix)])
+		}
+	}
+
+	if !hasExtension(path) {
+		return "", false
+	}
+
+	for _, suffix := range partialDownloadSuffixes {
+		if _, err := os.Lstat(path + suffix); err == nil {
+			return path + suffix, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,59 @@
+package renamer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFindFilesSkipsPartialDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{
+		"Show - 01.mkv.part",
+		"Show - 02.mkv.crdownload",
+		"Show - 03.mkv.!qB",
+		"Show - 04.mkv",
+		"Show - 04.mkv.part",
+		"Show - 05.mkv",
+		"Notes.txt.part",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	var debugMutex sync.Mutex
+	debug := []string{}
+	previousDebugf := Debugf
+	t.Cleanup(func() {
+		Debugf = previousDebugf
+	})
+	Debugf = func(format string, args ...any) {
+		debugMutex.Lock()
+		defer debugMutex.Unlock()
+		debug = append(debug, fmt.Sprintf(format, args...))
+	}
+
+	files, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Workers: 2})
+	if err != nil {
+		t.Fatalf("find files: %v", err)
+	}
+
+	if len(files) != 1 || filepath.Base(files[0].Path) != "Show - 05.mkv" {
+		t.Fatalf("expected only the finished download, got %+v", files)
+	}
+
+	notes := strings.Join(debug, "")
+	for _, name := range []string{"Show - 01.mkv.part", "Show - 02.mkv.crdownload", "Show - 03.mkv.!qB", "Show - 04.mkv "} {
+		if !strings.Contains(notes, name) {
+			t.Fatalf("expected a note about %s, got %q", name, notes)
+		}
+	}
+
+	if strings.Contains(notes, "Notes.txt.part") {
+		t.Fatalf("expected no note about partial downloads of other files, got %q", notes)
+	}
+}
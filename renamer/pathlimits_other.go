@@ -0,0 +1,14 @@
+//go:build !windows
+
+package renamer
+
+// Only the separator and NUL are off limits in names here, and paths may
+// run up to PATH_MAX bytes.
+const (
+	reservedNameCharacters = "/\x00"
+	maxPathLength          = 4096
+)
+
+func pathLength(path string) int {
+	return len(path)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package renamer
+
+import "unicode/utf16"
+
+// Windows reserves more characters in file names and, without long path
+// support, stops at MAX_PATH, counted in UTF-16 code units.
+const (
+	reservedNameCharacters = "<>:\"/\\|?*\x00"
+	maxPathLength          = 260
+)
+
+func pathLength(path string) int {
+	return len(utf16.Encode([]rune(path)))
+}
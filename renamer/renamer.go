@@ -0,0 +1,2890 @@
+// Package renamer holds the scanning, pairing, planning and renaming behind
+// the anime-renamer command so it can be used from other programs.
+//
+// A run goes through four steps: Scan parses the episode numbers of the
+// videos and subtitles in a folder, Pair matches them up, Plan turns the
+// pairs into rename operations and Execute carries them out, after Preflight
+// has checked the plan against the file system. None of them print or ask
+// anything; diagnostics go to Debugf, which discards them by default.
+package renamer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type FileInfo struct {
+	Path        string
+	Season      int
+	Episode     int
+	EpisodePart int
+	EpisodeEnd  int
+	Cour        int
+	Version     int
+	Title       string
+	Extension   string
+	Language    string
+	Qualifiers  []string
+	HasSeason   bool
+	Companions  []string
+
+	// FinalSeason is set for a file of a "Final Season" without a season
+	// number, which stays season 1 unless ScanOptions.FinalSeason is given.
+	FinalSeason bool
+
+	// Unnumbered is set for a file without an episode number, which Scan
+	// keeps with episode 0 until it can be numbered by its name.
+	Unnumbered bool
+}
+
+type FilePair struct {
+	Video        FileInfo
+	Subtitles    []FileInfo
+	Fuzzy        bool
+	PartialRange bool
+	SimilarName  bool
+}
+
+type RenameOperation struct {
+	OldPath string
+	NewPath string
+}
+
+// AlreadyNamed reports an operation whose file already has its target name,
+// which happens when a folder is processed again.
+func (o RenameOperation) AlreadyNamed() bool {
+	return o.OldPath == o.NewPath
+}
+
+type episodeMatch struct {
+	Season      int
+	Episode     int
+	EpisodePart int
+	EpisodeEnd  int
+	Cour        int
+	Version     int
+	HasSeason   bool
+	FinalSeason bool
+}
+
+type episodeKey struct {
+	Season      int
+	Cour        int
+	Episode     int
+	EpisodePart int
+	EpisodeEnd  int
+}
+
+type PreflightError struct {
+	Issues []string
+}
+
+func (e *PreflightError) Error() string {
+	return "preflight checks failed:\n - " + strings.Join(e.Issues, "\n - ")
+}
+
+type RenameExecutionError struct {
+	Phase string
+	From  string
+	To    string
+	Err   error
+}
+
+func (e *RenameExecutionError) Error() string {
+	return fmt.Sprintf("rename failed during %s (%s -> %s): %v", e.Phase, e.From, e.To, e.Err)
+}
+
+func (e *RenameExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// PartialExecutionError is returned by Execute with ContinueOnError when
+// some operations failed. Every other operation was carried out.
+type PartialExecutionError struct {
+	Failures []*RenameExecutionError
+}
+
+func (e *PartialExecutionError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		messages = append(messages, failure.Error())
+	}
+
+	return fmt.Sprintf("%d of the renames failed:\n - %s", len(e.Failures), strings.Join(messages, "\n - "))
+}
+
+func (e *PartialExecutionError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure)
+	}
+
+	return errs
+}
+
+// Failed reports whether operation is one of the failures.
+func (e *PartialExecutionError) Failed(operation RenameOperation) bool {
+	return e.failure(operation) != nil
+}
+
+func (e *PartialExecutionError) failure(operation RenameOperation) *RenameExecutionError {
+	for _, failure := range e.Failures {
+		if failure.From == operation.OldPath || failure.To == operation.NewPath {
+			return failure
+		}
+	}
+
+	return nil
+}
+
+// Completed returns the operations that were carried out.
+func (e *PartialExecutionError) Completed(operations []RenameOperation) []RenameOperation {
+	completed := []RenameOperation{}
+	for _, operation := range operations {
+		if !e.Failed(operation) {
+			completed = append(completed, operation)
+		}
+	}
+
+	return completed
+}
+
+type renameExecutor func(oldPath string, newPath string) error
+
+type renameState struct {
+	RenameOperation
+	TempPath    string
+	CurrentPath string
+}
+
+// episodePatterns are tried in order. Each captures the episode in a group
+// named "episode", and optionally the season and a decimal part in groups
+// named "season" and "part".
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)S(?P<season>\d+)\s*-\s*(?P<episode>\d+)(?:\.(?P<part>\d)\b)?`),
+	regexp.MustCompile(`(?i)S(?P<season>\d+)(?:\s|E)(?P<episode>\d+)(?:\.(?P<part>\d)\b)?`),
+	regexp.MustCompile(`(?i)E(?P<episode>\d+)(?:\.(?P<part>\d)\b)?`),
+	regexp.MustCompile(`\s-\s\(?(?P<episode>\d+)(?:\.(?P<part>\d)\b)?\)?`),
+	regexp.MustCompile(`(?i)(?:^|[^a-z])Ep(?:isode)?\.?\s*(?P<episode>\d{1,4})(?:\.(?P<part>\d)\b)?`),
+	regexp.MustCompile(`#(?P<episode>\d{1,4})(?:\.(?P<part>\d)\b)?`),
+	regexp.MustCompile(`[\[(](?P<episode>\d{1,4})(?:\.(?P<part>\d))?(?:v\d{1,2})?[\])]`),
+	regexp.MustCompile(`\s(?P<episode>\d{2,4})(?:\.(?P<part>\d))?(?:v\d{1,2})?(?:\s|$)`),
+}
+
+// episodePatternNames name the built-in episode patterns, in the order of
+// episodePatterns, for explaining which one read a file name.
+var episodePatternNames = []string{
+	"season-dash", "season-episode", "episode", "dash", "ep", "hash", "brackets", "trailing",
+}
+
+// episodePatternName names the pattern at position index, counting from 1,
+// as matchEpisode returns it. Custom patterns are named by their
+// expression.
+func episodePatternName(patterns []*regexp.Regexp, index int) string {
+	switch {
+	case index == specialMatch:
+		return "special"
+	case index < 1 || index > len(patterns):
+		return ""
+	}
+
+	pattern := patterns[index-1]
+	if builtin := slices.Index(episodePatterns, pattern); builtin >= 0 {
+		return episodePatternNames[builtin]
+	}
+
+	return "custom " + pattern.String()
+}
+
+// ValidateEpisodePattern checks a user-supplied episode pattern. It must
+// compile and capture the episode number in a group named "episode"; groups
+// named "season" and "part" are optional.
+func ValidateEpisodePattern(expression string) error {
+	_, err := compileEpisodePattern(expression)
+	return err
+}
+
+func compileEpisodePattern(expression string) (*regexp.Regexp, error) {
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid episode pattern %q: %w", expression, err)
+	}
+
+	if pattern.SubexpIndex("episode") < 0 {
+		return nil, fmt.Errorf("episode pattern %q has no (?P<episode>...) group", expression)
+	}
+
+	return pattern, nil
+}
+
+// ValidatePatternOrder checks that order only names built-in episode
+// patterns, each at most once. See ScanOptions.PatternOrder.
+func ValidatePatternOrder(order []string) error {
+	_, err := orderEpisodePatterns(order)
+	return err
+}
+
+// orderEpisodePatterns returns the built-in episode patterns with the ones
+// named in order first, in that order, and the rest after them as usual.
+func orderEpisodePatterns(order []string) ([]*regexp.Regexp, error) {
+	if len(order) == 0 {
+		return episodePatterns, nil
+	}
+
+	ordered := make([]*regexp.Regexp, 0, len(episodePatterns))
+	for _, name := range order {
+		index := slices.Index(episodePatternNames, strings.ToLower(strings.TrimSpace(name)))
+		if index < 0 {
+			return nil, fmt.Errorf(
+				"unknown episode pattern %q in the pattern order, expected one of %s",
+				name,
+				strings.Join(episodePatternNames, ", "),
+			)
+		}
+
+		if slices.Contains(ordered, episodePatterns[index]) {
+			return nil, fmt.Errorf("episode pattern %q is named twice in the pattern order", name)
+		}
+
+		ordered = append(ordered, episodePatterns[index])
+	}
+
+	for _, pattern := range episodePatterns {
+		if !slices.Contains(ordered, pattern) {
+			ordered = append(ordered, pattern)
+		}
+	}
+
+	return ordered, nil
+}
+
+// scanEpisodePatterns returns the episode patterns options ask for: the
+// built-in ones in ScanOptions.PatternOrder, with the custom ones added.
+func scanEpisodePatterns(options ScanOptions) ([]*regexp.Regexp, error) {
+	builtin, err := orderEpisodePatterns(options.PatternOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return combineEpisodePatterns(builtin, options.EpisodePatterns, options.EpisodePatternsFirst)
+}
+
+// combineEpisodePatterns puts the user's patterns before or after the
+// built-in ones.
+func combineEpisodePatterns(builtin []*regexp.Regexp, expressions []string, first bool) ([]*regexp.Regexp, error) {
+	if len(expressions) == 0 {
+		return builtin, nil
+	}
+
+	custom := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expression := range expressions {
+		pattern, err := compileEpisodePattern(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		custom = append(custom, pattern)
+	}
+
+	if first {
+		return slices.Concat(custom, builtin), nil
+	}
+
+	return slices.Concat(builtin, custom), nil
+}
+
+// episodeRangePattern continues right after a matched episode number, so
+// "01-02" and "E01-E02" become double episodes.
+var episodeRangePattern = regexp.MustCompile(`(?i)^-E?(\d{1,4})\b`)
+
+// versionPattern continues right after a matched episode number, for
+// re-releases tagged "01v2" or "01 v2".
+var versionPattern = regexp.MustCompile(`(?i)^\s?v(\d{1,2})\b`)
+
+var specialPattern = regexp.MustCompile(`(?i)\b(?:OVA|ONA|OAD|Specials?|SP)\s*-?\s*(\d+)(?:\.(\d)\b)?`)
+
+// extraPattern finds creditless openings and endings, which have no episode
+// of their own but often carry a number like "NCOP 01".
+var extraPattern = regexp.MustCompile(
+	`(?i)(?:\bNC|\b(?:Clean|Creditless|Non-?Credit)\s*)(OP|ED|Opening|Ending)(?:\s*-?\s*(\d+))?\b`,
+)
+
+// numberNoisePattern finds resolutions and years, which look like episode
+// numbers to the looser patterns, e.g. "Show - 1080p - 05" or "Show 2023 05".
+var numberNoisePattern = regexp.MustCompile(`(?i)\b(?:480|576|720|1080|2160)[pi]\b|\b(?:19|20)\d{2}\b`)
+
+// romanSeasonPattern finds seasons written in Roman numerals, like
+// "Season II", which normalizeSeasonText spells out in digits.
+var romanSeasonPattern = regexp.MustCompile(`(?i)\b(season\s*)(IV|III|II|I)\b`)
+
+var romanNumerals = map[string]string{"I": "1", "II": "2", "III": "3", "IV": "4"}
+
+// ordinalSeasonPattern finds seasons written as words, like "Second
+// Season", which normalizeSeasonText turns into "Season 2".
+var ordinalSeasonPattern = regexp.MustCompile(
+	`(?i)\b(first|second|third|fourth|fifth|sixth|seventh|eighth|ninth|tenth)\s+season\b`,
+)
+
+// numberedOrdinalSeasonPattern finds seasons like "2nd Season", which
+// normalizeSeasonText turns into "Season 2" so the "2" of "Show - 2nd
+// Season - 05" isn't taken for the episode.
+var numberedOrdinalSeasonPattern = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)\s+season\b`)
+
+var ordinalNumbers = map[string]string{
+	"first": "1", "second": "2", "third": "3", "fourth": "4", "fifth": "5",
+	"sixth": "6", "seventh": "7", "eighth": "8", "ninth": "9", "tenth": "10",
+}
+
+// finalSeasonPattern finds "Final Season", whose number the name doesn't
+// give.
+var finalSeasonPattern = regexp.MustCompile(`(?i)\bfinal\s+season\b`)
+
+// normalizeSeasonText prepares a name for the episode and season patterns,
+// which only know ASCII digits: "Ｓ１Ｅ０１" becomes "S1E01", "Season III"
+// becomes "Season 3" and "Second Season" and "2nd Season" become
+// "Season 2".
+func normalizeSeasonText(name string) string {
+	name = romanSeasonPattern.ReplaceAllStringFunc(NormalizeWidth(name), func(token string) string {
+		match := romanSeasonPattern.FindStringSubmatch(token)
+		return match[1] + romanNumerals[strings.ToUpper(match[2])]
+	})
+
+	name = numberedOrdinalSeasonPattern.ReplaceAllString(name, "Season $1")
+	return ordinalSeasonPattern.ReplaceAllStringFunc(name, func(token string) string {
+		match := ordinalSeasonPattern.FindStringSubmatch(token)
+		return "Season " + ordinalNumbers[strings.ToLower(match[1])]
+	})
+}
+
+// specialMatch is what matchEpisode returns for the pattern of a special.
+const specialMatch = -1
+
+// courPattern finds split seasons released as "Part 2" or "Cour 2".
+var courPattern = regexp.MustCompile(`(?i)\b(?:Part|Cour)\s*(\d+)\b`)
+
+var flexiblePattern = regexp.MustCompile(`\d+`)
+
+var seasonDirectoryPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bseason\s*(\d+)\b`),
+	regexp.MustCompile(`(?i)\b(\d+)(?:st|nd|rd|th)\s+season\b`),
+	regexp.MustCompile(`(?i)^s(\d+)$`),
+}
+
+// seasonTokenPattern finds a bare season token like the "S2" of "Show S2
+// Part 2 - 05", which seasonFromName reads in any name, not only in a
+// folder called "S2".
+var seasonTokenPattern = regexp.MustCompile(`(?i)\bS(\d{1,2})\b`)
+
+var seasonNamePatterns = slices.Concat(seasonDirectoryPatterns, []*regexp.Regexp{seasonTokenPattern})
+
+// seasonRangePattern finds the seasons a complete-series folder spans, like
+// "S1-S3 Complete" or "Seasons 1-3".
+var seasonRangePattern = regexp.MustCompile(`(?i)\b(?:seasons?\s*|s)(\d{1,2})\s*[-~]\s*(?:seasons?\s*|s)?(\d{1,2})\b`)
+
+// languageTagPattern matches the language tag of a subtitle: a bare
+// language like "en" or "spa", or a BCP 47 tag with a script and region,
+// like "zh-Hans", "pt-BR" or "zh-Hant-TW".
+var languageTagPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(?:-[A-Za-z]{4})?(?:-[A-Za-z]{2})?$`)
+
+var subtitleQualifiers = []string{"forced", "sdh", "cc", "hi", "default"}
+
+var templateTokenPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// numberFormatPattern matches the format of a {season:02d} or {episode:d}
+// token: d alone for no padding, or a zero and a width.
+var numberFormatPattern = regexp.MustCompile(`^(?:0(\d))?d$`)
+
+// emptyTitlePattern drops {title} together with its separator for files
+// without an episode title.
+var emptyTitlePattern = regexp.MustCompile(`\s*[-_.]?\s*\{title\}`)
+
+const DefaultTemplate = "{name} - S{season}E{episode}{ext}"
+
+var VideoExtensions = []string{".mkv", ".mp4", ".avi", ".webm", ".mov", ".ts", ".m4v"}
+
+var SubtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt", ".sub"}
+
+// maxNameLength is the longest single file name common file systems accept.
+const maxNameLength = 255
+
+var companionExtensions = map[string][]string{
+	".sub": {".idx"},
+	".ass": {".fonts"},
+	".ssa": {".fonts"},
+}
+
+// companionFolders are the companion extensions that name a folder rather
+// than a file, like the "Show - 01.fonts" folder holding the fonts an .ass
+// subtitle of the same name uses.
+var companionFolders = map[string]bool{".fonts": true}
+
+// Debugf receives the per-file details of a scan, like how every file was
+// parsed. It is called from the scanning workers concurrently and discards
+// everything unless replaced.
+var Debugf = func(format string, args ...any) {}
+
+// ScanOptions configures Scan. Empty extension and noise token lists fall
+// back to the built-in defaults. Sniff sorts files into videos and subtitles
+// by their first bytes instead of trusting the extension.
+// SubtitleFolder, when set, is scanned for the subtitles instead of the
+// folder holding the videos. SkipSubtitles leaves subtitles out entirely,
+// for videos with burned-in subtitles. Season, when not 0, keeps only the
+// files of that season and counts the others in ScanResult.OtherSeasons.
+type ScanOptions struct {
+	VideoExtensions    []string
+	SubtitleExtensions []string
+	NoiseTokens        []string
+	Workers            int
+	Recursive          bool
+	FoldParts          bool
+	SeasonCounts       []int
+	Sniff              bool
+	SubtitleFolder     string
+	SkipSubtitles      bool
+	Season             int
+
+	// GroupByDir matches PairOptions.GroupByDir, so files with the same
+	// episode in different directories don't collide.
+	GroupByDir bool
+
+	// FinalSeason is the season number of files from a "Final Season".
+	FinalSeason int
+
+	// Overrides give listed files their episode instead of parsing it from
+	// their names. See LoadOverrides.
+	Overrides Overrides
+
+	// EpisodePatterns are extra regular expressions for finding episodes,
+	// tried after the built-in ones unless EpisodePatternsFirst is set. See
+	// ValidateEpisodePattern for the groups they need.
+	EpisodePatterns      []string
+	EpisodePatternsFirst bool
+
+	// PatternOrder names built-in episode patterns, like "trailing" or
+	// "episode", to try before the others, in that order.
+	PatternOrder []string
+}
+
+// ScanResult holds the parsed files of a folder. Files that parse as the
+// same episode as another file of the show are left out and listed in
+// Collisions instead, since they can't all be given the same name.
+//
+// Shows splits the videos and subtitles by show when the folder holds
+// several, and has a single group otherwise. Superseded lists the older
+// releases of episodes that also came as a newer version, like "05" next
+// to "05v2", which are left out without counting as collisions.
+// OtherSeasons counts the files left out by ScanOptions.Season. Patterns
+// are the episode patterns the names were read with, for InferAnimeName.
+type ScanResult struct {
+	Videos       []FileInfo
+	Subtitles    []FileInfo
+	Shows        []ShowGroup
+	Collisions   [][]FileInfo
+	Superseded   []FileInfo
+	OtherSeasons int
+	Patterns     []*regexp.Regexp
+}
+
+// PairOptions configures Pair. SeasonOffset is added to the season of
+// every subtitle that names one before pairing, for subtitles numbered a
+// season off from the videos. VideosOnly makes every video a pair of its
+// own, to rename videos that have no subtitles.
+type PairOptions struct {
+	VideosOnly      bool
+	GroupByDir      bool
+	FuzzyNames      bool
+	SeasonOffset    int
+	VideoExtensions []string
+	NoiseTokens     []string
+}
+
+// PlanOptions configures Plan. FolderPath is only needed with OutputDir,
+// to keep the layout below the scanned folder. SubtitlesNextToVideos puts
+// renamed subtitles in the folder of their video, for subtitles scanned
+// from a separate folder. SubtitlesOnly leaves the videos alone and names
+// each subtitle after its video as it is, so AnimeName, NameCase, Template
+// and SeasonSubfolders don't apply. NameCase is one of NameCases.
+// Metadata, when set, gives {title} to episodes without a title in their
+// names.
+type PlanOptions struct {
+	AnimeName             string
+	NameCase              string
+	Metadata              MetadataProvider
+	Template              string
+	SeasonSubfolders      bool
+	SubtitlesNextToVideos bool
+	SubtitlesOnly         bool
+	FolderPath            string
+	OutputDir             string
+}
+
+// ExecuteOptions configures Preflight and Execute. An empty Mode renames.
+// Progress, when set, is called after every file Execute renames or
+// creates. PreserveModTimes gives renamed files and copies the
+// modification time of their original. ContinueOnError keeps renaming past
+// a failure instead of rolling the batch back, and returns a
+// *PartialExecutionError; it only applies to ModeRename. DryRun makes
+// Preflight skip writing probe files to check that folders are writable,
+// for plans that are only printed.
+type ExecuteOptions struct {
+	Mode             string
+	DryRun           bool
+	ReplaceLinks     bool
+	PreserveModTimes bool
+	ContinueOnError  bool
+	Progress         ProgressFunc
+}
+
+// ProgressFunc receives how many of the files in a batch are done.
+type ProgressFunc func(done int, total int)
+
+func (progress ProgressFunc) report(done int, total int) {
+	if progress != nil {
+		progress(done, total)
+	}
+}
+
+// Scan finds and parses the videos and subtitles in folderPath.
+func Scan(folderPath string, options ScanOptions) (ScanResult, error) {
+	videoExtensions := orDefault(options.VideoExtensions, VideoExtensions)
+	subtitleExtensions := orDefault(options.SubtitleExtensions, SubtitleExtensions)
+	noiseTokens := orDefault(options.NoiseTokens, ReleaseNoiseTokens)
+
+	subtitleFolder := cmp.Or(options.SubtitleFolder, folderPath)
+
+	patterns, err := scanEpisodePatterns(options)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	find := findOptions{
+		SubtitleExtensions: subtitleExtensions,
+		Patterns:           patterns,
+		Overrides:          options.Overrides,
+		Workers:            options.Workers,
+		Recursive:          options.Recursive,
+		KeepUnnumbered:     true,
+	}
+
+	var videoFiles, subtitleFiles []FileInfo
+	if options.Sniff {
+		videoFiles, subtitleFiles, err = findSniffedFiles(folderPath, videoExtensions, subtitleExtensions, find)
+		if err == nil && subtitleFolder != folderPath && !options.SkipSubtitles {
+			_, subtitleFiles, err = findSniffedFiles(subtitleFolder, videoExtensions, subtitleExtensions, find)
+		}
+	} else {
+		find.Extensions = videoExtensions
+		videoFiles, err = findFiles(folderPath, find)
+		if err == nil && !options.SkipSubtitles {
+			find.Extensions = subtitleExtensions
+			subtitleFiles, err = findFiles(subtitleFolder, find)
+		}
+	}
+
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	if options.SkipSubtitles {
+		subtitleFiles = nil
+	}
+
+	videoFiles, subtitleFiles = numberSameNamePairs(videoFiles, subtitleFiles, folderPath, subtitleFolder)
+
+	subtitleFiles, err = attachCompanionFiles(subtitleFiles, companionExtensions)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	videoFiles = attachEpisodeTitles(videoFiles, noiseTokens, patterns)
+	subtitleFiles = attachEpisodeTitles(subtitleFiles, noiseTokens, patterns)
+
+	if options.FoldParts {
+		videoFiles = foldCoursIntoSeasons(videoFiles)
+		subtitleFiles = foldCoursIntoSeasons(subtitleFiles)
+	}
+
+	if len(options.SeasonCounts) > 0 {
+		videoFiles = applyAbsoluteNumbering(videoFiles, options.SeasonCounts, folderPath)
+		subtitleFiles = applyAbsoluteNumbering(subtitleFiles, options.SeasonCounts, subtitleFolder)
+	}
+
+	if options.FinalSeason > 0 {
+		videoFiles = applyFinalSeason(videoFiles, options.FinalSeason)
+		subtitleFiles = applyFinalSeason(subtitleFiles, options.FinalSeason)
+	}
+
+	if len(videoFiles) == 0 && len(subtitleFiles) == 0 {
+		return ScanResult{}, errors.New("no video or subtitle files found")
+	}
+
+	result := ScanResult{
+		Videos:     []FileInfo{},
+		Subtitles:  []FileInfo{},
+		Collisions: [][]FileInfo{},
+		Superseded: []FileInfo{},
+		Patterns:   patterns,
+	}
+	if options.Season != 0 {
+		total := len(videoFiles) + len(subtitleFiles)
+		videoFiles = filterSeason(videoFiles, options.Season)
+		subtitleFiles = filterSeason(subtitleFiles, options.Season)
+		result.OtherSeasons = total - len(videoFiles) - len(subtitleFiles)
+
+		if len(videoFiles) == 0 && len(subtitleFiles) == 0 {
+			return ScanResult{}, fmt.Errorf("no video or subtitle files of season %d found", options.Season)
+		}
+	}
+
+	for _, show := range groupByShow(videoFiles, subtitleFiles, noiseTokens, patterns) {
+		videos, videoCollisions, videosSuperseded := excludeEpisodeCollisions(show.Videos, videoExtensions, options.GroupByDir)
+		subtitles, subtitleCollisions, subtitlesSuperseded := excludeEpisodeCollisions(
+			show.Subtitles,
+			videoExtensions,
+			options.GroupByDir,
+		)
+
+		result.Videos = append(result.Videos, videos...)
+		result.Subtitles = append(result.Subtitles, subtitles...)
+		result.Shows = append(result.Shows, ShowGroup{Videos: videos, Subtitles: subtitles})
+		result.Collisions = slices.Concat(result.Collisions, videoCollisions, subtitleCollisions)
+		result.Superseded = slices.Concat(result.Superseded, videosSuperseded, subtitlesSuperseded)
+	}
+
+	return result, nil
+}
+
+// applyFinalSeason numbers the files of a "Final Season" as season.
+func applyFinalSeason(files []FileInfo, season int) []FileInfo {
+	for i := range files {
+		if files[i].FinalSeason {
+			files[i].Season = season
+			files[i].HasSeason = true
+		}
+	}
+
+	return files
+}
+
+func filterSeason(files []FileInfo, season int) []FileInfo {
+	return slices.DeleteFunc(files, func(file FileInfo) bool {
+		return file.Season != season
+	})
+}
+
+// Pair matches the scanned videos with their subtitles and returns the
+// pairs and the files left unmatched.
+func Pair(videoFiles []FileInfo, subtitleFiles []FileInfo, options PairOptions) ([]FilePair, []FileInfo) {
+	if options.VideosOnly {
+		pairs := make([]FilePair, 0, len(videoFiles))
+		for _, video := range videoFiles {
+			pairs = append(pairs, FilePair{Video: video})
+		}
+
+		return pairs, subtitleFiles
+	}
+
+	if options.SeasonOffset != 0 {
+		subtitleFiles = applySeasonOffset(subtitleFiles, options.SeasonOffset)
+	}
+
+	var pairs []FilePair
+	var unmatched []FileInfo
+	if options.GroupByDir {
+		pairs, unmatched = createFilePairsByDirectory(videoFiles, subtitleFiles)
+	} else {
+		pairs, unmatched = createFilePairs(videoFiles, subtitleFiles)
+	}
+
+	if options.FuzzyNames {
+		similarPairs, remaining := pairBySimilarName(
+			unmatched,
+			orDefault(options.VideoExtensions, VideoExtensions),
+			orDefault(options.NoiseTokens, ReleaseNoiseTokens),
+		)
+		pairs = append(pairs, similarPairs...)
+		unmatched = remaining
+	}
+
+	return pairs, unmatched
+}
+
+// Plan builds the rename operations for pairs. An empty template uses
+// DefaultTemplate.
+func Plan(pairs []FilePair, options PlanOptions) ([]RenameOperation, error) {
+	var operations []RenameOperation
+	if options.SubtitlesOnly {
+		operations = buildSubtitleOperations(pairs)
+	} else {
+		if err := ValidateAnimeName(options.AnimeName); err != nil {
+			return nil, err
+		}
+
+		template := cmp.Or(options.Template, DefaultTemplate)
+		if err := ValidateTemplate(template); err != nil {
+			return nil, err
+		}
+
+		animeName, err := ApplyNameCase(options.AnimeName, options.NameCase)
+		if err != nil {
+			return nil, err
+		}
+
+		if options.Metadata != nil {
+			if pairs, err = attachProviderTitles(pairs, options.AnimeName, options.Metadata); err != nil {
+				return nil, err
+			}
+		}
+
+		operations = buildRenameOperations(pairs, animeName, template)
+	}
+
+	if options.SubtitlesNextToVideos {
+		operations = moveSubtitlesNextToVideos(operations, pairs)
+	}
+
+	if options.SeasonSubfolders && !options.SubtitlesOnly {
+		operations = moveIntoSeasonFolders(operations, pairs)
+	}
+
+	if options.OutputDir == "" {
+		return operations, nil
+	}
+
+	return moveIntoOutputDirectory(operations, options.FolderPath, options.OutputDir)
+}
+
+// Preflight checks that operations can all be carried out before anything
+// is changed. The returned *PreflightError lists every problem found.
+func Preflight(operations []RenameOperation, options ExecuteOptions) error {
+	return preflightOperations(operations, options)
+}
+
+// Execute carries out operations. A failed batch is rolled back, so either
+// every operation is applied or none is.
+func Execute(operations []RenameOperation, options ExecuteOptions) error {
+	return executeOperations(operations, options)
+}
+
+func orDefault(values []string, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+
+	return values
+}
+
+func ValidateAnimeName(animeName string) error {
+	if strings.TrimSpace(animeName) == "" {
+		return errors.New("anime name is empty")
+	}
+
+	if strings.TrimSpace(sanitizeFileName(animeName, reservedNameCharacters)) == "" {
+		return fmt.Errorf("anime name only contains invalid filename characters: %s", animeName)
+	}
+
+	return nil
+}
+
+// animeNameEpisodePattern finds episode tokens left in a name pasted from
+// a file name, like "S01E01", " - 01" or "Episode 5" at the end. A bare
+// trailing number isn't one, since titles like "Mob Psycho 100" have it.
+var animeNameEpisodePattern = regexp.MustCompile(
+	`(?i)\bS\d{1,2}\s*E\d{1,4}\b|\s-\s*\d{1,4}(?:v\d)?$|\b(?:E|EP|Episode)\s*\d{1,4}(?:v\d)?$`,
+)
+
+// CheckAnimeNameEpisode reports an anime name that holds an episode
+// token, which usually means a whole file name was pasted and every file
+// would get the episode twice. Unlike ValidateAnimeName the name still
+// works, so callers warn rather than fail.
+func CheckAnimeNameEpisode(animeName string) error {
+	if token := animeNameEpisodePattern.FindString(animeName); token != "" {
+		return fmt.Errorf("the anime name %q contains the episode %q, which every new name already gets", animeName,
+			strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(token), "-")))
+	}
+
+	return nil
+}
+
+func ValidateTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return errors.New("template is empty")
+	}
+
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("template must not contain path separators: %s", template)
+	}
+
+	hasEpisode := false
+	for _, match := range templateTokenPattern.FindAllStringSubmatch(template, -1) {
+		token, format, hasFormat := strings.Cut(match[1], ":")
+		switch token {
+		case "episode":
+			hasEpisode = true
+		case "season":
+		case "name", "title", "ext":
+			if hasFormat {
+				return fmt.Errorf("template token {%s} takes no format, only {season} and {episode} do", match[1])
+			}
+		default:
+			return fmt.Errorf("template contains unknown token {%s}", match[1])
+		}
+
+		if hasFormat && !numberFormatPattern.MatchString(format) {
+			return fmt.Errorf("template token {%s} has an unknown format, use d or a padding like 02d", match[1])
+		}
+	}
+
+	if !hasEpisode {
+		return fmt.Errorf("template must contain the {episode} token: %s", template)
+	}
+
+	return nil
+}
+
+// findOptions controls a findFiles walk. Only files with one of
+// Extensions are returned, parsed with Patterns, or the built-in episode
+// patterns when it is empty. SkipIgnoreFile leaves the folder's
+// IgnoreFileName unread. KeepUnnumbered returns files without an episode
+// number too, with episode 0. Files listed in Overrides are never parsed.
+// SubtitleExtensions, SubtitleExtensions by default, are the extensions
+// whose names may end in language and other subtitle tags.
+type findOptions struct {
+	Extensions         []string
+	SubtitleExtensions []string
+	Patterns           []*regexp.Regexp
+	Overrides          Overrides
+	Workers            int
+	Recursive          bool
+	SkipIgnoreFile     bool
+	KeepUnnumbered     bool
+}
+
+func findFiles(folderPath string, options findOptions) ([]FileInfo, error) {
+	extensionSet := map[string]struct{}{}
+
+	for _, ext := range options.Extensions {
+		normalizedExtension := strings.ToLower(ext)
+		extensionSet[normalizedExtension] = struct{}{}
+	}
+
+	patterns := options.Patterns
+	if len(patterns) == 0 {
+		patterns = episodePatterns
+	}
+
+	subtitleExtensions := orDefault(options.SubtitleExtensions, SubtitleExtensions)
+
+	workers := max(options.Workers, 1)
+
+	var ignorePatterns []ignorePattern
+	var err error
+	if !options.SkipIgnoreFile {
+		if ignorePatterns, err = loadIgnorePatterns(folderPath); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make(chan string)
+	results := make(chan FileInfo)
+
+	var workerGroup sync.WaitGroup
+	for range workers {
+		workerGroup.Add(1)
+		go func() {
+			defer workerGroup.Done()
+			for path := range paths {
+				if marker, partial := partialDownload(path, extensionSet); partial {
+					if marker == path {
+						Debugf("%s is an incomplete download, skipping\n", path)
+					} else {
+						Debugf("%s is still being downloaded to %s, skipping\n", path, filepath.Base(marker))
+					}
+
+					continue
+				}
+
+				if override, overridden := options.Overrides.lookup(folderPath, path); overridden {
+					if file, ok := overriddenFileInfo(path, extensionSet, subtitleExtensions, override); ok {
+						results <- file
+					}
+
+					continue
+				}
+
+				file, ok := parseFileInfo(path, folderPath, extensionSet, subtitleExtensions, patterns)
+				if !ok && options.KeepUnnumbered {
+					file, ok = parseUnnumberedFile(path, folderPath, extensionSet, subtitleExtensions, patterns)
+				}
+
+				if ok {
+					results <- file
+				}
+			}
+		}()
+	}
+
+	go func() {
+		workerGroup.Wait()
+		close(results)
+	}()
+
+	files := []FileInfo{}
+	collected := make(chan struct{})
+	go func() {
+		for file := range results {
+			files = append(files, file)
+		}
+		close(collected)
+	}()
+
+	err = filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("accessing path %q: %w", path, err)
+		}
+
+		if relativePath, err := filepath.Rel(folderPath, path); err == nil && path != folderPath &&
+			ignored(ignorePatterns, relativePath, info.IsDir()) {
+			Debugf("%s matches %s, skipping\n", path, IgnoreFileName)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		// Dotfiles like .DS_Store, the "._" AppleDouble files macOS writes next
+		// to every file on other file systems, and hidden folders like the
+		// backup hold metadata, not episodes.
+		if path != folderPath && strings.HasPrefix(info.Name(), ".") {
+			Debugf("%s is hidden, skipping\n", path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == filepath.Join(folderPath, UnmatchedDirName) || !options.Recursive && path != folderPath {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		paths <- path
+		return nil
+	})
+
+	close(paths)
+	<-collected
+
+	if err != nil {
+		return nil, fmt.Errorf("walking folder %q: %w", folderPath, err)
+	}
+
+	// Workers finish in any order, so sort to keep output stable between runs.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func parseFileInfo(
+	path string,
+	root string,
+	extensionSet map[string]struct{},
+	subtitleExtensions []string,
+	patterns []*regexp.Regexp,
+) (FileInfo, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, exists := extensionSet[ext]; !exists {
+		return FileInfo{}, false
+	}
+
+	baseName := NormalizeWidth(filepath.Base(path))
+	if !flexiblePattern.MatchString(baseName) {
+		return FileInfo{}, false
+	}
+
+	language := ""
+	var qualifiers []string
+	if slices.Contains(subtitleExtensions, ext) {
+		baseName, language, qualifiers = splitSubtitleTags(baseName)
+	}
+
+	if extra, ok := classifyExtra(baseName); ok {
+		Debugf("%s is a creditless %s, skipping\n", path, extra)
+		return FileInfo{}, false
+	}
+
+	match, pattern := matchEpisode(baseName, patterns)
+	if pattern == 0 {
+		Debugf("no episode number found in %s, skipping\n", path)
+		return FileInfo{}, false
+	}
+
+	if !match.HasSeason {
+		if season, ok := seasonFromDirectory(filepath.Dir(path), root); ok {
+			Debugf("using season %d from the folder of %s\n", season, path)
+			match.Season = season
+			match.HasSeason = true
+			match.FinalSeason = false
+		}
+	}
+
+	Debugf(
+		"%s: season %d, episode %s (pattern %s)\n",
+		path,
+		match.Season,
+		formatEpisodeNumber(FileInfo{Episode: match.Episode, EpisodePart: match.EpisodePart, EpisodeEnd: match.EpisodeEnd}),
+		episodePatternName(patterns, pattern),
+	)
+
+	return FileInfo{
+		Path:        path,
+		Season:      match.Season,
+		Episode:     match.Episode,
+		EpisodePart: match.EpisodePart,
+		EpisodeEnd:  match.EpisodeEnd,
+		Extension:   ext,
+		Language:    language,
+		Qualifiers:  qualifiers,
+		Cour:        match.Cour,
+		Version:     match.Version,
+		HasSeason:   match.HasSeason,
+		FinalSeason: match.FinalSeason,
+	}, true
+}
+
+// parseUnnumberedFile takes a file that has no episode number, which
+// parseFileInfo skips, with episode 0 so it can still be paired by name.
+func parseUnnumberedFile(
+	path string,
+	root string,
+	extensionSet map[string]struct{},
+	subtitleExtensions []string,
+	patterns []*regexp.Regexp,
+) (FileInfo, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, exists := extensionSet[ext]; !exists {
+		return FileInfo{}, false
+	}
+
+	baseName := NormalizeWidth(filepath.Base(path))
+	file := FileInfo{Path: path, Season: 1, Extension: ext, Unnumbered: true}
+	if slices.Contains(subtitleExtensions, ext) {
+		baseName, file.Language, file.Qualifiers = splitSubtitleTags(baseName)
+	}
+
+	if _, extra := classifyExtra(baseName); extra {
+		return FileInfo{}, false
+	}
+
+	if _, pattern := matchEpisode(baseName, patterns); pattern != 0 {
+		return FileInfo{}, false
+	}
+
+	if season, ok := seasonFromDirectory(filepath.Dir(path), root); ok {
+		file.Season = season
+		file.HasSeason = true
+	}
+
+	return file, true
+}
+
+// numberSameNamePairs handles the files without an episode number. A video
+// and subtitle that only differ by extension, like "Pilot.mkv" and
+// "Pilot.en.srt", are numbered as the episodes after the highest one found,
+// in name order, so they pair. They must also be in the same folder,
+// relative to videoRoot and subtitleRoot, so "A/Pilot.mkv" doesn't take
+// "B/Pilot.srt". The other unnumbered files are dropped.
+func numberSameNamePairs(
+	videoFiles []FileInfo,
+	subtitleFiles []FileInfo,
+	videoRoot string,
+	subtitleRoot string,
+) ([]FileInfo, []FileInfo) {
+	key := func(file FileInfo, root string) string {
+		name := strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+		if file.Language != "" || len(file.Qualifiers) > 0 {
+			name, _, _ = splitSubtitleTags(filepath.Base(file.Path))
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+
+		directory := filepath.Dir(file.Path)
+		if relative, err := filepath.Rel(root, directory); err == nil {
+			directory = relative
+		}
+
+		return filepath.Join(directory, NormalizeWidth(name))
+	}
+	videoKey := func(file FileInfo) string { return key(file, videoRoot) }
+
+	numberedVideos, unnumberedVideos := splitUnnumbered(videoFiles)
+	numberedSubtitles, unnumberedSubtitles := splitUnnumbered(subtitleFiles)
+
+	subtitlesByStem := map[string][]FileInfo{}
+	for _, subtitle := range unnumberedSubtitles {
+		subtitleKey := key(subtitle, subtitleRoot)
+		subtitlesByStem[subtitleKey] = append(subtitlesByStem[subtitleKey], subtitle)
+	}
+
+	videoCounts := map[string]int{}
+	for _, video := range unnumberedVideos {
+		videoCounts[videoKey(video)]++
+	}
+
+	nextEpisode := 1
+	for _, file := range slices.Concat(numberedVideos, numberedSubtitles) {
+		nextEpisode = max(nextEpisode, file.Episode+1, file.EpisodeEnd+1)
+	}
+
+	slices.SortFunc(unnumberedVideos, func(a FileInfo, b FileInfo) int {
+		return strings.Compare(videoKey(a), videoKey(b))
+	})
+
+	for _, video := range unnumberedVideos {
+		subtitles := subtitlesByStem[videoKey(video)]
+		if len(subtitles) == 0 || videoCounts[videoKey(video)] != 1 {
+			continue
+		}
+
+		Debugf("%s has no episode number, numbering it and its subtitles episode %d\n", video.Path, nextEpisode)
+		video.Episode = nextEpisode
+		video.Unnumbered = false
+		numberedVideos = append(numberedVideos, video)
+		for _, subtitle := range subtitles {
+			subtitle.Season = video.Season
+			subtitle.Episode = nextEpisode
+			subtitle.Unnumbered = false
+			numberedSubtitles = append(numberedSubtitles, subtitle)
+		}
+
+		nextEpisode++
+	}
+
+	return sortedByPath(numberedVideos), sortedByPath(numberedSubtitles)
+}
+
+func splitUnnumbered(files []FileInfo) ([]FileInfo, []FileInfo) {
+	numbered := []FileInfo{}
+	unnumbered := []FileInfo{}
+	for _, file := range files {
+		if file.Unnumbered {
+			unnumbered = append(unnumbered, file)
+		} else {
+			numbered = append(numbered, file)
+		}
+	}
+
+	return numbered, unnumbered
+}
+
+func sortedByPath(files []FileInfo) []FileInfo {
+	slices.SortFunc(files, func(a FileInfo, b FileInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return files
+}
+
+// seasonFromDirectory looks for a season in the directories holding a file,
+// nearest first, for layouts like "Show/Season 2/ep01.mkv". A directory
+// spanning a range of seasons ends the search, since its files are numbered
+// by ScanOptions.SeasonCounts instead. The search stops at root, the
+// scanned folder, so the folders above it don't count; with no root it
+// goes on to the top.
+func seasonFromDirectory(directory string, root string) (int, bool) {
+	for {
+		name := normalizeSeasonText(filepath.Base(directory))
+		if _, _, ok := seasonRangeFromName(name); ok {
+			return 0, false
+		}
+
+		if season, ok := seasonFromName(name); ok {
+			return season, true
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory || isRoot(directory, root) {
+			return 0, false
+		}
+
+		directory = parent
+	}
+}
+
+// seasonFromName finds a season like "Season 2", "2nd Season" or "S2" in
+// a folder or file name. A range of seasons isn't one.
+func seasonFromName(name string) (int, bool) {
+	if _, _, ok := seasonRangeFromName(name); ok {
+		return 0, false
+	}
+
+	for _, pattern := range seasonNamePatterns {
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+
+		if season, err := strconv.Atoi(match[1]); err == nil && season > 0 {
+			return season, true
+		}
+	}
+
+	return 0, false
+}
+
+// seasonRangeFromDirectory finds the range of seasons in the directories
+// holding a file, nearest first, for flat complete-series folders like
+// "Show S1-S3 Complete/Show - 27.mkv". Like seasonFromDirectory it stops at
+// root.
+func seasonRangeFromDirectory(directory string, root string) (int, int, bool) {
+	for {
+		if first, last, ok := seasonRangeFromName(normalizeSeasonText(filepath.Base(directory))); ok {
+			return first, last, true
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory || isRoot(directory, root) {
+			return 0, 0, false
+		}
+
+		directory = parent
+	}
+}
+
+// isRoot reports whether directory is root, when there is one.
+func isRoot(directory string, root string) bool {
+	return root != "" && filepath.Clean(directory) == filepath.Clean(root)
+}
+
+func seasonRangeFromName(name string) (int, int, bool) {
+	match := seasonRangePattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	first, firstErr := strconv.Atoi(match[1])
+	last, lastErr := strconv.Atoi(match[2])
+	if firstErr != nil || lastErr != nil || first < 1 || last <= first {
+		return 0, 0, false
+	}
+
+	return first, last, true
+}
+
+// splitSubtitleTags strips the dotted segments in front of a subtitle's
+// extension, like the "en" and "forced" in "Show 01.en.forced.srt", and
+// returns the remaining file name with the language and qualifiers found.
+func splitSubtitleTags(filename string) (string, string, []string) {
+	extension := filepath.Ext(filename)
+	name := strings.TrimSuffix(filename, extension)
+	language := ""
+	qualifiers := []string{}
+
+	for {
+		segmentExtension := filepath.Ext(name)
+		segment := strings.ToLower(strings.TrimPrefix(segmentExtension, "."))
+
+		switch {
+		case segment == "":
+		case slices.Contains(subtitleQualifiers, segment):
+			qualifiers = append([]string{segment}, qualifiers...)
+			name = strings.TrimSuffix(name, segmentExtension)
+			continue
+		case language == "" && languageTagPattern.MatchString(segment):
+			language = canonicalLanguageTag(segment)
+			name = strings.TrimSuffix(name, segmentExtension)
+			continue
+		}
+
+		break
+	}
+
+	if len(qualifiers) == 0 {
+		qualifiers = nil
+	}
+
+	return name + extension, language, qualifiers
+}
+
+// canonicalLanguageTag writes a language tag the way BCP 47 does, with
+// the language lowercase, the script capitalized and the region uppercase,
+// so "PT-br" and "pt-BR" are the same tag.
+func canonicalLanguageTag(tag string) string {
+	subtags := strings.Split(strings.ToLower(tag), "-")
+	for i, subtag := range subtags[1:] {
+		if len(subtag) == 4 {
+			subtags[i+1] = strings.ToUpper(subtag[:1]) + subtag[1:]
+		} else {
+			subtags[i+1] = strings.ToUpper(subtag)
+		}
+	}
+
+	return strings.Join(subtags, "-")
+}
+
+func subtitleTagSuffix(file FileInfo) string {
+	suffix := ""
+	if file.Language != "" {
+		suffix = "." + file.Language
+	}
+
+	for _, qualifier := range file.Qualifiers {
+		suffix += "." + qualifier
+	}
+
+	return suffix
+}
+
+func attachCompanionFiles(files []FileInfo, companions map[string][]string) ([]FileInfo, error) {
+	attached := make([]FileInfo, 0, len(files))
+
+	for _, file := range files {
+		basePath := strings.TrimSuffix(file.Path, filepath.Ext(file.Path))
+
+		for _, companionExtension := range companions[file.Extension] {
+			companionPath, err := findCompanionPath(basePath, companionExtension)
+			if err != nil {
+				return nil, err
+			}
+
+			if companionPath != "" {
+				file.Companions = append(file.Companions, companionPath)
+			}
+		}
+
+		attached = append(attached, file)
+	}
+
+	return attached, nil
+}
+
+func findCompanionPath(basePath string, extension string) (string, error) {
+	for _, candidateExtension := range []string{extension, strings.ToUpper(extension)} {
+		candidate := basePath + candidateExtension
+
+		info, err := os.Stat(candidate)
+		if err == nil && info.IsDir() == companionFolders[extension] {
+			return candidate, nil
+		}
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("checking companion file %s: %w", candidate, err)
+		}
+	}
+
+	return "", nil
+}
+
+// extractSeasonAndEpisode reads the season and episode of filename and
+// whether an episode was found at all, since episode 0 is a real one.
+func extractSeasonAndEpisode(filename string) (int, int, bool) {
+	season, episode, pattern := extractSeasonAndEpisodeNamed(filename)
+	return season, episode, pattern != ""
+}
+
+// extractSeasonAndEpisodeNamed is extractSeasonAndEpisode that also names
+// the pattern that found the episode, "special" for specials and "" when
+// none did.
+func extractSeasonAndEpisodeNamed(filename string) (int, int, string) {
+	match, pattern := matchEpisode(filename, episodePatterns)
+	return match.Season, match.Episode, episodePatternName(episodePatterns, pattern)
+}
+
+func parseEpisode(filename string) episodeMatch {
+	return parseEpisodeWith(filename, episodePatterns)
+}
+
+func parseEpisodeWith(filename string, patterns []*regexp.Regexp) episodeMatch {
+	match, _ := matchEpisode(filename, patterns)
+	return match
+}
+
+// matchEpisode parses filename like parseEpisodeWith and also returns the
+// position of the pattern that matched, counting from 1. It is 0 when none
+// did and specialMatch for a special. The episode itself may be 0, like the
+// "E00" of a prologue, so only the position tells whether one was found.
+func matchEpisode(filename string, patterns []*regexp.Regexp) (episodeMatch, int) {
+	filename = normalizeSeasonText(filename)
+	filenameWithoutExtension := maskNumberNoise(strings.TrimSuffix(filename, filepath.Ext(filename)))
+
+	if match, ok := parseSpecialEpisode(filenameWithoutExtension); ok {
+		return match, specialMatch
+	}
+
+	for patternIndex, pattern := range patterns {
+		indexes := pattern.FindStringSubmatchIndex(filenameWithoutExtension)
+		if indexes == nil {
+			continue
+		}
+
+		episodeText, episodeEnd := namedGroup(pattern, filenameWithoutExtension, indexes, "episode")
+		episode, err := strconv.Atoi(episodeText)
+		if err != nil {
+			continue
+		}
+
+		result := episodeMatch{Season: 1, Episode: episode}
+		versionStart := episodeEnd
+		if part, partEnd := namedGroup(pattern, filenameWithoutExtension, indexes, "part"); part != "" {
+			result.EpisodePart, _ = strconv.Atoi(part)
+			versionStart = partEnd
+		} else {
+			result.EpisodeEnd = parseEpisodeRangeEnd(filenameWithoutExtension[episodeEnd:], episode)
+		}
+
+		if versionMatch := versionPattern.FindStringSubmatch(filenameWithoutExtension[versionStart:]); versionMatch != nil {
+			result.Version, _ = strconv.Atoi(versionMatch[1])
+		}
+
+		if season, _ := namedGroup(pattern, filenameWithoutExtension, indexes, "season"); season != "" {
+			parsedSeason, parseErr := strconv.Atoi(season)
+			if parseErr == nil && parsedSeason > 0 {
+				result.Season = parsedSeason
+				result.HasSeason = true
+			}
+		}
+
+		// Only the text in front of the episode counts, since episode titles
+		// like "Part 1 of 2" follow it.
+		if !result.HasSeason {
+			result.Season, result.HasSeason = seasonFromName(filenameWithoutExtension[:indexes[0]])
+			if !result.HasSeason {
+				result.Season = 1
+				result.FinalSeason = finalSeasonPattern.MatchString(filenameWithoutExtension[:indexes[0]])
+			}
+		}
+
+		if courMatch := courPattern.FindStringSubmatch(filenameWithoutExtension[:indexes[0]]); courMatch != nil {
+			result.Cour, _ = strconv.Atoi(courMatch[1])
+		}
+
+		return result, patternIndex + 1
+	}
+
+	return episodeMatch{Season: 1}, 0
+}
+
+// namedGroup returns the text a named group of pattern captured and the
+// offset where it ends, or "" when the group is missing or didn't match.
+func namedGroup(pattern *regexp.Regexp, text string, indexes []int, name string) (string, int) {
+	index := pattern.SubexpIndex(name)
+	if index < 0 || indexes[2*index] < 0 {
+		return "", -1
+	}
+
+	return text[indexes[2*index]:indexes[2*index+1]], indexes[2*index+1]
+}
+
+// maskNumberNoise blanks resolutions, years and seasons like "2nd Season"
+// with spaces of the same length, so match positions still line up with
+// the original name.
+func maskNumberNoise(name string) string {
+	blank := func(token string) string {
+		return strings.Repeat(" ", len(token))
+	}
+
+	name = numberedOrdinalSeasonPattern.ReplaceAllStringFunc(name, blank)
+	return numberNoisePattern.ReplaceAllStringFunc(name, blank)
+}
+
+func parseEpisodeRangeEnd(rest string, start int) int {
+	match := episodeRangePattern.FindStringSubmatch(rest)
+	if match == nil {
+		return 0
+	}
+
+	end, err := strconv.Atoi(match[1])
+	if err != nil || end <= start {
+		return 0
+	}
+
+	return end
+}
+
+// classifyExtra reports whether a file is a creditless opening or ending and
+// labels it like "NCOP1" or "NCED", so it isn't taken for an episode.
+func classifyExtra(filename string) (string, bool) {
+	match := extraPattern.FindStringSubmatch(filename)
+	if match == nil {
+		return "", false
+	}
+
+	label := "NCOP"
+	if kind := strings.ToUpper(match[1]); kind == "ED" || kind == "ENDING" {
+		label = "NCED"
+	}
+
+	if number, err := strconv.Atoi(match[2]); err == nil {
+		label += strconv.Itoa(number)
+	}
+
+	return label, true
+}
+
+func parseSpecialEpisode(filename string) (episodeMatch, bool) {
+	match := specialPattern.FindStringSubmatch(filename)
+	if match == nil {
+		return episodeMatch{}, false
+	}
+
+	episode, err := strconv.Atoi(match[1])
+	if err != nil || episode == 0 {
+		return episodeMatch{}, false
+	}
+
+	result := episodeMatch{Season: 0, Episode: episode, HasSeason: true}
+	if match[2] != "" {
+		result.EpisodePart, _ = strconv.Atoi(match[2])
+	}
+
+	return result, true
+}
+
+// foldCoursIntoSeasons numbers every part after the first as a season of
+// its own, so "Season 1 Part 2" becomes season 2.
+func foldCoursIntoSeasons(files []FileInfo) []FileInfo {
+	folded := make([]FileInfo, 0, len(files))
+
+	for _, file := range files {
+		if file.Cour > 0 {
+			file.Season += file.Cour - 1
+			file.Cour = 0
+			file.HasSeason = true
+		}
+
+		folded = append(folded, file)
+	}
+
+	return folded
+}
+
+// resolveAbsoluteEpisode turns an absolute episode number into a season
+// and episode, with seasonCounts holding the episode counts of firstSeason
+// and the seasons after it.
+func resolveAbsoluteEpisode(absolute int, firstSeason int, seasonCounts []int) (int, int) {
+	remaining := absolute
+
+	for index, count := range seasonCounts {
+		if remaining <= count {
+			return firstSeason + index, remaining
+		}
+
+		remaining -= count
+	}
+
+	// Episodes past the last known season spill into the next one, which is
+	// usually a season that is still airing.
+	return firstSeason + len(seasonCounts), remaining
+}
+
+// applyAbsoluteNumbering numbers the files without a season from their
+// absolute episode. In a folder spanning a range of seasons, like "S2-S4",
+// the counts start at the first season of the range, looking no higher than
+// root, the scanned folder.
+func applyAbsoluteNumbering(files []FileInfo, seasonCounts []int, root string) []FileInfo {
+	resolved := make([]FileInfo, 0, len(files))
+
+	for _, file := range files {
+		if !file.HasSeason {
+			firstSeason := 1
+			if first, _, ok := seasonRangeFromDirectory(filepath.Dir(file.Path), root); ok {
+				firstSeason = first
+			}
+
+			file.Season, file.Episode = resolveAbsoluteEpisode(file.Episode, firstSeason, seasonCounts)
+		}
+
+		resolved = append(resolved, file)
+	}
+
+	return resolved
+}
+
+func createFilePairs(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo) {
+	pairs, unmatchedVideos, unmatchedSubtitles := pairByEpisodeKey(videoFiles, subtitleFiles)
+
+	fuzzyPairs, unmatchedVideos, unmatchedSubtitles := pairByEpisodeOnly(unmatchedVideos, unmatchedSubtitles)
+	pairs = append(pairs, fuzzyPairs...)
+
+	rangePairs, unmatchedVideos, unmatchedSubtitles := pairRangeByFirstEpisode(unmatchedVideos, unmatchedSubtitles)
+	pairs = append(pairs, rangePairs...)
+
+	unmatched := append(unmatchedVideos, unmatchedSubtitles...)
+
+	return pairs, unmatched
+}
+
+func createFilePairsByDirectory(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo) {
+	videoGroups := partitionByDirectory(videoFiles)
+	subtitleGroups := partitionByDirectory(subtitleFiles)
+
+	directories := []string{}
+	for directory := range videoGroups {
+		directories = append(directories, directory)
+	}
+
+	for directory := range subtitleGroups {
+		if _, exists := videoGroups[directory]; !exists {
+			directories = append(directories, directory)
+		}
+	}
+
+	sort.Strings(directories)
+
+	pairs := []FilePair{}
+	unmatched := []FileInfo{}
+
+	for _, directory := range directories {
+		groupPairs, groupUnmatched := createFilePairs(videoGroups[directory], subtitleGroups[directory])
+		pairs = append(pairs, groupPairs...)
+		unmatched = append(unmatched, groupUnmatched...)
+	}
+
+	return pairs, unmatched
+}
+
+func partitionByDirectory(files []FileInfo) map[string][]FileInfo {
+	groups := map[string][]FileInfo{}
+
+	for _, file := range files {
+		directory := filepath.Dir(file.Path)
+		groups[directory] = append(groups[directory], file)
+	}
+
+	return groups
+}
+
+func pairByEpisodeKey(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo, []FileInfo) {
+	pairs := []FilePair{}
+	unmatchedVideos := []FileInfo{}
+	subtitleMap := make(map[episodeKey][]FileInfo)
+	pairedSubtitles := map[string]struct{}{}
+
+	for _, subtitle := range subtitleFiles {
+		key := fileEpisodeKey(subtitle)
+		subtitleMap[key] = append(subtitleMap[key], subtitle)
+	}
+
+	for _, video := range videoFiles {
+		key := fileEpisodeKey(video)
+
+		if subtitles, exists := subtitleMap[key]; exists {
+			pairs = append(pairs, FilePair{Video: video, Subtitles: subtitles})
+			markPaired(pairedSubtitles, subtitles)
+			delete(subtitleMap, key)
+		} else {
+			unmatchedVideos = append(unmatchedVideos, video)
+		}
+	}
+
+	return pairs, unmatchedVideos, filterUnpaired(subtitleFiles, pairedSubtitles)
+}
+
+// pairByEpisodeOnly pairs leftovers that agree on the episode number but not
+// the season, which happens when only one side carries a season token. It
+// only pairs when there is exactly one video and one episode's worth of
+// subtitles for that number.
+func pairByEpisodeOnly(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo, []FileInfo) {
+	episodeOnlyKey := func(file FileInfo) episodeKey {
+		return episodeKey{
+			Cour:        file.Cour,
+			Episode:     file.Episode,
+			EpisodePart: file.EpisodePart,
+			EpisodeEnd:  file.EpisodeEnd,
+		}
+	}
+
+	videoCounts := map[episodeKey]int{}
+	subtitlesByKey := map[episodeKey][]FileInfo{}
+
+	for _, video := range videoFiles {
+		videoCounts[episodeOnlyKey(video)]++
+	}
+
+	for _, subtitle := range subtitleFiles {
+		key := episodeOnlyKey(subtitle)
+		subtitlesByKey[key] = append(subtitlesByKey[key], subtitle)
+	}
+
+	pairs := []FilePair{}
+	unmatchedVideos := []FileInfo{}
+	pairedSubtitles := map[string]struct{}{}
+
+	for _, video := range videoFiles {
+		key := episodeOnlyKey(video)
+		subtitles := subtitlesByKey[key]
+
+		if len(subtitles) == 0 || videoCounts[key] != 1 || !sameSeason(subtitles) ||
+			(video.HasSeason && subtitles[0].HasSeason) {
+			unmatchedVideos = append(unmatchedVideos, video)
+			continue
+		}
+
+		adjusted := make([]FileInfo, 0, len(subtitles))
+		for _, subtitle := range subtitles {
+			if subtitle.HasSeason {
+				video.Season = subtitle.Season
+			} else {
+				subtitle.Season = video.Season
+			}
+
+			adjusted = append(adjusted, subtitle)
+		}
+
+		pairs = append(pairs, FilePair{Video: video, Subtitles: adjusted, Fuzzy: true})
+		markPaired(pairedSubtitles, subtitles)
+	}
+
+	return pairs, unmatchedVideos, filterUnpaired(subtitleFiles, pairedSubtitles)
+}
+
+// applySeasonOffset shifts the files that carry a season token. Files
+// without one keep the season they were given, and no season drops below
+// the specials season 0.
+func applySeasonOffset(files []FileInfo, offset int) []FileInfo {
+	shifted := make([]FileInfo, 0, len(files))
+	for _, file := range files {
+		if file.HasSeason {
+			file.Season = max(0, file.Season+offset)
+		}
+		shifted = append(shifted, file)
+	}
+
+	return shifted
+}
+
+// SuggestSeasonOffset checks whether every unmatched subtitle has an
+// unmatched video with the same episode in another season, the same number
+// of seasons apart, like subtitles numbered S02 for videos numbered S01. It
+// returns the offset that lines the subtitle seasons up with the videos.
+func SuggestSeasonOffset(unmatched []FileInfo, videoExtensions []string) (int, bool) {
+	episodeOnlyKey := func(file FileInfo) episodeKey {
+		key := fileEpisodeKey(file)
+		key.Season = 0
+		return key
+	}
+
+	videosByEpisode := map[episodeKey][]FileInfo{}
+	subtitles := []FileInfo{}
+	for _, file := range unmatched {
+		if !file.HasSeason {
+			continue
+		}
+
+		if slices.Contains(videoExtensions, file.Extension) {
+			key := episodeOnlyKey(file)
+			videosByEpisode[key] = append(videosByEpisode[key], file)
+		} else {
+			subtitles = append(subtitles, file)
+		}
+	}
+
+	offset := 0
+	for _, subtitle := range subtitles {
+		videos := videosByEpisode[episodeOnlyKey(subtitle)]
+		if len(videos) != 1 {
+			return 0, false
+		}
+
+		difference := videos[0].Season - subtitle.Season
+		if difference == 0 || (offset != 0 && difference != offset) {
+			return 0, false
+		}
+
+		offset = difference
+	}
+
+	return offset, offset != 0
+}
+
+// pairRangeByFirstEpisode gives a double episode video like "01-02" the
+// subtitles of its first episode when the subtitles come as separate files.
+// mpv only loads subtitles named after the video, so the later episodes'
+// subtitles stay unmatched.
+func pairRangeByFirstEpisode(videoFiles, subtitleFiles []FileInfo) ([]FilePair, []FileInfo, []FileInfo) {
+	pairs := []FilePair{}
+	unmatchedVideos := []FileInfo{}
+	pairedSubtitles := map[string]struct{}{}
+
+	for _, video := range videoFiles {
+		if video.EpisodeEnd == 0 {
+			unmatchedVideos = append(unmatchedVideos, video)
+			continue
+		}
+
+		subtitles := []FileInfo{}
+		for _, subtitle := range subtitleFiles {
+			if _, paired := pairedSubtitles[subtitle.Path]; paired {
+				continue
+			}
+
+			if subtitle.Season == video.Season && subtitle.Episode == video.Episode &&
+				subtitle.EpisodeEnd == 0 && subtitle.EpisodePart == 0 {
+				subtitle.EpisodeEnd = video.EpisodeEnd
+				subtitles = append(subtitles, subtitle)
+			}
+		}
+
+		if len(subtitles) == 0 {
+			unmatchedVideos = append(unmatchedVideos, video)
+			continue
+		}
+
+		pairs = append(pairs, FilePair{Video: video, Subtitles: subtitles, PartialRange: true})
+		markPaired(pairedSubtitles, subtitles)
+	}
+
+	return pairs, unmatchedVideos, filterUnpaired(subtitleFiles, pairedSubtitles)
+}
+
+// similarNameThreshold is the lowest name similarity -fuzzy-names pairs on.
+const similarNameThreshold = 0.75
+
+// pairBySimilarName pairs leftover videos and subtitles whose cleaned names
+// are alike, for subtitle releases numbered differently from the videos.
+// A pair is only made when both files are each other's single best match.
+func pairBySimilarName(unmatched []FileInfo, videoExtensions []string, noiseTokens []string) ([]FilePair, []FileInfo) {
+	videos := []FileInfo{}
+	subtitles := []FileInfo{}
+	for _, file := range unmatched {
+		if slices.Contains(videoExtensions, file.Extension) {
+			videos = append(videos, file)
+		} else {
+			subtitles = append(subtitles, file)
+		}
+	}
+
+	scores := make([][]float64, len(videos))
+	for videoIndex, video := range videos {
+		scores[videoIndex] = make([]float64, len(subtitles))
+		for subtitleIndex, subtitle := range subtitles {
+			scores[videoIndex][subtitleIndex] = nameSimilarity(
+				similarityName(video.Path, noiseTokens),
+				similarityName(subtitle.Path, noiseTokens),
+			)
+		}
+	}
+
+	// bestIndex returns the index of the single highest score, or -1 when it
+	// is below the threshold or shared.
+	bestIndex := func(count int, score func(int) float64) int {
+		best := -1
+		tied := false
+		for index := range count {
+			switch {
+			case best < 0 || score(index) > score(best):
+				best = index
+				tied = false
+			case score(index) == score(best):
+				tied = true
+			}
+		}
+
+		if best < 0 || tied || score(best) < similarNameThreshold {
+			return -1
+		}
+
+		return best
+	}
+
+	pairs := []FilePair{}
+	paired := map[string]struct{}{}
+
+	for videoIndex, video := range videos {
+		subtitleIndex := bestIndex(len(subtitles), func(index int) float64 { return scores[videoIndex][index] })
+		if subtitleIndex < 0 {
+			continue
+		}
+
+		if bestIndex(len(videos), func(index int) float64 { return scores[index][subtitleIndex] }) != videoIndex {
+			continue
+		}
+
+		subtitle := NumberedLike(subtitles[subtitleIndex], video)
+		pairs = append(pairs, FilePair{Video: video, Subtitles: []FileInfo{subtitle}, SimilarName: true})
+		markPaired(paired, []FileInfo{video, subtitles[subtitleIndex]})
+	}
+
+	return pairs, filterUnpaired(unmatched, paired)
+}
+
+// NumberedLike returns subtitle with the season, cour and episode numbers of
+// video, for a subtitle paired by something other than its number, so both
+// get the same name.
+func NumberedLike(subtitle FileInfo, video FileInfo) FileInfo {
+	subtitle.Season = video.Season
+	subtitle.Cour = video.Cour
+	subtitle.Episode = video.Episode
+	subtitle.EpisodePart = video.EpisodePart
+	subtitle.EpisodeEnd = video.EpisodeEnd
+	subtitle.HasSeason = video.HasSeason
+	return subtitle
+}
+
+func similarityName(path string, noiseTokens []string) string {
+	name, _, _ := splitSubtitleTags(filepath.Base(path))
+	name = CleanFilename(name, noiseTokens)
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+func sameSeason(files []FileInfo) bool {
+	for _, file := range files[1:] {
+		if file.Season != files[0].Season || file.HasSeason != files[0].HasSeason {
+			return false
+		}
+	}
+
+	return true
+}
+
+func markPaired(paired map[string]struct{}, files []FileInfo) {
+	for _, file := range files {
+		paired[file.Path] = struct{}{}
+	}
+}
+
+func filterUnpaired(files []FileInfo, paired map[string]struct{}) []FileInfo {
+	unpaired := []FileInfo{}
+
+	for _, file := range files {
+		if _, exists := paired[file.Path]; !exists {
+			unpaired = append(unpaired, file)
+		}
+	}
+
+	return unpaired
+}
+
+// excludeEpisodeCollisions drops files that would be renamed to the same
+// target as another file, like two videos that both parse as S01E05. Subtitle
+// tracks only collide when their language and format match as well. When
+// one of the files is a newer version than all the others, like "05v2"
+// next to "05", it is kept and the others are returned as superseded.
+// With groupByDir, files only collide with files of their own directory,
+// since each directory is paired and renamed on its own.
+func excludeEpisodeCollisions(
+	files []FileInfo,
+	videoExtensions []string,
+	groupByDir bool,
+) ([]FileInfo, [][]FileInfo, []FileInfo) {
+	type collisionKey struct {
+		episodeKey
+		Tags      string
+		Extension string
+		Directory string
+	}
+
+	keyFor := func(file FileInfo) collisionKey {
+		key := collisionKey{episodeKey: fileEpisodeKey(file), Tags: subtitleTagSuffix(file)}
+		if !slices.Contains(videoExtensions, file.Extension) {
+			key.Extension = file.Extension
+		}
+
+		if groupByDir {
+			key.Directory = filepath.Dir(file.Path)
+		}
+
+		return key
+	}
+
+	groups := map[collisionKey][]FileInfo{}
+	for _, file := range files {
+		key := keyFor(file)
+		groups[key] = append(groups[key], file)
+	}
+
+	kept := []FileInfo{}
+	collisions := [][]FileInfo{}
+	superseded := []FileInfo{}
+	reported := map[collisionKey]bool{}
+
+	for _, file := range files {
+		key := keyFor(file)
+		if len(groups[key]) == 1 {
+			kept = append(kept, file)
+			continue
+		}
+
+		if newest, ok := newestVersion(groups[key]); ok {
+			if file.Path == newest.Path {
+				kept = append(kept, file)
+			} else {
+				superseded = append(superseded, file)
+			}
+
+			continue
+		}
+
+		if !reported[key] {
+			collisions = append(collisions, groups[key])
+			reported[key] = true
+		}
+	}
+
+	return kept, collisions, superseded
+}
+
+// newestVersion finds the file with a higher version than every other one.
+// Files without a version tag count as version 1.
+func newestVersion(files []FileInfo) (FileInfo, bool) {
+	version := func(file FileInfo) int {
+		return max(file.Version, 1)
+	}
+
+	newest := slices.MaxFunc(files, func(a FileInfo, b FileInfo) int {
+		return cmp.Compare(version(a), version(b))
+	})
+
+	for _, file := range files {
+		if file.Path != newest.Path && version(file) == version(newest) {
+			return FileInfo{}, false
+		}
+	}
+
+	return newest, true
+}
+
+func FormatEpisodeLabel(file FileInfo) string {
+	return fmt.Sprintf("S%sE%s", formatSeasonNumber(file), formatEpisodeNumber(file))
+}
+
+func fileEpisodeKey(file FileInfo) episodeKey {
+	return episodeKey{
+		Season:      file.Season,
+		Cour:        file.Cour,
+		Episode:     file.Episode,
+		EpisodePart: file.EpisodePart,
+		EpisodeEnd:  file.EpisodeEnd,
+	}
+}
+
+func buildRenameOperations(pairs []FilePair, animeName string, template string) []RenameOperation {
+	operations := make([]RenameOperation, 0, len(pairs)*2)
+	width := episodeWidth(pairs)
+
+	for _, pair := range pairs {
+		title := pairTitle(pair)
+
+		video := pair.Video
+		video.Title = title
+		operations = append(operations, fileRenameOperations(video, animeName, template, width)...)
+
+		for _, subtitle := range pair.Subtitles {
+			subtitle.Title = title
+			operations = append(operations, fileRenameOperations(subtitle, animeName, template, width)...)
+		}
+	}
+
+	return operations
+}
+
+// buildSubtitleOperations names every subtitle after its video as it is,
+// for videos that already have the names they should keep.
+func buildSubtitleOperations(pairs []FilePair) []RenameOperation {
+	operations := []RenameOperation{}
+
+	for _, pair := range pairs {
+		videoName := strings.TrimSuffix(filepath.Base(pair.Video.Path), filepath.Ext(pair.Video.Path))
+
+		for _, subtitle := range pair.Subtitles {
+			suffix := subtitleTagSuffix(subtitle)
+			operations = append(operations, RenameOperation{
+				OldPath: subtitle.Path,
+				NewPath: filepath.Join(filepath.Dir(subtitle.Path), videoName+suffix+subtitle.Extension),
+			})
+
+			for _, companion := range subtitle.Companions {
+				operations = append(operations, RenameOperation{
+					OldPath: companion,
+					NewPath: filepath.Join(
+						filepath.Dir(companion),
+						videoName+suffix+strings.ToLower(filepath.Ext(companion)),
+					),
+				})
+			}
+		}
+	}
+
+	return operations
+}
+
+// episodeWidth pads every episode in a batch to the width of the highest
+// one, so "E099" still sorts before "E100".
+func episodeWidth(pairs []FilePair) int {
+	highest := 0
+	for _, pair := range pairs {
+		for _, file := range append([]FileInfo{pair.Video}, pair.Subtitles...) {
+			highest = max(highest, file.Episode, file.EpisodeEnd)
+		}
+	}
+
+	return max(2, len(strconv.Itoa(highest)))
+}
+
+// pairTitle prefers the video's episode title, since subtitle releases are
+// more likely to be named loosely.
+func pairTitle(pair FilePair) string {
+	if pair.Video.Title != "" {
+		return pair.Video.Title
+	}
+
+	for _, subtitle := range pair.Subtitles {
+		if subtitle.Title != "" {
+			return subtitle.Title
+		}
+	}
+
+	return ""
+}
+
+func fileRenameOperations(file FileInfo, animeName string, template string, width int) []RenameOperation {
+	suffix := subtitleTagSuffix(file)
+
+	operations := []RenameOperation{{
+		OldPath: file.Path,
+		NewPath: filepath.Join(
+			filepath.Dir(file.Path),
+			formatFileName(template, animeName, file, suffix+file.Extension, width),
+		),
+	}}
+
+	for _, companion := range file.Companions {
+		companionExtension := suffix + strings.ToLower(filepath.Ext(companion))
+		operations = append(operations, RenameOperation{
+			OldPath: companion,
+			NewPath: filepath.Join(
+				filepath.Dir(companion),
+				formatFileName(template, animeName, file, companionExtension, width),
+			),
+		})
+	}
+
+	return operations
+}
+
+func formatFileName(template string, animeName string, file FileInfo, extension string, width int) string {
+	if template == "" {
+		template = DefaultTemplate
+	}
+
+	if file.Title == "" {
+		template = emptyTitlePattern.ReplaceAllString(template, "")
+	}
+
+	name := templateTokenPattern.ReplaceAllStringFunc(template, func(token string) string {
+		name, format, hasFormat := strings.Cut(strings.Trim(token, "{}"), ":")
+		switch {
+		case name == "season" && hasFormat:
+			return formatPaddedSeasonNumber(file, formatWidth(format))
+		case name == "episode" && hasFormat:
+			return formatPaddedEpisodeNumber(file, formatWidth(format))
+		}
+
+		switch name {
+		case "name":
+			return animeName
+		case "season":
+			return formatSeasonNumber(file)
+		case "episode":
+			return formatPaddedEpisodeNumber(file, width)
+		case "title":
+			return file.Title
+		case "ext":
+			return extension
+		default:
+			return token
+		}
+	})
+
+	if !strings.Contains(template, "{ext}") {
+		name += extension
+	}
+
+	return sanitizeFileName(name, reservedNameCharacters)
+}
+
+// sanitizeFileName replaces the characters in reserved that a name or title
+// brought into a file name. Colons become dashes, so "Re:Zero: Starting"
+// turns into "Re-Zero - Starting", quotes become apostrophes and the rest is
+// dropped.
+func sanitizeFileName(name string, reserved string) string {
+	var builder strings.Builder
+
+	for index, char := range name {
+		if !strings.ContainsRune(reserved, char) {
+			builder.WriteRune(char)
+			continue
+		}
+
+		switch {
+		case char == ':' && strings.HasPrefix(name[index+1:], " "):
+			builder.WriteString(" -")
+		case char == ':' || char == '/' || char == '\\':
+			builder.WriteRune('-')
+		case char == '"':
+			builder.WriteRune('\'')
+		}
+	}
+
+	return builder.String()
+}
+
+// moveIntoSeasonFolders points every operation into a "Season NN" folder
+// next to its target. Files that already sit in a season folder go to the
+// matching folder under the show directory instead of a nested one.
+func moveIntoSeasonFolders(operations []RenameOperation, pairs []FilePair) []RenameOperation {
+	seasons := map[string]int{}
+	for _, pair := range pairs {
+		for _, file := range append([]FileInfo{pair.Video}, pair.Subtitles...) {
+			seasons[file.Path] = file.Season
+			for _, companion := range file.Companions {
+				seasons[companion] = file.Season
+			}
+		}
+	}
+
+	moved := make([]RenameOperation, 0, len(operations))
+	for _, operation := range operations {
+		showDir := showDirectory(filepath.Dir(operation.NewPath))
+		operation.NewPath = filepath.Join(
+			showDir,
+			seasonFolderName(seasons[operation.OldPath]),
+			filepath.Base(operation.NewPath),
+		)
+		moved = append(moved, operation)
+	}
+
+	return moved
+}
+
+// moveSubtitlesNextToVideos retargets the subtitles of every pair, and
+// their companion files, into the folder of the video so players find them.
+func moveSubtitlesNextToVideos(operations []RenameOperation, pairs []FilePair) []RenameOperation {
+	videoDirs := map[string]string{}
+	for _, pair := range pairs {
+		for _, subtitle := range pair.Subtitles {
+			videoDirs[subtitle.Path] = filepath.Dir(pair.Video.Path)
+			for _, companion := range subtitle.Companions {
+				videoDirs[companion] = filepath.Dir(pair.Video.Path)
+			}
+		}
+	}
+
+	moved := make([]RenameOperation, 0, len(operations))
+	for _, operation := range operations {
+		if videoDir, ok := videoDirs[operation.OldPath]; ok {
+			operation.NewPath = filepath.Join(videoDir, filepath.Base(operation.NewPath))
+		}
+		moved = append(moved, operation)
+	}
+
+	return moved
+}
+
+func seasonFolderName(season int) string {
+	return fmt.Sprintf("Season %02d", season)
+}
+
+func showDirectory(directory string) string {
+	name := filepath.Base(directory)
+	for _, pattern := range seasonDirectoryPatterns {
+		if pattern.MatchString(name) {
+			return filepath.Dir(directory)
+		}
+	}
+
+	return directory
+}
+
+func formatSeasonNumber(file FileInfo) string {
+	return formatPaddedSeasonNumber(file, 2)
+}
+
+func formatPaddedSeasonNumber(file FileInfo, width int) string {
+	if file.Cour > 0 {
+		return fmt.Sprintf("%0*dP%02d", width, file.Season, file.Cour)
+	}
+
+	return fmt.Sprintf("%0*d", width, file.Season)
+}
+
+// formatWidth is the padding of a token format ValidateTemplate accepted,
+// 2 for "02d" and 0 for "d".
+func formatWidth(format string) int {
+	match := numberFormatPattern.FindStringSubmatch(format)
+	if match == nil || match[1] == "" {
+		return 0
+	}
+
+	width, _ := strconv.Atoi(match[1])
+	return width
+}
+
+func formatEpisodeNumber(file FileInfo) string {
+	return formatPaddedEpisodeNumber(file, 2)
+}
+
+func formatPaddedEpisodeNumber(file FileInfo, width int) string {
+	if file.EpisodeEnd > 0 {
+		return fmt.Sprintf("%0*d-E%0*d", width, file.Episode, width, file.EpisodeEnd)
+	}
+
+	if file.EpisodePart > 0 {
+		return fmt.Sprintf("%0*d.%d", width, file.Episode, file.EpisodePart)
+	}
+
+	return fmt.Sprintf("%0*d", width, file.Episode)
+}
+
+// preflightRenameOperations checks renames, with checkWritable testing the
+// folders they touch.
+func preflightRenameOperations(operations []RenameOperation, checkWritable func(directory string) error) error {
+	err := preflightRenameOperationsWith(operations, os.Stat, checkWritable)
+
+	// Renaming also takes the file out of its current folder, and the temp
+	// names of the first phase are created there.
+	issues := []string{}
+	checkedDirs := map[string]struct{}{}
+	for _, operation := range operations {
+		sourceDir := filepath.Dir(operation.OldPath)
+		if _, checked := checkedDirs[sourceDir]; checked || operation.AlreadyNamed() {
+			continue
+		}
+
+		checkedDirs[sourceDir] = struct{}{}
+		if writeErr := checkWritable(sourceDir); writeErr != nil {
+			issues = append(issues, writeErr.Error())
+		}
+	}
+
+	return withPreflightIssues(err, issues)
+}
+
+// withPreflightIssues adds issues found by a caller to the result of a
+// preflight check.
+func withPreflightIssues(err error, issues []string) error {
+	var preflightErr *PreflightError
+	if errors.As(err, &preflightErr) {
+		issues = append(slices.Clone(preflightErr.Issues), issues...)
+	} else if err != nil {
+		return err
+	}
+
+	if len(issues) > 0 {
+		return &PreflightError{Issues: issues}
+	}
+
+	return nil
+}
+
+func preflightRenameOperationsWith(
+	operations []RenameOperation,
+	statTarget func(string) (os.FileInfo, error),
+	checkWritable func(directory string) error,
+) error {
+	issues := []string{}
+
+	if len(operations) == 0 {
+		issues = append(issues, "no matched file pairs were found")
+	}
+
+	sourcePaths := map[string]struct{}{}
+	targetPaths := map[string]struct{}{}
+
+	for _, operation := range operations {
+		if strings.TrimSpace(operation.OldPath) == "" {
+			issues = append(issues, "operation contains empty source path")
+			continue
+		}
+
+		if strings.TrimSpace(operation.NewPath) == "" {
+			issues = append(issues, fmt.Sprintf("operation for %s contains empty target path", operation.OldPath))
+			continue
+		}
+
+		sourcePaths[operation.OldPath] = struct{}{}
+
+		if _, err := os.Stat(operation.OldPath); err != nil {
+			issues = append(issues, fmt.Sprintf("source file does not exist or is not readable: %s", operation.OldPath))
+			continue
+		}
+
+		if err := checkReadableFile(operation.OldPath); err != nil {
+			issues = append(issues, err.Error())
+			continue
+		}
+
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		if _, exists := targetPaths[operation.NewPath]; exists {
+			issues = append(issues, fmt.Sprintf("duplicate target path detected: %s", operation.NewPath))
+			continue
+		}
+
+		if err := checkTargetName(operation); err != nil {
+			issues = append(issues, err.Error())
+			continue
+		}
+
+		if err := checkPathLength(operation.NewPath); err != nil {
+			issues = append(issues, err.Error())
+			continue
+		}
+
+		targetPaths[operation.NewPath] = struct{}{}
+	}
+
+	targetDirs := map[string]struct{}{}
+	for targetPath := range targetPaths {
+		targetDirs[filepath.Dir(targetPath)] = struct{}{}
+	}
+
+	for targetDir := range targetDirs {
+		if err := checkTargetDirectory(targetDir, checkWritable); err != nil {
+			issues = append(issues, err.Error())
+		}
+	}
+
+	for targetPath := range targetPaths {
+		if _, exists := sourcePaths[targetPath]; exists {
+			continue
+		}
+
+		_, statErr := statTarget(targetPath)
+		if statErr == nil {
+			issues = append(issues, fmt.Sprintf("target path already exists: %s", targetPath))
+			continue
+		}
+
+		if !errors.Is(statErr, os.ErrNotExist) {
+			issues = append(issues, fmt.Sprintf("unable to validate target path %s: %v", targetPath, statErr))
+		}
+	}
+
+	if len(issues) > 0 {
+		return &PreflightError{Issues: issues}
+	}
+
+	return nil
+}
+
+// checkTargetName catches a target whose name is left empty, like ".mkv"
+// or " - S01E01.mkv" from an empty anime name, which would hide the file or
+// lose what it is. A name starting with a dot, like ".hack", is refused
+// too: the file would be hidden, and later scans skip hidden files.
+func checkTargetName(operation RenameOperation) error {
+	base := filepath.Base(operation.NewPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	if strings.Trim(stem, " -._") == "" || strings.ContainsAny(stem[:1], " -") {
+		return fmt.Errorf("target name %q for %s has no name before the episode or extension", base, operation.OldPath)
+	}
+
+	if strings.HasPrefix(stem, ".") {
+		return fmt.Errorf(
+			"target name %q for %s starts with a dot, which would hide the file from later runs; give a name without it",
+			base,
+			operation.OldPath,
+		)
+	}
+
+	return nil
+}
+
+// checkPathLength catches targets the file system would refuse as too
+// long, which os.Rename only reports halfway through a batch.
+func checkPathLength(path string) error {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolving target path %s: %w", path, err)
+	}
+
+	if length := pathLength(filepath.Base(absolutePath)); length > maxNameLength {
+		return fmt.Errorf("target file name is %d long, over the limit of %d: %s", length, maxNameLength, path)
+	}
+
+	if length := pathLength(absolutePath); length > maxPathLength {
+		return fmt.Errorf("target path is %d long, over the limit of %d: %s", length, maxPathLength, path)
+	}
+
+	return nil
+}
+
+// checkTargetDirectory walks up to the closest existing parent of a target
+// directory, since missing folders are created while renaming, and checks
+// that it can be written to with checkWritable.
+func checkTargetDirectory(directory string, checkWritable func(directory string) error) error {
+	for {
+		info, err := os.Stat(directory)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("target folder is not a directory: %s", directory)
+			}
+
+			return checkWritable(directory)
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to validate target folder %s: %v", directory, err)
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return nil
+		}
+
+		directory = parent
+	}
+}
+
+// checkWritableDirectory creates and removes a probe file, which also
+// catches read-only mounts and ACLs that the permission bits don't show.
+// Dry runs use skipWritableCheck instead, to leave the folders untouched.
+func checkWritableDirectory(directory string) error {
+	probe, err := os.CreateTemp(directory, ".anime-renamer-write-check-*")
+	if err != nil {
+		return fmt.Errorf("folder is not writable: %s", directory)
+	}
+
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func skipWritableCheck(string) error {
+	return nil
+}
+
+func checkReadableFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("source file is not readable: %s", path)
+	}
+	file.Close()
+
+	if err := checkFileNotInUse(path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func CountPendingOperations(operations []RenameOperation) int {
+	pending := 0
+
+	for _, operation := range operations {
+		if !operation.AlreadyNamed() {
+			pending++
+		}
+	}
+
+	return pending
+}
+
+func executeRenameOperations(operations []RenameOperation, progress ProgressFunc) error {
+	return executeRenameOperationsWith(operations, moveStrategy{move: os.Rename}, progress)
+}
+
+func executeRenameOperationsWith(
+	operations []RenameOperation,
+	strategy renameStrategy,
+	progress ProgressFunc,
+) error {
+	states, err := newRenameStates(operations)
+	if err != nil || len(states) == 0 {
+		return err
+	}
+
+	createdDirs := []string{}
+	rollback := func(executionErr *RenameExecutionError) error {
+		rollbackErr := errors.Join(
+			rollbackRenameStates(states, strategy),
+			removeCreatedDirectories(createdDirs),
+		)
+		if rollbackErr != nil {
+			return errors.Join(executionErr, fmt.Errorf("rollback failed: %w", rollbackErr))
+		}
+
+		return executionErr
+	}
+
+	for index := range states {
+		state := &states[index]
+		if err := strategy.Apply(RenameOperation{OldPath: state.CurrentPath, NewPath: state.TempPath}); err != nil {
+			return rollback(&RenameExecutionError{
+				Phase: "phase-one",
+				From:  state.CurrentPath,
+				To:    state.TempPath,
+				Err:   err,
+			})
+		}
+
+		state.CurrentPath = state.TempPath
+	}
+
+	for index := range states {
+		state := &states[index]
+		created, err := createTargetDirectory(filepath.Dir(state.NewPath))
+		createdDirs = append(createdDirs, created...)
+		if err == nil {
+			err = strategy.Apply(RenameOperation{OldPath: state.CurrentPath, NewPath: state.NewPath})
+		}
+
+		if err != nil {
+			return rollback(&RenameExecutionError{
+				Phase: "phase-two",
+				From:  state.CurrentPath,
+				To:    state.NewPath,
+				Err:   err,
+			})
+		}
+
+		state.CurrentPath = state.NewPath
+		progress.report(index+1, len(states))
+	}
+
+	return nil
+}
+
+func newRenameStates(operations []RenameOperation) ([]renameState, error) {
+	states := make([]renameState, 0, len(operations))
+
+	for index, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		tempPath, err := buildTempPath(operation.OldPath, index)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, renameState{
+			RenameOperation: operation,
+			TempPath:        tempPath,
+			CurrentPath:     operation.OldPath,
+		})
+	}
+
+	return states, nil
+}
+
+// executeRenameOperationsContinuingWith renames what it can and collects the
+// failures instead of rolling the batch back. A file that can't take its new
+// name is moved back from its temp name, and a name still held by a file
+// that failed to move away is never overwritten.
+func executeRenameOperationsContinuingWith(
+	operations []RenameOperation,
+	strategy renameStrategy,
+	progress ProgressFunc,
+) error {
+	states, err := newRenameStates(operations)
+	if err != nil {
+		return err
+	}
+
+	failures := []*RenameExecutionError{}
+	failed := make([]bool, len(states))
+	for index := range states {
+		state := &states[index]
+		if err := strategy.Apply(RenameOperation{OldPath: state.CurrentPath, NewPath: state.TempPath}); err != nil {
+			failures = append(failures, &RenameExecutionError{
+				Phase: "phase-one",
+				From:  state.OldPath,
+				To:    state.TempPath,
+				Err:   err,
+			})
+			failed[index] = true
+			continue
+		}
+
+		state.CurrentPath = state.TempPath
+	}
+
+	done := 0
+	for index := range states {
+		if failed[index] {
+			continue
+		}
+
+		state := &states[index]
+		err := moveUnlessTaken(state.CurrentPath, state.NewPath, strategy)
+		if err != nil {
+			failure := &RenameExecutionError{Phase: "phase-two", From: state.OldPath, To: state.NewPath, Err: err}
+			if restoreErr := moveUnlessTaken(state.CurrentPath, state.OldPath, strategy); restoreErr != nil {
+				failure.Err = errors.Join(
+					err,
+					fmt.Errorf("moving it back failed, it is still named %s: %w", state.CurrentPath, restoreErr),
+				)
+			}
+
+			failures = append(failures, failure)
+			continue
+		}
+
+		done++
+		progress.report(done, len(states))
+	}
+
+	if len(failures) > 0 {
+		return &PartialExecutionError{Failures: failures}
+	}
+
+	return nil
+}
+
+func moveUnlessTaken(oldPath string, newPath string, strategy renameStrategy) error {
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("%s is still taken: %w", newPath, os.ErrExist)
+	}
+
+	if _, err := createTargetDirectory(filepath.Dir(newPath)); err != nil {
+		return err
+	}
+
+	return strategy.Apply(RenameOperation{OldPath: oldPath, NewPath: newPath})
+}
+
+// createTargetDirectory creates a target folder and its missing parents and
+// returns the folders it created, outermost first, so a rollback can remove
+// them again.
+func createTargetDirectory(directory string) ([]string, error) {
+	missing := []string{}
+	for {
+		_, err := os.Stat(directory)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("checking target folder %s: %w", directory, err)
+		}
+
+		missing = append(missing, directory)
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			break
+		}
+
+		directory = parent
+	}
+
+	created := []string{}
+	for index := len(missing) - 1; index >= 0; index-- {
+		if err := os.Mkdir(missing[index], 0o755); err != nil {
+			return created, fmt.Errorf("creating target folder %s: %w", missing[index], err)
+		}
+
+		created = append(created, missing[index])
+	}
+
+	return created, nil
+}
+
+func removeCreatedDirectories(directories []string) error {
+	removeErrors := []error{}
+
+	for index := len(directories) - 1; index >= 0; index-- {
+		if err := os.Remove(directories[index]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			removeErrors = append(removeErrors, fmt.Errorf("removing created folder %s: %w", directories[index], err))
+		}
+	}
+
+	return errors.Join(removeErrors...)
+}
+
+func buildTempPath(oldPath string, index int) (string, error) {
+	dir := filepath.Dir(oldPath)
+	base := filepath.Base(oldPath)
+
+	for attempt := range 1000 {
+		candidate := filepath.Join(
+			dir,
+			fmt.Sprintf(".anime-renamer-tmp-%d-%d-%s", os.Getpid(), index*1000+attempt, base),
+		)
+
+		_, err := os.Stat(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("checking temp path %s: %w", candidate, err)
+		}
+	}
+
+	return "", fmt.Errorf("failed to allocate temp path for %s", oldPath)
+}
+
+// rollbackRenameStates moves files back in two phases like the rename
+// itself: everything goes to its temp path first, so a file returning to its
+// original name never lands on a file that still has to leave it, as in a
+// cyclic plan.
+func rollbackRenameStates(states []renameState, strategy renameStrategy) error {
+	rollbackErrors := []error{}
+
+	move := func(state *renameState, target string) {
+		_, statErr := os.Stat(state.CurrentPath)
+		if statErr != nil {
+			if errors.Is(statErr, os.ErrNotExist) {
+				rollbackErrors = append(
+					rollbackErrors,
+					fmt.Errorf("rollback source disappeared: %s", state.CurrentPath),
+				)
+				return
+			}
+
+			rollbackErrors = append(
+				rollbackErrors,
+				fmt.Errorf("rollback stat failed for %s: %w", state.CurrentPath, statErr),
+			)
+			return
+		}
+
+		if err := strategy.Undo(RenameOperation{OldPath: target, NewPath: state.CurrentPath}); err != nil {
+			rollbackErrors = append(
+				rollbackErrors,
+				fmt.Errorf("rollback failed (%s -> %s): %w", state.CurrentPath, target, err),
+			)
+			return
+		}
+
+		state.CurrentPath = target
+	}
+
+	for index := len(states) - 1; index >= 0; index-- {
+		state := &states[index]
+		if state.CurrentPath != state.OldPath && state.CurrentPath != state.TempPath {
+			move(state, state.TempPath)
+		}
+	}
+
+	for index := len(states) - 1; index >= 0; index-- {
+		state := &states[index]
+		if state.CurrentPath == state.TempPath {
+			move(state, state.OldPath)
+		}
+	}
+
+	if len(rollbackErrors) > 0 {
+		return errors.Join(rollbackErrors...)
+	}
+
+	return nil
+}
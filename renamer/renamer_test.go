@@ -0,0 +1,2852 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExtractSeasonAndEpisode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		filename    string
+		wantSeason  int
+		wantEpisode int
+		notFound    bool
+	}{
+		{
+			name:        "S and episode with dash",
+			filename:    "Show S2 - 03.mkv",
+			wantSeason:  2,
+			wantEpisode: 3,
+		},
+		{
+			name:        "S and E compact",
+			filename:    "Show S01E12.ass",
+			wantSeason:  1,
+			wantEpisode: 12,
+		},
+		{
+			name:        "episode only with E prefix",
+			filename:    "Show E09.mp4",
+			wantSeason:  1,
+			wantEpisode: 9,
+		},
+		{
+			name:        "trailing numeric episode",
+			filename:    "Show 021.srt",
+			wantSeason:  1,
+			wantEpisode: 21,
+		},
+		{
+			name:        "ordinal season",
+			filename:    "Show 2nd Season - 05.mkv",
+			wantSeason:  2,
+			wantEpisode: 5,
+		},
+		{
+			name:        "ordinal season after a dash",
+			filename:    "Show - 2nd Season - 05.mkv",
+			wantSeason:  2,
+			wantEpisode: 5,
+		},
+		{
+			name:        "ordinal season with E prefix",
+			filename:    "Show 3rd Season E02.mkv",
+			wantSeason:  3,
+			wantEpisode: 2,
+		},
+		{
+			name:        "spelled-out ordinal season",
+			filename:    "Show Second Season - 07.mkv",
+			wantSeason:  2,
+			wantEpisode: 7,
+		},
+		{
+			name:        "final season without a number",
+			filename:    "Show Final Season - 04.mkv",
+			wantSeason:  1,
+			wantEpisode: 4,
+		},
+		{
+			name:        "hash-prefixed episode",
+			filename:    "[Group] Show #05 [1080p].mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "ep prefix",
+			filename:    "Show ep05.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "episode word with a single digit",
+			filename:    "Show Episode 5.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "ep with a dot",
+			filename:    "Show Ep. 12 - Title.mkv",
+			wantSeason:  1,
+			wantEpisode: 12,
+		},
+		{
+			name:        "ep prefix after an underscore",
+			filename:    "Show_Ep03.mkv",
+			wantSeason:  1,
+			wantEpisode: 3,
+		},
+		{
+			name:        "ep prefix after a season",
+			filename:    "Show Season 2 Ep03.mkv",
+			wantSeason:  2,
+			wantEpisode: 3,
+		},
+		{
+			name:        "year before the episode",
+			filename:    "Show (2023) - 05.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "resolution before the episode",
+			filename:    "Show 1080p 05.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "dashed resolution and year",
+			filename:    "Show - 2023 - 720p - 06.mkv",
+			wantSeason:  1,
+			wantEpisode: 6,
+		},
+		{
+			name:        "three-digit episode 100",
+			filename:    "Show 100.mkv",
+			wantSeason:  1,
+			wantEpisode: 100,
+		},
+		{
+			name:        "three-digit episode after dash",
+			filename:    "Show - 150.mkv",
+			wantSeason:  1,
+			wantEpisode: 150,
+		},
+		{
+			name:        "three-digit episode 999",
+			filename:    "Show 999.srt",
+			wantSeason:  1,
+			wantEpisode: 999,
+		},
+		{
+			name:        "4K resolution before the episode",
+			filename:    "Show 2160p 05.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "resolution before a three-digit episode",
+			filename:    "Show 1080p 100.mkv",
+			wantSeason:  1,
+			wantEpisode: 100,
+		},
+		{
+			name:        "four-digit episode 1000",
+			filename:    "One Piece 1000.mkv",
+			wantSeason:  1,
+			wantEpisode: 1000,
+		},
+		{
+			name:        "four-digit episode 1015",
+			filename:    "[Group] One Piece 1015 [1080p].mkv",
+			wantSeason:  1,
+			wantEpisode: 1015,
+		},
+		{
+			name:        "parenthesized year is not an episode",
+			filename:    "Show (2019) 05.mkv",
+			wantSeason:  1,
+			wantEpisode: 5,
+		},
+		{
+			name:        "year alone is not an episode",
+			filename:    "Show (2019).mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+			notFound:    true,
+		},
+		{
+			name:        "japanese title",
+			filename:    "進撃の巨人 - 01.mkv",
+			wantSeason:  1,
+			wantEpisode: 1,
+		},
+		{
+			name:        "full-width episode digits",
+			filename:    "進撃の巨人 - ０１.mkv",
+			wantSeason:  1,
+			wantEpisode: 1,
+		},
+		{
+			name:        "full-width season and episode with ideographic space",
+			filename:    "進撃の巨人　Ｓ０２Ｅ０３.mkv",
+			wantSeason:  2,
+			wantEpisode: 3,
+		},
+		{
+			name:        "episode in square brackets",
+			filename:    "Show [12].mkv",
+			wantSeason:  1,
+			wantEpisode: 12,
+		},
+		{
+			name:        "episode in parentheses",
+			filename:    "[Group] Show (12) [1080p].mkv",
+			wantSeason:  1,
+			wantEpisode: 12,
+		},
+		{
+			name:        "bracketed resolution and hash are not episodes",
+			filename:    "Show [1080p] [A1B2] - 07.mkv",
+			wantSeason:  1,
+			wantEpisode: 7,
+		},
+		{
+			name:        "bracketed resolution alone is not an episode",
+			filename:    "Show [1080p].mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+			notFound:    true,
+		},
+		{
+			name:        "bracketed hex hash alone is not an episode",
+			filename:    "Show [A1B2].mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+			notFound:    true,
+		},
+		{
+			name:        "bracketed eight digit hash is not an episode",
+			filename:    "Show [12345678].mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+			notFound:    true,
+		},
+		{
+			name:        "full-width S and E",
+			filename:    "Show Ｓ１Ｅ０１.mkv",
+			wantSeason:  1,
+			wantEpisode: 1,
+		},
+		{
+			name:        "roman numeral season",
+			filename:    "Show Season III - 04.mkv",
+			wantSeason:  3,
+			wantEpisode: 4,
+		},
+		{
+			name:        "roman numeral inside a word is left alone",
+			filename:    "Show Seasonings II - 04.mkv",
+			wantSeason:  1,
+			wantEpisode: 4,
+		},
+		{
+			name:        "S and episode with space",
+			filename:    "Show S3 07.mkv",
+			wantSeason:  3,
+			wantEpisode: 7,
+		},
+		{
+			name:        "parenthesized episode after dash",
+			filename:    "Show - (11).ass",
+			wantSeason:  1,
+			wantEpisode: 11,
+		},
+		{
+			name:        "no episode",
+			filename:    "Show Finale.mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+			notFound:    true,
+		},
+		{
+			name:        "episode zero prologue",
+			filename:    "Show E00.mkv",
+			wantSeason:  1,
+			wantEpisode: 0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			gotSeason, gotEpisode, gotFound := extractSeasonAndEpisode(testCase.filename)
+			if gotSeason != testCase.wantSeason || gotEpisode != testCase.wantEpisode || gotFound == testCase.notFound {
+				t.Fatalf(
+					"extractSeasonAndEpisode(%q) = (%d, %d, %t), want (%d, %d, %t)",
+					testCase.filename,
+					gotSeason,
+					gotEpisode,
+					gotFound,
+					testCase.wantSeason,
+					testCase.wantEpisode,
+					!testCase.notFound,
+				)
+			}
+		})
+	}
+}
+
+func TestParseEpisodeDecimalEpisodes(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     episodeMatch
+	}{
+		{filename: "Show - 07.5.mkv", want: episodeMatch{Season: 1, Episode: 7, EpisodePart: 5}},
+		{filename: "Show S01E11.5.ass", want: episodeMatch{Season: 1, Episode: 11, EpisodePart: 5, HasSeason: true}},
+		{filename: "Show - 08.mkv", want: episodeMatch{Season: 1, Episode: 8}},
+		{filename: "Show E03.720p.mkv", want: episodeMatch{Season: 1, Episode: 3}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			if got := parseEpisode(testCase.filename); got != testCase.want {
+				t.Fatalf("parseEpisode(%q) = %+v, want %+v", testCase.filename, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestDecimalEpisodesPairAndRename(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "Show - 07.mkv", Season: 1, Episode: 7, Extension: ".mkv"},
+		{Path: "Show - 07.5.mkv", Season: 1, Episode: 7, EpisodePart: 5, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: "Show - 07.5.srt", Season: 1, Episode: 7, EpisodePart: 5, Extension: ".srt"},
+		{Path: "Show - 07.srt", Season: 1, Episode: 7, Extension: ".srt"},
+	}
+
+	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 2 || len(unmatched) != 0 {
+		t.Fatalf("expected 2 pairs and no unmatched files, got %d pairs and %d unmatched", len(pairs), len(unmatched))
+	}
+
+	if pairs[1].Subtitles[0].Path != "Show - 07.5.srt" {
+		t.Fatalf("expected 7.5 video to pair with 7.5 subtitle, got %s", pairs[1].Subtitles[0].Path)
+	}
+
+	operations := buildRenameOperations(pairs[1:], "Anime", DefaultTemplate)
+	if got := filepath.Base(operations[0].NewPath); got != "Anime - S01E07.5.mkv" {
+		t.Fatalf("expected decimal episode name, got %s", got)
+	}
+}
+
+func TestParseEpisodeRanges(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     episodeMatch
+	}{
+		{filename: "Show - 01-02.mkv", want: episodeMatch{Season: 1, Episode: 1, EpisodeEnd: 2}},
+		{filename: "Show S02E05-E06.srt", want: episodeMatch{Season: 2, Episode: 5, EpisodeEnd: 6, HasSeason: true}},
+		{filename: "Show E11-12.mkv", want: episodeMatch{Season: 1, Episode: 11, EpisodeEnd: 12}},
+		{filename: "Show - 03-1080p.mkv", want: episodeMatch{Season: 1, Episode: 3}},
+		{filename: "Show - 04-03.mkv", want: episodeMatch{Season: 1, Episode: 4}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			if got := parseEpisode(testCase.filename); got != testCase.want {
+				t.Fatalf("parseEpisode(%q) = %+v, want %+v", testCase.filename, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestEpisodeRangesPairAndRename(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "Show - 01-02.mkv", Season: 1, Episode: 1, EpisodeEnd: 2, Extension: ".mkv"},
+		{Path: "Show - 03-04.mkv", Season: 1, Episode: 3, EpisodeEnd: 4, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: "Show - 01-02.srt", Season: 1, Episode: 1, EpisodeEnd: 2, Extension: ".srt"},
+		{Path: "Show - 03.srt", Season: 1, Episode: 3, Extension: ".srt"},
+		{Path: "Show - 04.srt", Season: 1, Episode: 4, Extension: ".srt"},
+	}
+
+	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 2 || pairs[0].PartialRange || !pairs[1].PartialRange {
+		t.Fatalf("expected a full and a partial range pair, got %+v", pairs)
+	}
+
+	if len(unmatched) != 1 || unmatched[0].Path != "Show - 04.srt" {
+		t.Fatalf("expected the second episode's subtitle to stay unmatched, got %+v", unmatched)
+	}
+
+	want := []string{"Anime - S01E01-E02.mkv", "Anime - S01E01-E02.srt", "Anime - S01E03-E04.mkv", "Anime - S01E03-E04.srt"}
+	for index, operation := range buildRenameOperations(pairs, "Anime", DefaultTemplate) {
+		if got := filepath.Base(operation.NewPath); got != want[index] {
+			t.Fatalf("operation %d target = %q, want %q", index, got, want[index])
+		}
+	}
+}
+
+func TestParseEpisodeCours(t *testing.T) {
+	testCases := []struct {
+		filename string
+		want     episodeMatch
+	}{
+		{filename: "Show Part 2 - 03.mkv", want: episodeMatch{Season: 1, Episode: 3, Cour: 2}},
+		{filename: "Show Cour 2 - 03.srt", want: episodeMatch{Season: 1, Episode: 3, Cour: 2}},
+		{filename: "Show Part2 E04.mkv", want: episodeMatch{Season: 1, Episode: 4, Cour: 2}},
+		{filename: "Show S2 Part 2 - 05.mkv", want: episodeMatch{Season: 2, Episode: 5, Cour: 2, HasSeason: true}},
+		{filename: "Show Season 2 Part 2 - 05.mkv", want: episodeMatch{Season: 2, Episode: 5, Cour: 2, HasSeason: true}},
+		{filename: "Show - 05 - Part 1 of the Journey.mkv", want: episodeMatch{Season: 1, Episode: 5}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			if got := parseEpisode(testCase.filename); got != testCase.want {
+				t.Fatalf("parseEpisode(%q) = %+v, want %+v", testCase.filename, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestCoursPairAndRename(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "Show Part 1 - 03.mkv", Season: 1, Episode: 3, Cour: 1, Extension: ".mkv"},
+		{Path: "Show Part 2 - 03.mkv", Season: 1, Episode: 3, Cour: 2, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: "Show Cour 2 - 03.srt", Season: 1, Episode: 3, Cour: 2, Extension: ".srt"},
+		{Path: "Show Cour 1 - 03.srt", Season: 1, Episode: 3, Cour: 1, Extension: ".srt"},
+	}
+
+	videoFiles, collisions, _ := excludeEpisodeCollisions(videoFiles, VideoExtensions, false)
+	if len(collisions) != 0 {
+		t.Fatalf("expected episodes from different parts not to collide, got %+v", collisions)
+	}
+
+	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 2 || len(unmatched) != 0 || pairs[1].Subtitles[0].Path != "Show Cour 2 - 03.srt" {
+		t.Fatalf("expected each part to pair with its own subtitle, got %+v and %+v", pairs, unmatched)
+	}
+
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+	if got := operations[2].NewPath; got != "Anime - S01P02E03.mkv" {
+		t.Fatalf("expected the part in the season, got %s", got)
+	}
+
+	folded, _ := createFilePairs(foldCoursIntoSeasons(videoFiles), foldCoursIntoSeasons(subtitleFiles))
+	operations = buildRenameOperations(folded, "Anime", DefaultTemplate)
+	if got := operations[2].NewPath; got != "Anime - S02E03.mkv" {
+		t.Fatalf("expected part 2 folded into season 2, got %s", got)
+	}
+}
+
+func TestParseEpisodeSpecials(t *testing.T) {
+	testCases := []struct {
+		filename    string
+		wantEpisode int
+	}{
+		{filename: "Show OVA 01.mkv", wantEpisode: 1},
+		{filename: "Show ONA 3.srt", wantEpisode: 3},
+		{filename: "Show - Special 2.srt", wantEpisode: 2},
+		{filename: "Show SP02.ass", wantEpisode: 2},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			got := parseEpisode(testCase.filename)
+			if got.Season != 0 || got.Episode != testCase.wantEpisode || !got.HasSeason {
+				t.Fatalf("parseEpisode(%q) = %+v, want season 0 episode %d", testCase.filename, got, testCase.wantEpisode)
+			}
+		})
+	}
+
+	pairs, unmatched := createFilePairs(
+		[]FileInfo{
+			{Path: "Show OVA 01.mkv", Season: 0, Episode: 1, Extension: ".mkv"},
+			{Path: "Show - 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+		},
+		[]FileInfo{{Path: "Show OVA 01.srt", Season: 0, Episode: 1, Extension: ".srt"}},
+	)
+	if len(pairs) != 1 || len(unmatched) != 1 || pairs[0].Video.Path != "Show OVA 01.mkv" {
+		t.Fatalf("expected OVA video to pair with OVA subtitle only, got %+v", pairs)
+	}
+
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+	if got := filepath.Base(operations[0].NewPath); got != "Anime - S00E01.mkv" {
+		t.Fatalf("expected season 0 name, got %s", got)
+	}
+}
+
+func TestExtractSeasonAndEpisodeNamed(t *testing.T) {
+	testCases := []struct {
+		filename    string
+		wantSeason  int
+		wantEpisode int
+		wantPattern string
+	}{
+		{filename: "Show S2 - 03.mkv", wantSeason: 2, wantEpisode: 3, wantPattern: "season-dash"},
+		{filename: "Show S01E12.ass", wantSeason: 1, wantEpisode: 12, wantPattern: "season-episode"},
+		{filename: "Show E09.mp4", wantSeason: 1, wantEpisode: 9, wantPattern: "episode"},
+		{filename: "Show (2023) - 05.mkv", wantSeason: 1, wantEpisode: 5, wantPattern: "dash"},
+		{filename: "Show Episode 5.mkv", wantSeason: 1, wantEpisode: 5, wantPattern: "ep"},
+		{filename: "Show #05.mkv", wantSeason: 1, wantEpisode: 5, wantPattern: "hash"},
+		{filename: "Show [12][1080p].mkv", wantSeason: 1, wantEpisode: 12, wantPattern: "brackets"},
+		{filename: "Show 1080p 05.mkv", wantSeason: 1, wantEpisode: 5, wantPattern: "trailing"},
+		{filename: "Show OVA 02.mkv", wantSeason: 0, wantEpisode: 2, wantPattern: "special"},
+		{filename: "Show.mkv", wantSeason: 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			season, episode, pattern := extractSeasonAndEpisodeNamed(testCase.filename)
+			if season != testCase.wantSeason || episode != testCase.wantEpisode || pattern != testCase.wantPattern {
+				t.Fatalf(
+					"extractSeasonAndEpisodeNamed(%q) = (%d, %d, %q), want (%d, %d, %q)",
+					testCase.filename, season, episode, pattern,
+					testCase.wantSeason, testCase.wantEpisode, testCase.wantPattern,
+				)
+			}
+		})
+	}
+
+	if len(episodePatternNames) != len(episodePatterns) {
+		t.Fatalf("%d pattern names for %d patterns", len(episodePatternNames), len(episodePatterns))
+	}
+
+	custom, err := combineEpisodePatterns(episodePatterns, []string{`No\.(?P<episode>\d+)`}, true)
+	if err != nil {
+		t.Fatalf("combine patterns: %v", err)
+	}
+
+	if name := episodePatternName(custom, 1); name != `custom No\.(?P<episode>\d+)` {
+		t.Fatalf("custom pattern name = %q", name)
+	}
+
+	if name := episodePatternName(custom, 2); name != "season-dash" {
+		t.Fatalf("expected built-in names after custom patterns, got %q", name)
+	}
+}
+
+func TestEpisodePatternsHaveNamedGroups(t *testing.T) {
+	for _, pattern := range episodePatterns {
+		if pattern.SubexpIndex("episode") < 0 {
+			t.Fatalf("built-in pattern %s has no episode group", pattern)
+		}
+
+		for _, name := range pattern.SubexpNames()[1:] {
+			if name != "season" && name != "episode" && name != "part" {
+				t.Fatalf("built-in pattern %s has an unnamed or unknown group %q", pattern, name)
+			}
+		}
+	}
+}
+
+func TestCustomEpisodePatterns(t *testing.T) {
+	patterns, err := combineEpisodePatterns(episodePatterns, []string{`No\.(?P<episode>\d+)`}, false)
+	if err != nil {
+		t.Fatalf("combine patterns: %v", err)
+	}
+
+	if got := parseEpisodeWith("[Group] Show No.05.mkv", patterns); got.Episode != 5 || got.Season != 1 {
+		t.Fatalf("expected the custom pattern to find episode 5, got %+v", got)
+	}
+
+	if got := parseEpisodeWith("[Group] Show No.05.mkv", episodePatterns); got.Episode != 0 {
+		t.Fatalf("expected the built-in patterns alone to miss the episode, got %+v", got)
+	}
+
+	patterns, err = combineEpisodePatterns(episodePatterns, []string{`Vol(?P<season>\d+) - (?P<episode>\d+)`}, true)
+	if err != nil {
+		t.Fatalf("combine patterns: %v", err)
+	}
+
+	if got := parseEpisodeWith("Show Vol2 - 07.mkv", patterns); got.Season != 2 || got.Episode != 7 || !got.HasSeason {
+		t.Fatalf("expected a pattern tried first to win, got %+v", got)
+	}
+
+	if err := ValidateEpisodePattern(`#(\d+)`); err == nil {
+		t.Fatal("expected a pattern without an episode group to be rejected")
+	}
+}
+
+func TestScanReadsTitlesAndNamesWithCustomPatterns(t *testing.T) {
+	dir := t.TempDir()
+	createSourceFiles(t, dir, "Show No.05 - The Title.mkv", "Show No.05 - The Title.srt")
+
+	result, err := Scan(dir, ScanOptions{EpisodePatterns: []string{`No\.(?P<episode>\d+)`}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	if len(result.Videos) != 1 || result.Videos[0].Title != "The Title" {
+		t.Fatalf("expected the custom pattern to find the episode title, got %+v", result.Videos)
+	}
+
+	if name := InferAnimeName(result.Videos, dir, ReleaseNoiseTokens, result.Patterns); name != "Show" {
+		t.Fatalf("InferAnimeName = %q, want %q", name, "Show")
+	}
+}
+
+func TestScanReadsTitlesAndNamesInPatternOrder(t *testing.T) {
+	dir := t.TempDir()
+	createSourceFiles(t, dir, "Show E10 Remaster 05 - Homecoming.mkv")
+
+	result, err := Scan(dir, ScanOptions{PatternOrder: []string{"trailing"}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	if len(result.Videos) != 1 || result.Videos[0].Episode != 5 || result.Videos[0].Title != "Homecoming" {
+		t.Fatalf("expected episode 5 titled Homecoming, got %+v", result.Videos)
+	}
+
+	name := InferAnimeName(result.Videos, dir, ReleaseNoiseTokens, result.Patterns)
+	if name != "Show E10 Remaster" {
+		t.Fatalf("InferAnimeName = %q, want %q", name, "Show E10 Remaster")
+	}
+}
+
+func TestScanReadsTagsOfConfiguredSubtitleExtensions(t *testing.T) {
+	dir := t.TempDir()
+	createSourceFiles(t, dir, "Show - 05.mkv", "Show - 05.en.sup")
+
+	result, err := Scan(dir, ScanOptions{SubtitleExtensions: []string{".sup"}})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	if len(result.Subtitles) != 1 || result.Subtitles[0].Language != "en" || result.Subtitles[0].Episode != 5 {
+		t.Fatalf("expected an English subtitle of episode 5, got %+v", result.Subtitles)
+	}
+
+	parse, err := ParseName("Show - 05.en.sup", ScanOptions{SubtitleExtensions: []string{".sup"}})
+	if err != nil || parse.Language != "en" {
+		t.Fatalf("ParseName = %+v, %v, want the language en", parse, err)
+	}
+}
+
+func TestClassifyExtra(t *testing.T) {
+	testCases := []struct {
+		filename  string
+		wantLabel string
+		wantExtra bool
+	}{
+		{filename: "[Group] Show - NCOP1 [1080p].mkv", wantLabel: "NCOP1", wantExtra: true},
+		{filename: "Show NCED 02.ass", wantLabel: "NCED2", wantExtra: true},
+		{filename: "Show - Creditless Ending.mkv", wantLabel: "NCED", wantExtra: true},
+		{filename: "Show - Clean Opening 3.srt", wantLabel: "NCOP3", wantExtra: true},
+		{filename: "Show - 01.mkv"},
+		{filename: "Enhanced Edition - 01.mkv"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			label, extra := classifyExtra(testCase.filename)
+			if label != testCase.wantLabel || extra != testCase.wantExtra {
+				t.Fatalf(
+					"classifyExtra(%q) = %q, %t, want %q, %t",
+					testCase.filename,
+					label,
+					extra,
+					testCase.wantLabel,
+					testCase.wantExtra,
+				)
+			}
+		})
+	}
+
+	extensionSet := map[string]struct{}{".mkv": {}}
+	if file, ok := parseFileInfo("Show NCOP 01.mkv", "", extensionSet, SubtitleExtensions, episodePatterns); ok {
+		t.Fatalf("expected the creditless opening to be skipped, got %+v", file)
+	}
+}
+
+func TestCreateFilePairsAcrossEpisodeStyles(t *testing.T) {
+	testCases := []struct {
+		name       string
+		video      string
+		subtitle   string
+		wantPaired bool
+		wantFuzzy  bool
+		wantSeason int
+	}{
+		{name: "E token and dash", video: "Show E01.mkv", subtitle: "Show - 01.srt", wantPaired: true, wantSeason: 1},
+		{name: "season token and dash", video: "Show S1E01.mkv", subtitle: "Show - 01.srt", wantPaired: true, wantSeason: 1},
+		{name: "bare number and season token", video: "Show 01.mkv", subtitle: "Show S01E01.ass", wantPaired: true, wantSeason: 1},
+		{name: "bracketed dash and E token", video: "Show - (01).mkv", subtitle: "Show E01.srt", wantPaired: true, wantSeason: 1},
+		{
+			name:       "season 2 video and dash subtitle",
+			video:      "Show S2E01.mkv",
+			subtitle:   "Show - 01.srt",
+			wantPaired: true,
+			wantFuzzy:  true,
+			wantSeason: 2,
+		},
+		{
+			name:       "dash video and season 2 subtitle",
+			video:      "Show - 01.mkv",
+			subtitle:   "Show S02E01.srt",
+			wantPaired: true,
+			wantFuzzy:  true,
+			wantSeason: 2,
+		},
+		{name: "different seasons on both sides", video: "Show S02E01.mkv", subtitle: "Show S01E01.srt"},
+		{name: "different episodes", video: "Show E01.mkv", subtitle: "Show - 02.srt"},
+	}
+
+	extensionSet := map[string]struct{}{".mkv": {}, ".srt": {}, ".ass": {}}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			video, ok := parseFileInfo(testCase.video, "", extensionSet, SubtitleExtensions, episodePatterns)
+			if !ok {
+				t.Fatalf("expected %s to parse", testCase.video)
+			}
+
+			subtitle, ok := parseFileInfo(testCase.subtitle, "", extensionSet, SubtitleExtensions, episodePatterns)
+			if !ok {
+				t.Fatalf("expected %s to parse", testCase.subtitle)
+			}
+
+			pairs, unmatched := createFilePairs([]FileInfo{video}, []FileInfo{subtitle})
+			if !testCase.wantPaired {
+				if len(pairs) != 0 || len(unmatched) != 2 {
+					t.Fatalf("expected no pair, got %+v", pairs)
+				}
+
+				return
+			}
+
+			if len(pairs) != 1 || len(unmatched) != 0 {
+				t.Fatalf("expected one pair, got %+v and unmatched %+v", pairs, unmatched)
+			}
+
+			pair := pairs[0]
+			if pair.Fuzzy != testCase.wantFuzzy || pair.Video.Season != testCase.wantSeason ||
+				pair.Subtitles[0].Season != testCase.wantSeason {
+				t.Fatalf(
+					"pair = fuzzy %t, seasons %d/%d, want fuzzy %t, season %d",
+					pair.Fuzzy,
+					pair.Video.Season,
+					pair.Subtitles[0].Season,
+					testCase.wantFuzzy,
+					testCase.wantSeason,
+				)
+			}
+		})
+	}
+}
+
+func TestCreateFilePairsFallsBackToEpisodeOnly(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "Show - 05.mkv", Season: 1, Episode: 5, Extension: ".mkv"},
+		{Path: "Show - 06.mkv", Season: 1, Episode: 6, Extension: ".mkv"},
+		{Path: "Show - 07.mkv", Season: 1, Episode: 7, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: "Show S2E05.srt", Season: 2, Episode: 5, Extension: ".srt", HasSeason: true},
+		{Path: "Show S2E07.srt", Season: 2, Episode: 7, Extension: ".srt", HasSeason: true},
+		{Path: "Show S3E07.srt", Season: 3, Episode: 7, Extension: ".srt", HasSeason: true},
+	}
+
+	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 1 {
+		t.Fatalf("expected only the unambiguous episode 5 to pair, got %d pairs", len(pairs))
+	}
+
+	pair := pairs[0]
+	if !pair.Fuzzy || pair.Video.Path != "Show - 05.mkv" || pair.Subtitles[0].Path != "Show S2E05.srt" {
+		t.Fatalf("unexpected fuzzy pair: %+v", pair)
+	}
+
+	if pair.Video.Season != 2 {
+		t.Fatalf("expected video to take the subtitle season, got %d", pair.Video.Season)
+	}
+
+	if len(unmatched) != 4 {
+		t.Fatalf("expected 4 unmatched files, got %d", len(unmatched))
+	}
+}
+
+func TestPairBySimilarName(t *testing.T) {
+	unmatched := []FileInfo{
+		{Path: "Show - 05 - Jupiter Jazz.mkv", Season: 1, Episode: 5, Extension: ".mkv"},
+		{Path: "Show - 06 - Ganymede Elegy.mkv", Season: 1, Episode: 6, Extension: ".mkv"},
+		{Path: "[Subs] Show - 17 - Jupiter Jazz.en.srt", Season: 1, Episode: 17, Language: "en", Extension: ".srt"},
+		{Path: "Completely Different Release 18.srt", Season: 1, Episode: 18, Extension: ".srt"},
+	}
+
+	pairs, remaining := pairBySimilarName(unmatched, VideoExtensions, ReleaseNoiseTokens)
+	if len(pairs) != 1 || !pairs[0].SimilarName || pairs[0].Video.Path != "Show - 05 - Jupiter Jazz.mkv" {
+		t.Fatalf("expected the Jupiter Jazz files to pair by name, got %+v", pairs)
+	}
+
+	if subtitle := pairs[0].Subtitles[0]; subtitle.Episode != 5 || subtitle.Language != "en" {
+		t.Fatalf("expected the subtitle to take the video's episode and keep its tag, got %+v", subtitle)
+	}
+
+	if len(remaining) != 2 || remaining[0].Path != "Show - 06 - Ganymede Elegy.mkv" ||
+		remaining[1].Path != "Completely Different Release 18.srt" {
+		t.Fatalf("expected dissimilar files to stay unmatched, got %+v", remaining)
+	}
+}
+
+func TestPairBySimilarNameSkipsTies(t *testing.T) {
+	unmatched := []FileInfo{
+		{Path: "Show - 05.mkv", Season: 1, Episode: 5, Extension: ".mkv"},
+		{Path: "Show - 17.srt", Season: 1, Episode: 17, Extension: ".srt"},
+		{Path: "Show - 18.srt", Season: 1, Episode: 18, Extension: ".srt"},
+	}
+
+	if pairs, remaining := pairBySimilarName(unmatched, VideoExtensions, ReleaseNoiseTokens); len(pairs) != 0 || len(remaining) != 3 {
+		t.Fatalf("expected equally similar subtitles to stay unmatched, got %+v", pairs)
+	}
+}
+
+func TestSplitSubtitleTags(t *testing.T) {
+	testCases := []struct {
+		filename       string
+		wantFilename   string
+		wantLanguage   string
+		wantQualifiers string
+	}{
+		{filename: "Show 01.en.srt", wantFilename: "Show 01.srt", wantLanguage: "en"},
+		{filename: "Show 01.JP.srt", wantFilename: "Show 01.srt", wantLanguage: "jp"},
+		{filename: "Show 01.spa.ass", wantFilename: "Show 01.ass", wantLanguage: "spa"},
+		{filename: "Show 01.en-US.srt", wantFilename: "Show 01.srt", wantLanguage: "en-US"},
+		{filename: "Show 01.pt-br.srt", wantFilename: "Show 01.srt", wantLanguage: "pt-BR"},
+		{filename: "Show 01.zh-Hans.ass", wantFilename: "Show 01.ass", wantLanguage: "zh-Hans"},
+		{filename: "Show 01.ZH-HANT-TW.ass", wantFilename: "Show 01.ass", wantLanguage: "zh-Hant-TW"},
+		{filename: "Show 01.pt-BR.forced.srt", wantFilename: "Show 01.srt", wantLanguage: "pt-BR", wantQualifiers: "forced"},
+		{filename: "Show 01.ep-01.srt", wantFilename: "Show 01.ep-01.srt"},
+		{filename: "Show 01.srt", wantFilename: "Show 01.srt"},
+		{filename: "Show 01.forced.srt", wantFilename: "Show 01.srt", wantQualifiers: "forced"},
+		{filename: "Show 01.sdh.srt", wantFilename: "Show 01.srt", wantQualifiers: "sdh"},
+		{filename: "Show 01.en.forced.srt", wantFilename: "Show 01.srt", wantLanguage: "en", wantQualifiers: "forced"},
+		{filename: "Show 01.en.sdh.cc.srt", wantFilename: "Show 01.srt", wantLanguage: "en", wantQualifiers: "sdh.cc"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			gotFilename, gotLanguage, gotQualifiers := splitSubtitleTags(testCase.filename)
+			if gotFilename != testCase.wantFilename ||
+				gotLanguage != testCase.wantLanguage ||
+				strings.Join(gotQualifiers, ".") != testCase.wantQualifiers {
+				t.Fatalf(
+					"splitSubtitleTags(%q) = (%q, %q, %v), want (%q, %q, %q)",
+					testCase.filename,
+					gotFilename,
+					gotLanguage,
+					gotQualifiers,
+					testCase.wantFilename,
+					testCase.wantLanguage,
+					testCase.wantQualifiers,
+				)
+			}
+		})
+	}
+}
+
+func TestRegionLanguageTagsKeptOnRename(t *testing.T) {
+	subtitleSet := map[string]struct{}{".srt": {}, ".ass": {}}
+	var subtitles []FileInfo
+	for _, name := range []string{"Show 01.en.srt", "Show 01.en-US.srt", "Show 01.pt-br.srt", "Show 01.zh-Hans.ass"} {
+		subtitle, ok := parseFileInfo(name, "", subtitleSet, SubtitleExtensions, episodePatterns)
+		if !ok {
+			t.Fatalf("expected %s to parse", name)
+		}
+
+		subtitles = append(subtitles, subtitle)
+	}
+
+	pairs := []FilePair{{Video: FileInfo{Path: "Show 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"}, Subtitles: subtitles}}
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+
+	want := []string{
+		"Anime - S01E01.mkv",
+		"Anime - S01E01.en.srt",
+		"Anime - S01E01.en-US.srt",
+		"Anime - S01E01.pt-BR.srt",
+		"Anime - S01E01.zh-Hans.ass",
+	}
+	for index, operation := range operations {
+		if got := filepath.Base(operation.NewPath); got != want[index] {
+			t.Fatalf("operation %d target = %q, want %q", index, got, want[index])
+		}
+	}
+
+	if _, collisions, _ := excludeEpisodeCollisions(subtitles, VideoExtensions, false); len(collisions) != 0 {
+		t.Fatalf("expected en and en-US subtitles not to collide, got %+v", collisions)
+	}
+}
+
+func TestQualifiedSubtitlesKeepQualifiers(t *testing.T) {
+	pairs := []FilePair{{
+		Video: FileInfo{Path: "Show 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+		Subtitles: []FileInfo{
+			{Path: "Show 01.forced.srt", Season: 1, Episode: 1, Extension: ".srt", Qualifiers: []string{"forced"}},
+			{Path: "Show 01.sdh.srt", Season: 1, Episode: 1, Extension: ".srt", Qualifiers: []string{"sdh"}},
+			{Path: "Show 01.srt", Season: 1, Episode: 1, Extension: ".srt"},
+		},
+	}}
+
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+
+	want := []string{"Anime - S01E01.mkv", "Anime - S01E01.forced.srt", "Anime - S01E01.sdh.srt", "Anime - S01E01.srt"}
+	for index, operation := range operations {
+		if got := filepath.Base(operation.NewPath); got != want[index] {
+			t.Fatalf("operation %d target = %q, want %q", index, got, want[index])
+		}
+	}
+
+	_, collisions, _ := excludeEpisodeCollisions(pairs[0].Subtitles, VideoExtensions, false)
+	if len(collisions) != 0 {
+		t.Fatalf("expected forced, sdh and plain subtitles not to collide, got %+v", collisions)
+	}
+}
+
+func TestMultipleSubtitleTracksKeepLanguageTags(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"Show 01.mkv", "Show 01.en.srt", "Show 01.jp.srt", "Show 01.es.ass", "Show 01.srt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("data"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	videoFiles, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions})
+	if err != nil {
+		t.Fatalf("find videos: %v", err)
+	}
+
+	subtitleFiles, err := findFiles(tempDir, findOptions{Extensions: SubtitleExtensions})
+	if err != nil {
+		t.Fatalf("find subtitles: %v", err)
+	}
+
+	pairs, unmatched := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 1 || len(unmatched) != 0 || len(pairs[0].Subtitles) != 4 {
+		t.Fatalf("expected one video with 4 subtitles, got %+v (unmatched %d)", pairs, len(unmatched))
+	}
+
+	got := map[string]bool{}
+	for _, operation := range buildRenameOperations(pairs, "Anime", DefaultTemplate) {
+		got[filepath.Base(operation.NewPath)] = true
+	}
+
+	for _, want := range []string{
+		"Anime - S01E01.mkv",
+		"Anime - S01E01.en.srt",
+		"Anime - S01E01.jp.srt",
+		"Anime - S01E01.es.ass",
+		"Anime - S01E01.srt",
+	} {
+		if !got[want] {
+			t.Fatalf("expected target %s, got %v", want, got)
+		}
+	}
+}
+
+func TestSeasonFromDirectory(t *testing.T) {
+	testCases := []struct {
+		directory  string
+		root       string
+		wantSeason int
+		wantFound  bool
+	}{
+		{directory: filepath.Join("anime", "Show", "Season 2"), wantSeason: 2, wantFound: true},
+		{directory: filepath.Join("anime", "Show", "season03"), wantSeason: 3, wantFound: true},
+		{directory: filepath.Join("anime", "Show", "S4"), wantSeason: 4, wantFound: true},
+		{directory: filepath.Join("anime", "Show 2nd Season"), wantSeason: 2, wantFound: true},
+		{directory: filepath.Join("anime", "Show Season 5", "extras"), wantSeason: 5, wantFound: true},
+		{directory: filepath.Join("anime", "Show", "Season II"), wantSeason: 2, wantFound: true},
+		{directory: filepath.Join("anime", "Show"), wantSeason: 0, wantFound: false},
+		{
+			directory:  filepath.Join("anime", "Show", "Season 2"),
+			root:       filepath.Join("anime", "Show", "Season 2"),
+			wantSeason: 2,
+			wantFound:  true,
+		},
+		{
+			directory: filepath.Join("anime", "Show Season 5", "extras"),
+			root:      filepath.Join("anime", "Show Season 5", "extras"),
+			wantFound: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.directory, func(t *testing.T) {
+			gotSeason, gotFound := seasonFromDirectory(testCase.directory, testCase.root)
+			if gotSeason != testCase.wantSeason || gotFound != testCase.wantFound {
+				t.Fatalf(
+					"seasonFromDirectory(%q) = (%d, %t), want (%d, %t)",
+					testCase.directory,
+					gotSeason,
+					gotFound,
+					testCase.wantSeason,
+					testCase.wantFound,
+				)
+			}
+		})
+	}
+}
+
+func TestScanIgnoresSeasonsAboveTheScannedFolder(t *testing.T) {
+	for _, parent := range []string{"Season 3", "Show S2-S4 Complete"} {
+		t.Run(parent, func(t *testing.T) {
+			folder := filepath.Join(t.TempDir(), parent, "downloads")
+			if err := os.MkdirAll(folder, 0o755); err != nil {
+				t.Fatalf("create folder: %v", err)
+			}
+
+			createSourceFiles(t, folder, "Show - 15.mkv")
+
+			result, err := Scan(folder, ScanOptions{SeasonCounts: []int{12, 12}})
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+
+			if len(result.Videos) != 1 || FormatEpisodeLabel(result.Videos[0]) != "S02E03" {
+				t.Fatalf("expected S02E03 from the season counts alone, got %+v", result.Videos)
+			}
+		})
+	}
+}
+
+func TestFindFilesUsesSeasonDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	seasonDir := filepath.Join(tempDir, "Season 2")
+
+	if err := os.Mkdir(seasonDir, 0o755); err != nil {
+		t.Fatalf("create season dir: %v", err)
+	}
+
+	for _, name := range []string{"Show - 01.mkv", "Show S3E02.mkv"} {
+		if err := os.WriteFile(filepath.Join(seasonDir, name), []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	files, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("find files: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+
+	if files[0].Season != 2 || !files[0].HasSeason || files[1].Season != 3 {
+		t.Fatalf("expected filename season to win and folder season as fallback, got %+v", files)
+	}
+}
+
+func TestExcludeEpisodeCollisions(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: "Show - 05.mkv", Season: 1, Episode: 5, Extension: ".mkv"},
+		{Path: "Show 05 720p.mp4", Season: 1, Episode: 5, Extension: ".mp4"},
+		{Path: "Show - 06.mkv", Season: 1, Episode: 6, Extension: ".mkv"},
+	}
+
+	kept, collisions, _ := excludeEpisodeCollisions(videoFiles, VideoExtensions, false)
+	if len(kept) != 1 || kept[0].Path != "Show - 06.mkv" {
+		t.Fatalf("expected only episode 6 to be kept, got %+v", kept)
+	}
+
+	if len(collisions) != 1 || len(collisions[0]) != 2 {
+		t.Fatalf("expected one collision of two files, got %+v", collisions)
+	}
+
+	if collisions[0][0].Path != "Show - 05.mkv" || collisions[0][1].Path != "Show 05 720p.mp4" {
+		t.Fatalf("expected collision to name both source files, got %+v", collisions[0])
+	}
+
+	subtitleFiles := []FileInfo{
+		{Path: "Show 05.en.srt", Season: 1, Episode: 5, Extension: ".srt", Language: "en"},
+		{Path: "Show 05.jp.srt", Season: 1, Episode: 5, Extension: ".srt", Language: "jp"},
+		{Path: "Show 05.ass", Season: 1, Episode: 5, Extension: ".ass"},
+	}
+
+	kept, collisions, _ = excludeEpisodeCollisions(subtitleFiles, VideoExtensions, false)
+	if len(kept) != 3 || len(collisions) != 0 {
+		t.Fatalf("expected subtitle tracks with different languages or formats to be kept, got %+v", collisions)
+	}
+}
+
+func TestParseEpisodeVersion(t *testing.T) {
+	testCases := []struct {
+		filename    string
+		wantEpisode int
+		wantVersion int
+		wantTitle   string
+	}{
+		{filename: "Show - 01v2.mkv", wantEpisode: 1, wantVersion: 2},
+		{filename: "Show 01v2.mkv", wantEpisode: 1, wantVersion: 2},
+		{filename: "Show 01 v2.mkv", wantEpisode: 1, wantVersion: 2},
+		{filename: "Show S01E01v3 - The Beginning.mkv", wantEpisode: 1, wantVersion: 3, wantTitle: "The Beginning"},
+		{filename: "Show - 01.mkv", wantEpisode: 1},
+		{filename: "Show - 01 - Vivy.mkv", wantEpisode: 1, wantTitle: "Vivy"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.filename, func(t *testing.T) {
+			match := parseEpisode(testCase.filename)
+			title := titleAfterEpisode(testCase.filename, ReleaseNoiseTokens, episodePatterns)
+			if match.Episode != testCase.wantEpisode || match.Version != testCase.wantVersion || title != testCase.wantTitle {
+				t.Fatalf(
+					"parsed episode %d, version %d, title %q, want %d, %d, %q",
+					match.Episode,
+					match.Version,
+					title,
+					testCase.wantEpisode,
+					testCase.wantVersion,
+					testCase.wantTitle,
+				)
+			}
+		})
+	}
+}
+
+func TestExcludeEpisodeCollisionsPrefersNewestVersion(t *testing.T) {
+	files := []FileInfo{
+		{Path: "Show - 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+		{Path: "Show - 01v2.mkv", Season: 1, Episode: 1, Extension: ".mkv", Version: 2},
+		{Path: "Show - 02v2.mkv", Season: 1, Episode: 2, Extension: ".mkv", Version: 2},
+		{Path: "Show - 02v2 [720p].mkv", Season: 1, Episode: 2, Extension: ".mkv", Version: 2},
+		{Path: "Show - 03v1.mkv", Season: 1, Episode: 3, Extension: ".mkv", Version: 1},
+		{Path: "Show - 03.mkv", Season: 1, Episode: 3, Extension: ".mkv"},
+	}
+
+	kept, collisions, superseded := excludeEpisodeCollisions(files, VideoExtensions, false)
+	if len(kept) != 1 || kept[0].Path != "Show - 01v2.mkv" {
+		t.Fatalf("expected only the newer version of episode 1 to be kept, got %+v", kept)
+	}
+
+	if len(superseded) != 1 || superseded[0].Path != "Show - 01.mkv" {
+		t.Fatalf("expected the older episode 1 to be superseded, got %+v", superseded)
+	}
+
+	if len(collisions) != 2 {
+		t.Fatalf("expected equal versions of episodes 2 and 3 to collide, got %+v", collisions)
+	}
+}
+
+func TestResolveAbsoluteEpisode(t *testing.T) {
+	seasonCounts := []int{12, 13}
+
+	testCases := []struct {
+		name        string
+		absolute    int
+		wantSeason  int
+		wantEpisode int
+	}{
+		{name: "first episode", absolute: 1, wantSeason: 1, wantEpisode: 1},
+		{name: "last episode of season one", absolute: 12, wantSeason: 1, wantEpisode: 12},
+		{name: "first episode of season two", absolute: 13, wantSeason: 2, wantEpisode: 1},
+		{name: "last episode of season two", absolute: 25, wantSeason: 2, wantEpisode: 13},
+		{name: "past the known seasons", absolute: 26, wantSeason: 3, wantEpisode: 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			gotSeason, gotEpisode := resolveAbsoluteEpisode(testCase.absolute, 1, seasonCounts)
+			if gotSeason != testCase.wantSeason || gotEpisode != testCase.wantEpisode {
+				t.Fatalf(
+					"resolveAbsoluteEpisode(%d) = (%d, %d), want (%d, %d)",
+					testCase.absolute,
+					gotSeason,
+					gotEpisode,
+					testCase.wantSeason,
+					testCase.wantEpisode,
+				)
+			}
+		})
+	}
+}
+
+func TestSeasonRangeFromName(t *testing.T) {
+	testCases := []struct {
+		name      string
+		wantFirst int
+		wantLast  int
+		wantOK    bool
+	}{
+		{name: "Show S1-S3 Complete", wantFirst: 1, wantLast: 3, wantOK: true},
+		{name: "Show S01-S03 [BD 1080p]", wantFirst: 1, wantLast: 3, wantOK: true},
+		{name: "Show Seasons 2 - 4", wantFirst: 2, wantLast: 4, wantOK: true},
+		{name: "Show Season 1~3", wantFirst: 1, wantLast: 3, wantOK: true},
+		{name: "Show Season 2", wantOK: false},
+		{name: "Show S3-S1", wantOK: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			first, last, ok := seasonRangeFromName(testCase.name)
+			if first != testCase.wantFirst || last != testCase.wantLast || ok != testCase.wantOK {
+				t.Fatalf(
+					"seasonRangeFromName(%q) = (%d, %d, %t), want (%d, %d, %t)",
+					testCase.name,
+					first,
+					last,
+					ok,
+					testCase.wantFirst,
+					testCase.wantLast,
+					testCase.wantOK,
+				)
+			}
+		})
+	}
+}
+
+func TestScanSplitsSeasonRangeFolderBySeasonCounts(t *testing.T) {
+	testCases := []struct {
+		folder string
+		want   map[string]string
+	}{
+		{
+			folder: "Show S1-S3 Complete",
+			want: map[string]string{
+				"Show - 01.mkv": "S01E01",
+				"Show - 12.mkv": "S01E12",
+				"Show - 13.mkv": "S02E01",
+				"Show - 25.mkv": "S02E13",
+				"Show - 26.mkv": "S03E01",
+				"Show - 37.mkv": "S03E12",
+			},
+		},
+		{
+			folder: "Show Season 2-4",
+			want: map[string]string{
+				"Show - 01.mkv": "S02E01",
+				"Show - 12.mkv": "S02E12",
+				"Show - 13.mkv": "S03E01",
+				"Show - 25.mkv": "S03E13",
+				"Show - 26.mkv": "S04E01",
+				"Show - 37.mkv": "S04E12",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.folder, func(t *testing.T) {
+			folder := filepath.Join(t.TempDir(), testCase.folder)
+			if err := os.Mkdir(folder, 0o755); err != nil {
+				t.Fatalf("create folder: %v", err)
+			}
+
+			for name := range testCase.want {
+				createSourceFiles(t, folder, name)
+			}
+
+			scan, err := Scan(folder, ScanOptions{SeasonCounts: []int{12, 13, 12}})
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+
+			got := map[string]string{}
+			for _, file := range scan.Videos {
+				got[filepath.Base(file.Path)] = FormatEpisodeLabel(file)
+			}
+
+			if !maps.Equal(got, testCase.want) {
+				t.Fatalf("files = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestApplyAbsoluteNumberingKeepsExplicitSeasons(t *testing.T) {
+	files := []FileInfo{
+		{Path: "Show S1 - 01.mkv", Season: 1, Episode: 1, HasSeason: true},
+		{Path: "Show 25.mkv", Season: 1, Episode: 25},
+	}
+
+	resolved := applyAbsoluteNumbering(files, []int{12, 13}, "")
+
+	if resolved[0].Season != 1 || resolved[0].Episode != 1 {
+		t.Fatalf("expected explicit season file to stay S01E01, got S%02dE%02d", resolved[0].Season, resolved[0].Episode)
+	}
+
+	if resolved[1].Season != 2 || resolved[1].Episode != 13 {
+		t.Fatalf("expected absolute episode 25 to become S02E13, got S%02dE%02d", resolved[1].Season, resolved[1].Episode)
+	}
+}
+
+func TestFindFilesRecognizesVideoExtensions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	names := []string{
+		"Show - 01.webm",
+		"Show - 02.mov",
+		"Show - 03.ts",
+		"Show - 04.m4v",
+		"Show - 05.txt",
+	}
+
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	files, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions})
+	if err != nil {
+		t.Fatalf("find files: %v", err)
+	}
+
+	if len(files) != 4 {
+		t.Fatalf("expected 4 video files, got %d", len(files))
+	}
+
+	pairs := []FilePair{}
+	for _, file := range files {
+		pairs = append(pairs, FilePair{Video: file})
+	}
+
+	for _, operation := range buildRenameOperations(pairs, "Anime", DefaultTemplate) {
+		if filepath.Ext(operation.NewPath) != filepath.Ext(operation.OldPath) {
+			t.Fatalf("expected extension to be preserved: %s -> %s", operation.OldPath, operation.NewPath)
+		}
+	}
+}
+
+func TestFindFilesMatchesExtensionsCaseInsensitively(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"Show 01.MKV", "Show 02.Mp4", "Show 01.Srt", "Show 02.ASS"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("data"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	videoFiles, err := findFiles(tempDir, findOptions{Extensions: []string{".mkv", ".MP4"}})
+	if err != nil {
+		t.Fatalf("find videos: %v", err)
+	}
+
+	subtitleFiles, err := findFiles(tempDir, findOptions{Extensions: SubtitleExtensions})
+	if err != nil {
+		t.Fatalf("find subtitles: %v", err)
+	}
+
+	if len(videoFiles) != 2 || len(subtitleFiles) != 2 {
+		t.Fatalf("expected 2 videos and 2 subtitles, got %d and %d", len(videoFiles), len(subtitleFiles))
+	}
+
+	if videoFiles[0].Extension != ".mkv" || subtitleFiles[1].Extension != ".ass" {
+		t.Fatalf("expected extensions to be normalized to lowercase, got %+v %+v", videoFiles, subtitleFiles)
+	}
+}
+
+func TestFindFilesSkipsHiddenFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, ".cache"), 0o755); err != nil {
+		t.Fatalf("create hidden folder: %v", err)
+	}
+
+	createSourceFiles(
+		t,
+		tempDir,
+		"Show 01.mkv",
+		"._Show 01.mkv",
+		"Show 01.srt",
+		".hidden.srt",
+		".DS_Store",
+		filepath.Join(".cache", "Show 02.mkv"),
+	)
+
+	extensions := slices.Concat(VideoExtensions, SubtitleExtensions)
+	files, err := findFiles(tempDir, findOptions{Extensions: extensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("find files: %v", err)
+	}
+
+	got := []string{}
+	for _, file := range files {
+		got = append(got, filepath.Base(file.Path))
+	}
+
+	if want := []string{"Show 01.mkv", "Show 01.srt"}; !slices.Equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+}
+
+func TestFindFilesWithWorkersMatchesSequentialScan(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for episode := 1; episode <= 40; episode++ {
+		name := filepath.Join(tempDir, fmt.Sprintf("Show - %02d.mkv", episode))
+		if err := os.WriteFile(name, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	sequential, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions})
+	if err != nil {
+		t.Fatalf("sequential scan: %v", err)
+	}
+
+	parallel, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Workers: 8})
+	if err != nil {
+		t.Fatalf("parallel scan: %v", err)
+	}
+
+	if len(parallel) != 40 || len(sequential) != len(parallel) {
+		t.Fatalf("expected 40 files from both scans, got %d and %d", len(sequential), len(parallel))
+	}
+
+	for index := range sequential {
+		if sequential[index].Path != parallel[index].Path || sequential[index].Episode != parallel[index].Episode {
+			t.Fatalf("scan results differ at %d: %+v vs %+v", index, sequential[index], parallel[index])
+		}
+	}
+}
+
+func TestFindFilesRecursiveToggle(t *testing.T) {
+	tempDir := t.TempDir()
+	seasonDir := filepath.Join(tempDir, "Season 2")
+
+	if err := os.Mkdir(seasonDir, 0o755); err != nil {
+		t.Fatalf("create season dir: %v", err)
+	}
+
+	for _, path := range []string{filepath.Join(tempDir, "Show - 01.mkv"), filepath.Join(seasonDir, "Show - 01.mkv")} {
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	topLevel, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions})
+	if err != nil {
+		t.Fatalf("top-level scan: %v", err)
+	}
+
+	if len(topLevel) != 1 {
+		t.Fatalf("expected only the top-level file without recursion, got %d", len(topLevel))
+	}
+
+	recursive, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions, Recursive: true})
+	if err != nil {
+		t.Fatalf("recursive scan: %v", err)
+	}
+
+	if len(recursive) != 2 {
+		t.Fatalf("expected both files with recursion, got %d", len(recursive))
+	}
+}
+
+func TestFindFilesWithCustomOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"Show Folge 7.mkv", "Show - 01.mkv", IgnoreFileName} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("Show - 01.mkv\n"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		options   findOptions
+		wantFiles []string
+	}{
+		{
+			name:      "built-in patterns and ignore file",
+			options:   findOptions{Extensions: VideoExtensions},
+			wantFiles: []string{},
+		},
+		{
+			name: "custom patterns",
+			options: findOptions{
+				Extensions: VideoExtensions,
+				Patterns:   []*regexp.Regexp{regexp.MustCompile(`Folge (?P<episode>\d+)`)},
+			},
+			wantFiles: []string{"Show Folge 7.mkv: 7"},
+		},
+		{
+			name: "ignore file skipped",
+			options: findOptions{
+				Extensions:     VideoExtensions,
+				Workers:        4,
+				SkipIgnoreFile: true,
+			},
+			wantFiles: []string{"Show - 01.mkv: 1"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			files, err := findFiles(tempDir, testCase.options)
+			if err != nil {
+				t.Fatalf("find files: %v", err)
+			}
+
+			gotFiles := []string{}
+			for _, file := range files {
+				gotFiles = append(gotFiles, fmt.Sprintf("%s: %d", filepath.Base(file.Path), file.Episode))
+			}
+
+			if !slices.Equal(gotFiles, testCase.wantFiles) {
+				t.Fatalf("found %v, want %v", gotFiles, testCase.wantFiles)
+			}
+		})
+	}
+}
+
+func TestCreateFilePairsByDirectory(t *testing.T) {
+	videoFiles := []FileInfo{
+		{Path: filepath.Join("show", "Season 1", "Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"},
+		{Path: filepath.Join("show", "Season 2", "Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"},
+	}
+	subtitleFiles := []FileInfo{
+		{Path: filepath.Join("show", "Season 2", "Show - 01.srt"), Season: 1, Episode: 1, Extension: ".srt"},
+		{Path: filepath.Join("show", "Season 1", "Show - 01.srt"), Season: 1, Episode: 1, Extension: ".srt"},
+	}
+
+	groups := partitionByDirectory(videoFiles)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 directory groups, got %d", len(groups))
+	}
+
+	pairs, unmatched := createFilePairsByDirectory(videoFiles, subtitleFiles)
+	if len(pairs) != 2 || len(unmatched) != 0 {
+		t.Fatalf("expected 2 pairs and no unmatched files, got %d pairs and %d unmatched", len(pairs), len(unmatched))
+	}
+
+	for _, pair := range pairs {
+		if filepath.Dir(pair.Video.Path) != filepath.Dir(pair.Subtitles[0].Path) {
+			t.Fatalf("expected pairs within the same directory, got %s and %s", pair.Video.Path, pair.Subtitles[0].Path)
+		}
+	}
+}
+
+func TestVobSubCompanionIsRenamedWithSubtitle(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"Show - 01.mkv", "Show - 01.sub", "Show - 01.idx", "Show - 02.vtt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("data"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	subtitleFiles, err := findFiles(tempDir, findOptions{Extensions: SubtitleExtensions})
+	if err != nil {
+		t.Fatalf("find subtitles: %v", err)
+	}
+
+	if len(subtitleFiles) != 2 {
+		t.Fatalf("expected .sub and .vtt subtitles, got %d", len(subtitleFiles))
+	}
+
+	subtitleFiles, err = attachCompanionFiles(subtitleFiles, companionExtensions)
+	if err != nil {
+		t.Fatalf("attach companions: %v", err)
+	}
+
+	videoFiles, err := findFiles(tempDir, findOptions{Extensions: VideoExtensions})
+	if err != nil {
+		t.Fatalf("find videos: %v", err)
+	}
+
+	pairs, _ := createFilePairs(videoFiles, subtitleFiles)
+	if len(pairs) != 1 {
+		t.Fatalf("expected 1 pair, got %d", len(pairs))
+	}
+
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+	if len(operations) != 3 {
+		t.Fatalf("expected video, sub and idx operations, got %d", len(operations))
+	}
+
+	wantIdx := filepath.Join(tempDir, "Anime - S01E01.idx")
+	if operations[2].OldPath != filepath.Join(tempDir, "Show - 01.idx") || operations[2].NewPath != wantIdx {
+		t.Fatalf("unexpected idx operation: %+v", operations[2])
+	}
+}
+
+func TestFontsFolderIsRenamedWithSubtitle(t *testing.T) {
+	for _, mode := range []string{ModeRename, ModeCopy} {
+		t.Run(mode, func(t *testing.T) {
+			tempDir := t.TempDir()
+			fontsDir := filepath.Join(tempDir, "Show - 01.en.fonts")
+			if err := os.Mkdir(fontsDir, 0o755); err != nil {
+				t.Fatalf("create fonts folder: %v", err)
+			}
+
+			createSourceFiles(t, tempDir, "Show - 01.mkv", "Show - 01.en.ass", filepath.Join("Show - 01.en.fonts", "Font.ttf"))
+
+			scan, err := Scan(tempDir, ScanOptions{})
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+
+			if len(scan.Subtitles) != 1 || len(scan.Subtitles[0].Companions) != 1 || scan.Subtitles[0].Companions[0] != fontsDir {
+				t.Fatalf("expected the fonts folder as a companion, got %+v", scan.Subtitles)
+			}
+
+			pairs, _ := Pair(scan.Videos, scan.Subtitles, PairOptions{})
+			operations, err := Plan(pairs, PlanOptions{AnimeName: "Anime"})
+			if err != nil {
+				t.Fatalf("plan: %v", err)
+			}
+
+			if err := Execute(operations, ExecuteOptions{Mode: mode}); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(tempDir, "Anime - S01E01.en.fonts", "Font.ttf"))
+			if err != nil || string(data) != filepath.Join("Show - 01.en.fonts", "Font.ttf") {
+				t.Fatalf("expected the fonts folder next to the renamed subtitle, got %q (%v)", data, err)
+			}
+
+			_, err = os.Stat(fontsDir)
+			if kept := err == nil; kept != KeepsSources(mode) {
+				t.Fatalf("original fonts folder kept = %t in %s mode", kept, mode)
+			}
+		})
+	}
+}
+
+func TestFormatFileNameTemplates(t *testing.T) {
+	file := FileInfo{Path: "Show - 03.mkv", Season: 2, Episode: 3, Extension: ".mkv"}
+
+	testCases := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "default", template: DefaultTemplate, want: "Anime - S02E03.mkv"},
+		{name: "no dash", template: "{name} S{season}E{episode}{ext}", want: "Anime S02E03.mkv"},
+		{name: "bracketed name without ext token", template: "[{name}] {episode}", want: "[Anime] 03.mkv"},
+		{name: "plex style", template: "{name} - s{season}e{episode} - {title}{ext}", want: "Anime - s02e03.mkv"},
+		{name: "jellyfin style", template: "{name} S{season}E{episode}{ext}", want: "Anime S02E03.mkv"},
+		{name: "tvdb style", template: "{name} {season:d}x{episode:02d}{ext}", want: "Anime 2x03.mkv"},
+		{name: "padded x style", template: "{name} {season:02d}x{episode:02d}{ext}", want: "Anime 02x03.mkv"},
+		{name: "unpadded episode", template: "{name} - {episode:d}", want: "Anime - 3.mkv"},
+		{name: "three-digit episode", template: "{name} - S{season:d}E{episode:03d}", want: "Anime - S2E003.mkv"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := ValidateTemplate(testCase.template); err != nil {
+				t.Fatalf("ValidateTemplate(%q): %v", testCase.template, err)
+			}
+
+			got := formatFileName(testCase.template, "Anime", file, file.Extension, 2)
+			if got != testCase.want {
+				t.Fatalf("formatFileName(%q) = %q, want %q", testCase.template, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestMoveIntoSeasonFolders(t *testing.T) {
+	showDir := filepath.Join("library", "Show")
+	pairs := []FilePair{
+		{
+			Video:     FileInfo{Path: filepath.Join(showDir, "Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"},
+			Subtitles: []FileInfo{{Path: filepath.Join(showDir, "Show - 01.srt"), Season: 1, Episode: 1, Extension: ".srt"}},
+		},
+		{
+			Video: FileInfo{
+				Path:      filepath.Join(showDir, "Season 2", "Show - 01.mkv"),
+				Season:    2,
+				Episode:   1,
+				Extension: ".mkv",
+			},
+		},
+	}
+
+	operations := moveIntoSeasonFolders(buildRenameOperations(pairs, "Anime", "{name} - s{season}e{episode} - {title}{ext}"), pairs)
+
+	want := []string{
+		filepath.Join(showDir, "Season 01", "Anime - s01e01.mkv"),
+		filepath.Join(showDir, "Season 01", "Anime - s01e01.srt"),
+		filepath.Join(showDir, "Season 02", "Anime - s02e01.mkv"),
+	}
+
+	if len(operations) != len(want) {
+		t.Fatalf("expected %d operations, got %+v", len(want), operations)
+	}
+
+	for index, operation := range operations {
+		if operation.NewPath != want[index] {
+			t.Fatalf("operation %d target = %q, want %q", index, operation.NewPath, want[index])
+		}
+	}
+}
+
+func TestExecuteRenameOperationsCreatesSeasonFolders(t *testing.T) {
+	tempDir := t.TempDir()
+
+	source := filepath.Join(tempDir, "Show - 01.mkv")
+	if err := os.WriteFile(source, []byte("video"), 0o600); err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	operations := []RenameOperation{{OldPath: source, NewPath: filepath.Join(tempDir, "Season 01", "Anime - s01e01.mkv")}}
+
+	if err := preflightRenameOperations(operations, checkWritableDirectory); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+
+	if err := executeRenameOperations(operations, nil); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if _, err := os.Stat(operations[0].NewPath); err != nil {
+		t.Fatalf("expected file in season folder: %v", err)
+	}
+}
+
+func TestExecuteRenameOperationsWithRemovesCreatedFoldersOnRollback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	seasonDir := filepath.Join(tempDir, "Season 01")
+	operations := []RenameOperation{}
+	for _, episode := range []string{"01", "02"} {
+		source := filepath.Join(tempDir, "Show - "+episode+".mkv")
+		if err := os.WriteFile(source, []byte(episode), 0o600); err != nil {
+			t.Fatalf("create source: %v", err)
+		}
+
+		operations = append(operations, RenameOperation{
+			OldPath: source,
+			NewPath: filepath.Join(seasonDir, "Anime S01E"+episode+".mkv"),
+		})
+	}
+
+	renameFn := func(oldPath, newPath string) error {
+		if newPath == operations[1].NewPath {
+			return errors.New("simulated failure")
+		}
+
+		return os.Rename(oldPath, newPath)
+	}
+
+	err := executeRenameOperationsWith(operations, moveStrategy{move: renameFn}, nil)
+	var executionErr *RenameExecutionError
+	if !errors.As(err, &executionErr) || executionErr.Phase != "phase-two" {
+		t.Fatalf("expected a phase-two execution error, got %v", err)
+	}
+
+	if _, err := os.Stat(seasonDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected created season folder to be removed, got %v", err)
+	}
+
+	for _, operation := range operations {
+		if _, err := os.Stat(operation.OldPath); err != nil {
+			t.Fatalf("expected %s to be restored: %v", operation.OldPath, err)
+		}
+	}
+}
+
+func TestPreflightRenameOperationsRejectsFileAsTargetFolder(t *testing.T) {
+	tempDir := t.TempDir()
+
+	source := filepath.Join(tempDir, "Show - 01.mkv")
+	blocker := filepath.Join(tempDir, "Season 01")
+	for _, path := range []string{source, blocker} {
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	operations := []RenameOperation{{OldPath: source, NewPath: filepath.Join(blocker, "Anime - s01e01.mkv")}}
+
+	err := preflightRenameOperations(operations, checkWritableDirectory)
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected a target folder error, got %v", err)
+	}
+}
+
+func TestPreflightRejectsTargetsWithoutAName(t *testing.T) {
+	tempDir := t.TempDir()
+	paths := createSourceFiles(t, tempDir, "Show - 01.mkv")
+	pairs := []FilePair{{Video: FileInfo{Path: paths[0], Season: 1, Episode: 1, Extension: ".mkv"}}}
+
+	for _, template := range []string{DefaultTemplate, "{name}{ext}"} {
+		t.Run(template, func(t *testing.T) {
+			operations := buildRenameOperations(pairs, "", template)
+			err := Preflight(operations, ExecuteOptions{})
+			if err == nil || !strings.Contains(err.Error(), "has no name") || !strings.Contains(err.Error(), paths[0]) {
+				t.Fatalf("expected preflight to reject %v naming %s, got %v", operations, paths[0], err)
+			}
+		})
+	}
+
+	operations := buildRenameOperations(pairs, ".hack Sign", DefaultTemplate)
+	if err := Preflight(operations, ExecuteOptions{}); err == nil || !strings.Contains(err.Error(), "starts with a dot") {
+		t.Fatalf("expected a name starting with a dot to be refused, got %v", err)
+	}
+}
+
+func TestPreflightRenameOperationsRejectsOverlongTargets(t *testing.T) {
+	tempDir := t.TempDir()
+
+	source := filepath.Join(tempDir, "Show - 01.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0o600); err != nil {
+		t.Fatalf("create %s: %v", source, err)
+	}
+
+	longDirectory := tempDir
+	for longDirectory == tempDir || len(longDirectory) <= maxPathLength {
+		longDirectory = filepath.Join(longDirectory, strings.Repeat("d", 200))
+	}
+
+	testCases := []struct {
+		name    string
+		newPath string
+		want    string
+	}{
+		{name: "file name", newPath: filepath.Join(tempDir, strings.Repeat("a", 300)+".mkv"), want: "target file name is"},
+		{name: "path", newPath: filepath.Join(longDirectory, "Anime - S01E01.mkv"), want: "target path is"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			operations := []RenameOperation{{OldPath: source, NewPath: testCase.newPath}}
+			err := preflightRenameOperations(operations, checkWritableDirectory)
+			if err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("expected %q in the preflight error, got %v", testCase.want, err)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	windowsReserved := `<>:"/\|?*`
+
+	testCases := []struct {
+		name     string
+		reserved string
+		input    string
+		want     string
+	}{
+		{name: "colons", reserved: windowsReserved, input: "Re:Zero: Starting - S01E01.mkv", want: "Re-Zero - Starting - S01E01.mkv"},
+		{name: "quotes and wildcards", reserved: windowsReserved, input: `"Oshi no Ko"? <Best>*.mkv`, want: "'Oshi no Ko' Best.mkv"},
+		{name: "slashes", reserved: windowsReserved, input: `Fate/Zero\Extra.mkv`, want: "Fate-Zero-Extra.mkv"},
+		{name: "colons allowed", reserved: "/\x00", input: "Re:Zero/Extra.mkv", want: "Re:Zero-Extra.mkv"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := sanitizeFileName(testCase.input, testCase.reserved); got != testCase.want {
+				t.Fatalf("sanitizeFileName(%q) = %q, want %q", testCase.input, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestBuildRenameOperationsSanitizesAnimeName(t *testing.T) {
+	folder := filepath.Join("downloads", "Show")
+	pairs := []FilePair{{Video: FileInfo{Path: filepath.Join(folder, "Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"}}}
+
+	if err := ValidateAnimeName("Fate/Zero"); err != nil {
+		t.Fatalf("expected a name with a slash to be accepted: %v", err)
+	}
+
+	if err := ValidateAnimeName("\x00"); err == nil {
+		t.Fatal("expected a name of only reserved characters to be rejected")
+	}
+
+	operations := buildRenameOperations(pairs, "Fate/Zero", DefaultTemplate)
+	if want := filepath.Join(folder, "Fate-Zero - S01E01.mkv"); operations[0].NewPath != want {
+		t.Fatalf("expected %q, got %q", want, operations[0].NewPath)
+	}
+}
+
+func TestCheckAnimeNameEpisode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		wantEpisode string
+	}{
+		{name: "Show"},
+		{name: "Mob Psycho 100"},
+		{name: "Re:Zero - Starting Life in Another World"},
+		{name: "Show - S01E01", wantEpisode: "S01E01"},
+		{name: "Show s2e05 Title", wantEpisode: "s2e05"},
+		{name: "Show - 01", wantEpisode: "01"},
+		{name: "Show Episode 12", wantEpisode: "Episode 12"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := CheckAnimeNameEpisode(testCase.name)
+			if testCase.wantEpisode == "" {
+				if err != nil {
+					t.Fatalf("expected %q to pass, got %v", testCase.name, err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", testCase.wantEpisode)) {
+				t.Fatalf("expected a warning about %q, got %v", testCase.wantEpisode, err)
+			}
+		})
+	}
+}
+
+func TestBuildRenameOperationsWithJapaneseNames(t *testing.T) {
+	extensionSet := map[string]struct{}{".mkv": {}}
+	video, ok := parseFileInfo(
+		"進撃の巨人 - ０５ - 二千年後の君へ.mkv",
+		"",
+		extensionSet,
+		SubtitleExtensions,
+		episodePatterns,
+	)
+	if !ok || video.Episode != 5 {
+		t.Fatalf("expected episode 5, got %+v (%t)", video, ok)
+	}
+
+	videos := attachEpisodeTitles([]FileInfo{video}, ReleaseNoiseTokens, episodePatterns)
+	if name := InferAnimeName(videos, "downloads", ReleaseNoiseTokens, nil); name != "進撃の巨人" {
+		t.Fatalf("expected the japanese title to be inferred, got %q", name)
+	}
+
+	operations := buildRenameOperations(
+		[]FilePair{{Video: videos[0]}},
+		"進撃の巨人",
+		"{name} - S{season}E{episode} - {title}{ext}",
+	)
+	want := "進撃の巨人 - S01E05 - 二千年後の君へ.mkv"
+	if operations[0].NewPath != want || !utf8.ValidString(operations[0].NewPath) {
+		t.Fatalf("target = %q, want %q", operations[0].NewPath, want)
+	}
+
+	if got := sanitizeFileName("Show \xff - S01E01.mkv", reservedNameCharacters); !utf8.ValidString(got) {
+		t.Fatalf("expected a valid UTF-8 name from invalid bytes, got %q", got)
+	}
+}
+
+func TestBuildRenameOperationsPlansTwoPairs(t *testing.T) {
+	folder := filepath.Join("downloads", "Show")
+	pairs := []FilePair{
+		{
+			Video: FileInfo{Path: filepath.Join(folder, "[Group] Show - 01.mkv"), Season: 1, Episode: 1, Extension: ".mkv"},
+			Subtitles: []FileInfo{
+				{Path: filepath.Join(folder, "Show - 01.en.ass"), Season: 1, Episode: 1, Language: "en", Extension: ".ass"},
+			},
+		},
+		{
+			Video:     FileInfo{Path: filepath.Join(folder, "[Group] Show - 02.mkv"), Season: 1, Episode: 2, Extension: ".mkv"},
+			Subtitles: []FileInfo{{Path: filepath.Join(folder, "Show - 02.srt"), Season: 1, Episode: 2, Extension: ".srt"}},
+		},
+	}
+
+	want := []RenameOperation{
+		{OldPath: filepath.Join(folder, "[Group] Show - 01.mkv"), NewPath: filepath.Join(folder, "Anime - S01E01.mkv")},
+		{OldPath: filepath.Join(folder, "Show - 01.en.ass"), NewPath: filepath.Join(folder, "Anime - S01E01.en.ass")},
+		{OldPath: filepath.Join(folder, "[Group] Show - 02.mkv"), NewPath: filepath.Join(folder, "Anime - S01E02.mkv")},
+		{OldPath: filepath.Join(folder, "Show - 02.srt"), NewPath: filepath.Join(folder, "Anime - S01E02.srt")},
+	}
+
+	got := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+	if !slices.Equal(got, want) {
+		t.Fatalf("buildRenameOperations() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildRenameOperationsPadsAcrossTheBatch(t *testing.T) {
+	pairFor := func(episode int) FilePair {
+		path := fmt.Sprintf("Show - %d.mkv", episode)
+		return FilePair{Video: FileInfo{Path: path, Season: 1, Episode: episode, Extension: ".mkv"}}
+	}
+
+	testCases := []struct {
+		name     string
+		episodes []int
+		want     []string
+	}{
+		{name: "up to 99", episodes: []int{1, 99}, want: []string{"Anime - S01E01.mkv", "Anime - S01E99.mkv"}},
+		{
+			name:     "reaching 100",
+			episodes: []int{1, 99, 100},
+			want:     []string{"Anime - S01E001.mkv", "Anime - S01E099.mkv", "Anime - S01E100.mkv"},
+		},
+		{
+			name:     "reaching 1000",
+			episodes: []int{999, 1000, 1015},
+			want:     []string{"Anime - S01E0999.mkv", "Anime - S01E1000.mkv", "Anime - S01E1015.mkv"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			pairs := []FilePair{}
+			for _, episode := range testCase.episodes {
+				pairs = append(pairs, pairFor(episode))
+			}
+
+			for index, operation := range buildRenameOperations(pairs, "Anime", DefaultTemplate) {
+				if operation.NewPath != testCase.want[index] {
+					t.Fatalf("operation %d target = %q, want %q", index, operation.NewPath, testCase.want[index])
+				}
+			}
+		})
+	}
+}
+
+func TestEpisodeTitlesInTemplate(t *testing.T) {
+	template := "{name} - S{season}E{episode} - {title}{ext}"
+	pairs := []FilePair{
+		{
+			Video: FileInfo{Path: "Show - 01 - The Beginning.mkv", Season: 1, Episode: 1, Title: "The Beginning", Extension: ".mkv"},
+			Subtitles: []FileInfo{
+				{Path: "Show - 01 - Beginning.srt", Season: 1, Episode: 1, Title: "Beginning", Extension: ".srt"},
+			},
+		},
+		{
+			Video:     FileInfo{Path: "Show - 02.mkv", Season: 1, Episode: 2, Extension: ".mkv"},
+			Subtitles: []FileInfo{{Path: "Show - 02 - Rise.srt", Season: 1, Episode: 2, Title: "Rise", Extension: ".srt"}},
+		},
+		{
+			Video: FileInfo{Path: "Show - 03.mkv", Season: 1, Episode: 3, Extension: ".mkv"},
+		},
+	}
+
+	want := []string{
+		"Anime - S01E01 - The Beginning.mkv",
+		"Anime - S01E01 - The Beginning.srt",
+		"Anime - S01E02 - Rise.mkv",
+		"Anime - S01E02 - Rise.srt",
+		"Anime - S01E03.mkv",
+	}
+
+	operations := buildRenameOperations(pairs, "Anime", template)
+	if len(operations) != len(want) {
+		t.Fatalf("expected %d operations, got %+v", len(want), operations)
+	}
+
+	for index, operation := range operations {
+		if got := filepath.Base(operation.NewPath); got != want[index] {
+			t.Fatalf("operation %d target = %q, want %q", index, got, want[index])
+		}
+	}
+}
+
+func TestValidateTemplateRejectsInvalidTemplates(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"{name} - S{season}",
+		"{name} {episode} {group}",
+		"{name}/{episode}",
+		"{name} {episode:2d}",
+		"{name} {episode:x}",
+		"{name:02d} {episode}",
+	} {
+		if err := ValidateTemplate(template); err == nil {
+			t.Fatalf("expected ValidateTemplate(%q) to fail", template)
+		}
+	}
+}
+
+func TestPreflightRenameOperationsDetectsDuplicateTargets(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceOne := filepath.Join(tempDir, "episode-01.mkv")
+	sourceTwo := filepath.Join(tempDir, "episode-01.srt")
+	duplicateTarget := filepath.Join(tempDir, "Anime - S01E01.mkv")
+
+	if err := os.WriteFile(sourceOne, []byte("video"), 0o600); err != nil {
+		t.Fatalf("create source one: %v", err)
+	}
+
+	if err := os.WriteFile(sourceTwo, []byte("subtitle"), 0o600); err != nil {
+		t.Fatalf("create source two: %v", err)
+	}
+
+	operations := []RenameOperation{
+		{OldPath: sourceOne, NewPath: duplicateTarget},
+		{OldPath: sourceTwo, NewPath: duplicateTarget},
+	}
+
+	err := preflightRenameOperations(operations, checkWritableDirectory)
+	if err == nil {
+		t.Fatal("expected preflight error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "duplicate target path detected") {
+		t.Fatalf("expected duplicate target message, got: %v", err)
+	}
+}
+
+func TestPreflightRenameOperationsDetectsExistingTargets(t *testing.T) {
+	tempDir := t.TempDir()
+
+	source := filepath.Join(tempDir, "episode-01.mkv")
+	existingTarget := filepath.Join(tempDir, "Anime - S01E01.mkv")
+
+	for _, path := range []string{source, existingTarget} {
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	err := preflightRenameOperations([]RenameOperation{{OldPath: source, NewPath: existingTarget}}, checkWritableDirectory)
+	if err == nil {
+		t.Fatal("expected preflight error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "target path already exists: "+existingTarget) {
+		t.Fatalf("expected existing target message, got: %v", err)
+	}
+}
+
+func TestPreflightRenameOperationsAllowsTargetsThatAreSources(t *testing.T) {
+	tempDir := t.TempDir()
+
+	first := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	second := filepath.Join(tempDir, "Anime - S01E02.mkv")
+
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	err := preflightRenameOperations([]RenameOperation{
+		{OldPath: first, NewPath: second},
+		{OldPath: second, NewPath: first},
+	}, checkWritableDirectory)
+	if err != nil {
+		t.Fatalf("expected swap to pass preflight, got: %v", err)
+	}
+}
+
+func TestCountPendingOperationsSkipsNoChange(t *testing.T) {
+	operations := []RenameOperation{
+		{OldPath: "a.mkv", NewPath: "Anime - S01E01.mkv"},
+		{OldPath: "Anime - S01E02.mkv", NewPath: "Anime - S01E02.mkv"},
+		{OldPath: "b.srt", NewPath: "Anime - S01E01.srt"},
+	}
+
+	if got := CountPendingOperations(operations); got != 2 {
+		t.Fatalf("CountPendingOperations() = %d, want 2", got)
+	}
+}
+
+func TestExecuteRenameOperationsWithRollback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	oldVideo := filepath.Join(tempDir, "episode-01.mkv")
+	oldSubtitle := filepath.Join(tempDir, "episode-01.srt")
+	newVideo := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	newSubtitle := filepath.Join(tempDir, "Anime - S01E01.srt")
+
+	if err := os.WriteFile(oldVideo, []byte("video"), 0o600); err != nil {
+		t.Fatalf("create video file: %v", err)
+	}
+
+	if err := os.WriteFile(oldSubtitle, []byte("subtitle"), 0o600); err != nil {
+		t.Fatalf("create subtitle file: %v", err)
+	}
+
+	renameFn := func(oldPath string, newPath string) error {
+		if newPath == newSubtitle {
+			return errors.New("forced failure for rollback test")
+		}
+
+		return os.Rename(oldPath, newPath)
+	}
+
+	err := executeRenameOperationsWith(
+		[]RenameOperation{
+			{OldPath: oldVideo, NewPath: newVideo},
+			{OldPath: oldSubtitle, NewPath: newSubtitle},
+		},
+		moveStrategy{move: renameFn},
+		nil,
+	)
+	if err == nil {
+		t.Fatal("expected execution error, got nil")
+	}
+
+	if _, statErr := os.Stat(oldVideo); statErr != nil {
+		t.Fatalf("expected video file restored to original name: %v", statErr)
+	}
+
+	if _, statErr := os.Stat(oldSubtitle); statErr != nil {
+		t.Fatalf("expected subtitle file restored to original name: %v", statErr)
+	}
+
+	if _, statErr := os.Stat(newVideo); !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("expected renamed video to not exist after rollback, got: %v", statErr)
+	}
+
+	if _, statErr := os.Stat(newSubtitle); !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("expected renamed subtitle to not exist after rollback, got: %v", statErr)
+	}
+}
+
+func TestExecuteRenameOperationsContinuingPastAFailure(t *testing.T) {
+	tempDir := t.TempDir()
+
+	operations := []RenameOperation{}
+	for episode := 1; episode <= 3; episode++ {
+		oldPath := filepath.Join(tempDir, fmt.Sprintf("episode-%02d.mkv", episode))
+		if err := os.WriteFile(oldPath, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", oldPath, err)
+		}
+
+		operations = append(operations, RenameOperation{
+			OldPath: oldPath,
+			NewPath: filepath.Join(tempDir, fmt.Sprintf("Anime - S01E%02d.mkv", episode)),
+		})
+	}
+
+	renameFn := func(oldPath string, newPath string) error {
+		if newPath == operations[1].NewPath {
+			return errors.New("forced failure for continue test")
+		}
+
+		return os.Rename(oldPath, newPath)
+	}
+
+	err := executeRenameOperationsContinuingWith(operations, moveStrategy{move: renameFn}, nil)
+	var partialErr *PartialExecutionError
+	if !errors.As(err, &partialErr) || len(partialErr.Failures) != 1 {
+		t.Fatalf("expected one collected failure, got %v", err)
+	}
+
+	completed := partialErr.Completed(operations)
+	if len(completed) != 2 || completed[0] != operations[0] || completed[1] != operations[2] {
+		t.Fatalf("expected the first and third renames to be completed, got %+v", completed)
+	}
+
+	for _, path := range []string{operations[0].NewPath, operations[1].OldPath, operations[2].NewPath} {
+		if _, statErr := os.Stat(path); statErr != nil {
+			t.Fatalf("expected %s after the batch: %v", path, statErr)
+		}
+	}
+
+	report := BuildRunReport(nil, nil, operations, false, err)
+	if report.Stats.Renamed != 2 || report.Stats.Errors != 1 || report.Operations[1].Status != operationError {
+		t.Fatalf("unexpected report for a partial batch: %+v", report)
+	}
+}
+
+func TestExecuteRenameOperationsHandlesCyclicRenames(t *testing.T) {
+	tempDir := t.TempDir()
+
+	paths := []string{}
+	for _, episode := range []string{"01", "02", "03"} {
+		path := filepath.Join(tempDir, "Anime - S01E"+episode+".mkv")
+		if err := os.WriteFile(path, []byte(episode), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	// An off-by-one fix shifts every episode along, closing the cycle with
+	// the last file taking the first name.
+	operations := []RenameOperation{
+		{OldPath: paths[0], NewPath: paths[1]},
+		{OldPath: paths[1], NewPath: paths[2]},
+		{OldPath: paths[2], NewPath: paths[0]},
+	}
+
+	if err := preflightRenameOperations(operations, checkWritableDirectory); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+
+	if err := executeRenameOperations(operations, nil); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for index, want := range []string{"03", "01", "02"} {
+		data, err := os.ReadFile(paths[index])
+		if err != nil || string(data) != want {
+			t.Fatalf("%s holds %q (%v), want %q", paths[index], data, err, want)
+		}
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil || len(entries) != len(paths) {
+		t.Fatalf("expected no temp files left behind, got %v (%v)", entries, err)
+	}
+}
+
+func TestExecuteRenameOperationsWithRestoresCycleOnFailure(t *testing.T) {
+	tempDir := t.TempDir()
+
+	first := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	second := filepath.Join(tempDir, "Anime - S01E02.mkv")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte(filepath.Base(path)), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	failed := false
+	renameFn := func(oldPath string, newPath string) error {
+		if newPath == first && !failed {
+			failed = true
+			return errors.New("forced failure in the second phase")
+		}
+
+		return os.Rename(oldPath, newPath)
+	}
+
+	err := executeRenameOperationsWith(
+		[]RenameOperation{{OldPath: first, NewPath: second}, {OldPath: second, NewPath: first}},
+		moveStrategy{move: renameFn},
+		nil,
+	)
+	if err == nil {
+		t.Fatal("expected execution error, got nil")
+	}
+
+	for _, path := range []string{first, second} {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil || string(data) != filepath.Base(path) {
+			t.Fatalf("expected %s restored with its own contents, got %q (%v)", path, data, readErr)
+		}
+	}
+}
+
+func TestPreflightDryRunWritesNoProbeFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission bits are not enforced for root")
+	}
+
+	// A read-only folder fails the write probe, so passing shows the probe
+	// was skipped.
+	readOnlyDir := filepath.Join(t.TempDir(), "read-only")
+	if err := os.Mkdir(readOnlyDir, 0o755); err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+
+	paths := createSourceFiles(t, readOnlyDir, "Show - 01.mkv")
+	if err := os.Chmod(readOnlyDir, 0o555); err != nil {
+		t.Fatalf("chmod folder: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnlyDir, 0o755) })
+
+	operations := []RenameOperation{{OldPath: paths[0], NewPath: filepath.Join(readOnlyDir, "Anime - S01E01.mkv")}}
+	if err := Preflight(operations, ExecuteOptions{DryRun: true}); err != nil {
+		t.Fatalf("dry-run preflight: %v", err)
+	}
+
+	if err := Preflight(operations, ExecuteOptions{}); err == nil {
+		t.Fatal("expected the write probe to fail in a read-only folder")
+	}
+}
+
+func TestPreflightRenameOperationsReportsPermissionProblems(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission bits are not enforced for root")
+	}
+
+	tempDir := t.TempDir()
+	readOnlyDir := filepath.Join(tempDir, "read-only")
+	if err := os.Mkdir(readOnlyDir, 0o755); err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+
+	lockedSource := filepath.Join(tempDir, "Show - 01.mkv")
+	readOnlySource := filepath.Join(readOnlyDir, "Show - 02.mkv")
+	for _, path := range []string{lockedSource, readOnlySource} {
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	if err := os.Chmod(lockedSource, 0o000); err != nil {
+		t.Fatalf("chmod source: %v", err)
+	}
+
+	if err := os.Chmod(readOnlyDir, 0o555); err != nil {
+		t.Fatalf("chmod folder: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnlyDir, 0o755) })
+
+	err := preflightRenameOperations([]RenameOperation{
+		{OldPath: lockedSource, NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv")},
+		{OldPath: readOnlySource, NewPath: filepath.Join(readOnlyDir, "Anime - S01E02.mkv")},
+	}, checkWritableDirectory)
+
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("expected a preflight error, got %v", err)
+	}
+
+	for _, want := range []string{"not readable: " + lockedSource, "not writable: " + readOnlyDir} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected preflight error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLibraryRenamesFolderEndToEnd(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{
+		"[Group] Show - 01.mkv",
+		"Show - 01.en.srt",
+		"[Group] Show - 02.mkv",
+		"Show - 02.srt",
+		"Show - 03.srt",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	scan, err := Scan(tempDir, ScanOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(scan.Videos) != 2 || len(scan.Subtitles) != 3 || len(scan.Collisions) != 0 {
+		t.Fatalf("unexpected scan result: %+v", scan)
+	}
+
+	pairs, unmatched := Pair(scan.Videos, scan.Subtitles, PairOptions{})
+	if len(pairs) != 2 || len(unmatched) != 1 || unmatched[0].Episode != 3 {
+		t.Fatalf("expected two pairs and the third subtitle unmatched, got %+v and %+v", pairs, unmatched)
+	}
+
+	if _, err := Plan(pairs, PlanOptions{AnimeName: "Show", Template: "{name}"}); err == nil {
+		t.Fatal("expected Plan to reject a template without {episode}")
+	}
+
+	operations, err := Plan(pairs, PlanOptions{AnimeName: "Show", SeasonSubfolders: true})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+
+	if err := Preflight(operations, ExecuteOptions{}); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+
+	if err := Execute(operations, ExecuteOptions{}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for _, name := range []string{
+		filepath.Join("Season 01", "Show - S01E01.mkv"),
+		filepath.Join("Season 01", "Show - S01E01.en.srt"),
+		filepath.Join("Season 01", "Show - S01E02.mkv"),
+		filepath.Join("Season 01", "Show - S01E02.srt"),
+		"Show - 03.srt",
+	} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("expected %s after execute: %v", name, err)
+		}
+	}
+}
+
+func TestScanReportsCollisionsAndEmptyFolders(t *testing.T) {
+	if _, err := Scan(t.TempDir(), ScanOptions{}); err == nil {
+		t.Fatal("expected an error for a folder without videos or subtitles")
+	}
+
+	tempDir := t.TempDir()
+	for _, name := range []string{"Show - 05.mkv", "Show S01E05.mkv", "Show - 06.mkv"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	scan, err := Scan(tempDir, ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(scan.Videos) != 1 || scan.Videos[0].Episode != 6 {
+		t.Fatalf("expected only the sixth episode to be kept, got %+v", scan.Videos)
+	}
+
+	if len(scan.Collisions) != 1 || len(scan.Collisions[0]) != 2 {
+		t.Fatalf("expected one collision of two files, got %+v", scan.Collisions)
+	}
+}
+
+func TestScanNumbersSameNamePairsWithoutEpisodes(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{
+		"Show - 01.mkv",
+		"Show - 01.srt",
+		"Pilot.mkv",
+		"Pilot.en.srt",
+		"Extra Scene.mkv",
+		"Extra Scene.srt",
+		"Bonus.mkv",
+		"Commentary.srt",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	scan, err := Scan(tempDir, ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	pairs, unmatched := Pair(scan.Videos, scan.Subtitles, PairOptions{})
+	got := map[string]string{}
+	for _, pair := range pairs {
+		label := FormatEpisodeLabel(pair.Video)
+		got[filepath.Base(pair.Video.Path)] = label + " " + filepath.Base(pair.Subtitles[0].Path)
+	}
+
+	want := map[string]string{
+		"Show - 01.mkv":   "S01E01 Show - 01.srt",
+		"Extra Scene.mkv": "S01E02 Extra Scene.srt",
+		"Pilot.mkv":       "S01E03 Pilot.en.srt",
+	}
+	if !maps.Equal(got, want) || len(unmatched) != 0 {
+		t.Fatalf("pairs = %v, unmatched %+v, want %v", got, unmatched, want)
+	}
+}
+
+func TestScanNumbersSameNamePairsWithinAFolder(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, folder := range []string{"A", "B", "subs"} {
+		if err := os.Mkdir(filepath.Join(tempDir, folder), 0o755); err != nil {
+			t.Fatalf("create folder: %v", err)
+		}
+	}
+
+	createSourceFiles(
+		t,
+		tempDir,
+		filepath.Join("A", "Pilot.mkv"),
+		filepath.Join("B", "Pilot.srt"),
+		filepath.Join("A", "Special.mkv"),
+		filepath.Join("A", "Special.srt"),
+	)
+
+	scan, err := Scan(tempDir, ScanOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(scan.Videos) != 1 || filepath.Base(scan.Videos[0].Path) != "Special.mkv" || len(scan.Subtitles) != 1 {
+		t.Fatalf("expected only the Special files numbered, got %+v and %+v", scan.Videos, scan.Subtitles)
+	}
+
+	// Subtitles from a separate folder are compared by their place in it.
+	createSourceFiles(t, tempDir, "Movie.mkv", filepath.Join("subs", "Movie.srt"))
+	scan, err = Scan(tempDir, ScanOptions{SubtitleFolder: filepath.Join(tempDir, "subs")})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(scan.Videos) != 1 || len(scan.Subtitles) != 1 || scan.Subtitles[0].Episode != scan.Videos[0].Episode {
+		t.Fatalf("expected Movie.mkv and subs/Movie.srt numbered alike, got %+v and %+v", scan.Videos, scan.Subtitles)
+	}
+}
+
+func TestScanGroupedByDirectoryKeepsEpisodesOfSiblingFolders(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, folder := range []string{"A", "B", "C"} {
+		if err := os.Mkdir(filepath.Join(tempDir, folder), 0o755); err != nil {
+			t.Fatalf("create folder: %v", err)
+		}
+	}
+
+	createSourceFiles(
+		t,
+		tempDir,
+		filepath.Join("A", "Show - 01.mkv"),
+		filepath.Join("A", "Show - 01.srt"),
+		filepath.Join("B", "Show - 01.mkv"),
+		filepath.Join("B", "Show - 01.srt"),
+		filepath.Join("C", "Show - 02.mkv"),
+		filepath.Join("C", "Show - 02.wmv"),
+	)
+
+	scan, err := Scan(tempDir, ScanOptions{
+		Recursive:       true,
+		GroupByDir:      true,
+		VideoExtensions: []string{".mkv", ".wmv"},
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	// Two videos of one episode collide whatever their extensions, as long
+	// as both are configured as videos.
+	if len(scan.Collisions) != 1 || len(scan.Collisions[0]) != 2 {
+		t.Fatalf("collisions = %+v, want the two videos of episode 2", scan.Collisions)
+	}
+
+	pairs, unmatched := Pair(scan.Videos, scan.Subtitles, PairOptions{GroupByDir: true})
+	if len(pairs) != 2 || len(unmatched) != 0 {
+		t.Fatalf("pairs = %+v, unmatched %+v, want one pair per folder", pairs, unmatched)
+	}
+}
+
+func TestScanKeepsEpisodeZero(t *testing.T) {
+	tempDir := t.TempDir()
+	createSourceFiles(t, tempDir, "Show E00.mkv", "Show E00.srt", "Show - 01.mkv", "Show Finale.mkv")
+
+	scan, err := Scan(tempDir, ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, file := range slices.Concat(scan.Videos, scan.Subtitles) {
+		got[filepath.Base(file.Path)] = FormatEpisodeLabel(file)
+	}
+
+	want := map[string]string{
+		"Show E00.mkv":  "S01E00",
+		"Show E00.srt":  "S01E00",
+		"Show - 01.mkv": "S01E01",
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+}
+
+func TestScanNumbersTheFinalSeason(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"Show Final Season - 01.mkv", "Show Final Season - 01.srt", "Show - 02.mkv"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		finalSeason int
+		want        map[string]string
+	}{
+		{
+			name: "flagged",
+			want: map[string]string{
+				"Show Final Season - 01.mkv": "S01E01 true",
+				"Show Final Season - 01.srt": "S01E01 true",
+				"Show - 02.mkv":              "S01E02 false",
+			},
+		},
+		{
+			name:        "numbered",
+			finalSeason: 4,
+			want: map[string]string{
+				"Show Final Season - 01.mkv": "S04E01 true",
+				"Show Final Season - 01.srt": "S04E01 true",
+				"Show - 02.mkv":              "S01E02 false",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			scan, err := Scan(tempDir, ScanOptions{FinalSeason: testCase.finalSeason})
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+
+			got := map[string]string{}
+			for _, file := range slices.Concat(scan.Videos, scan.Subtitles) {
+				got[filepath.Base(file.Path)] = fmt.Sprintf("%s %t", FormatEpisodeLabel(file), file.FinalSeason)
+			}
+
+			if !maps.Equal(got, testCase.want) {
+				t.Fatalf("files = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestSubtitleFolderPairsAcrossFolders(t *testing.T) {
+	videoDir := t.TempDir()
+	subtitleDir := t.TempDir()
+
+	for _, path := range []string{
+		filepath.Join(videoDir, "Show - 01.mkv"),
+		filepath.Join(videoDir, "Show - 02.mkv"),
+		filepath.Join(subtitleDir, "Show - 01.en.srt"),
+		filepath.Join(subtitleDir, "Show - 02.en.srt"),
+		filepath.Join(videoDir, "Show - 01.srt"),
+	} {
+		if err := os.WriteFile(path, []byte(filepath.Base(path)), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	scan, err := Scan(videoDir, ScanOptions{SubtitleFolder: subtitleDir})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(scan.Videos) != 2 || len(scan.Subtitles) != 2 {
+		t.Fatalf("expected videos from one folder and subtitles from the other, got %+v", scan)
+	}
+
+	pairs, unmatched := Pair(scan.Videos, scan.Subtitles, PairOptions{})
+	if len(pairs) != 2 || len(unmatched) != 0 {
+		t.Fatalf("expected pairs across folders, got %+v and %+v", pairs, unmatched)
+	}
+
+	operations, err := Plan(pairs, PlanOptions{AnimeName: "Anime", SubtitlesNextToVideos: true})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+
+	if err := Execute(operations, ExecuteOptions{}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for _, name := range []string{"Anime - S01E01.mkv", "Anime - S01E01.en.srt", "Anime - S01E02.en.srt"} {
+		if _, err := os.Stat(filepath.Join(videoDir, name)); err != nil {
+			t.Fatalf("expected %s next to the videos: %v", name, err)
+		}
+	}
+
+	entries, err := os.ReadDir(subtitleDir)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected the subtitle folder to be emptied, got %v (%v)", entries, err)
+	}
+}
+
+func TestSuggestSeasonOffset(t *testing.T) {
+	video := func(season int, episode int) FileInfo {
+		path := fmt.Sprintf("Show S%02dE%02d.mkv", season, episode)
+		return FileInfo{Path: path, Season: season, Episode: episode, HasSeason: true, Extension: ".mkv"}
+	}
+	subtitle := func(season int, episode int) FileInfo {
+		path := fmt.Sprintf("Show S%02dE%02d.srt", season, episode)
+		return FileInfo{Path: path, Season: season, Episode: episode, HasSeason: true, Extension: ".srt"}
+	}
+
+	testCases := []struct {
+		name       string
+		unmatched  []FileInfo
+		wantOffset int
+		wantOK     bool
+	}{
+		{
+			name:       "subtitles one season higher",
+			unmatched:  []FileInfo{video(1, 1), video(1, 2), subtitle(2, 1), subtitle(2, 2)},
+			wantOffset: -1,
+			wantOK:     true,
+		},
+		{
+			name:       "subtitles one season lower",
+			unmatched:  []FileInfo{video(3, 5), subtitle(2, 5)},
+			wantOffset: 1,
+			wantOK:     true,
+		},
+		{name: "mixed offsets", unmatched: []FileInfo{video(1, 1), video(3, 2), subtitle(2, 1), subtitle(2, 2)}},
+		{name: "subtitle without a video", unmatched: []FileInfo{video(1, 1), subtitle(2, 1), subtitle(2, 7)}},
+		{name: "nothing unmatched"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			offset, ok := SuggestSeasonOffset(testCase.unmatched, VideoExtensions)
+			if offset != testCase.wantOffset || ok != testCase.wantOK {
+				t.Fatalf("SuggestSeasonOffset() = %d, %t, want %d, %t", offset, ok, testCase.wantOffset, testCase.wantOK)
+			}
+		})
+	}
+}
+
+func TestPairAppliesSeasonOffset(t *testing.T) {
+	episode := func(name string, season int, number int, extension string) FileInfo {
+		return FileInfo{Path: name + extension, Season: season, Episode: number, HasSeason: true, Extension: extension}
+	}
+
+	testCases := []struct {
+		name      string
+		offset    int
+		videos    []FileInfo
+		subtitles []FileInfo
+		want      []string
+	}{
+		{
+			name:      "subtitles one season ahead",
+			offset:    -1,
+			videos:    []FileInfo{episode("v1", 1, 1, ".mkv"), episode("v2", 1, 2, ".mkv")},
+			subtitles: []FileInfo{episode("s1", 2, 1, ".srt"), episode("s2", 2, 2, ".srt")},
+			want:      []string{"Anime - S01E01.mkv", "Anime - S01E01.srt", "Anime - S01E02.mkv", "Anime - S01E02.srt"},
+		},
+		{
+			name:      "subtitles one season behind",
+			offset:    1,
+			videos:    []FileInfo{episode("v5", 3, 5, ".mkv")},
+			subtitles: []FileInfo{episode("s5", 2, 5, ".srt")},
+			want:      []string{"Anime - S03E05.mkv", "Anime - S03E05.srt"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if pairs, _ := Pair(testCase.videos, testCase.subtitles, PairOptions{}); len(pairs) != 0 {
+				t.Fatalf("expected no pairs without the offset, got %+v", pairs)
+			}
+
+			pairs, unmatched := Pair(testCase.videos, testCase.subtitles, PairOptions{SeasonOffset: testCase.offset})
+			if len(unmatched) != 0 {
+				t.Fatalf("expected every file to pair, got unmatched %+v", unmatched)
+			}
+
+			operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+			got := []string{}
+			for _, operation := range operations {
+				got = append(got, operation.NewPath)
+			}
+
+			if !slices.Equal(got, testCase.want) {
+				t.Fatalf("unexpected targets %q, want %q", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestPlanSubtitlesOnlyKeepsVideoNames(t *testing.T) {
+	folder := filepath.Join("library", "Show")
+	pairs := []FilePair{{
+		Video: FileInfo{Path: filepath.Join(folder, "Show - S01E01 - Pilot.mkv"), Season: 1, Episode: 1, Extension: ".mkv"},
+		Subtitles: []FileInfo{
+			{Path: filepath.Join(folder, "[Fansub] Show 01.ass"), Season: 1, Episode: 1, Extension: ".ass"},
+			{
+				Path:       filepath.Join(folder, "Show.01.en.forced.srt"),
+				Season:     1,
+				Episode:    1,
+				Extension:  ".srt",
+				Language:   "en",
+				Qualifiers: []string{"forced"},
+			},
+		},
+	}}
+
+	operations, err := Plan(pairs, PlanOptions{SubtitlesOnly: true, SeasonSubfolders: true})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+
+	want := []string{
+		filepath.Join(folder, "Show - S01E01 - Pilot.ass"),
+		filepath.Join(folder, "Show - S01E01 - Pilot.en.forced.srt"),
+	}
+	if len(operations) != len(want) {
+		t.Fatalf("expected only the subtitles to be renamed, got %+v", operations)
+	}
+
+	for index, operation := range operations {
+		if operation.NewPath != want[index] {
+			t.Fatalf("target %d = %q, want %q", index, operation.NewPath, want[index])
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package renamer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	operationPlanned = "planned"
+	operationSuccess = "success"
+	operationSkipped = "skipped"
+	operationError   = "error"
+)
+
+type reportFile struct {
+	Path        string `json:"path"`
+	Season      int    `json:"season"`
+	Episode     int    `json:"episode"`
+	EpisodePart int    `json:"episodePart,omitempty"`
+	EpisodeEnd  int    `json:"episodeEnd,omitempty"`
+}
+
+type reportPair struct {
+	Video     reportFile   `json:"video"`
+	Subtitles []reportFile `json:"subtitles"`
+	Fuzzy     bool         `json:"fuzzy,omitempty"`
+	Partial   bool         `json:"partialRange,omitempty"`
+	Similar   bool         `json:"similarName,omitempty"`
+}
+
+type OperationResult struct {
+	OldPath string `json:"oldPath"`
+	NewPath string `json:"newPath"`
+	Season  int    `json:"season"`
+	Episode int    `json:"episode"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RunStats counts the pairs and files of a run by outcome. Operations that
+// failed or were rolled back count as errors.
+type RunStats struct {
+	Pairs     int `json:"pairs"`
+	Renamed   int `json:"renamed"`
+	Planned   int `json:"planned"`
+	Skipped   int `json:"skipped"`
+	Unmatched int `json:"unmatched"`
+	Errors    int `json:"errors"`
+}
+
+type RunReport struct {
+	DryRun     bool              `json:"dryRun"`
+	Stats      RunStats          `json:"stats"`
+	Pairs      []reportPair      `json:"pairs"`
+	Unmatched  []reportFile      `json:"unmatched"`
+	Operations []OperationResult `json:"operations"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func BuildRunReport(
+	pairs []FilePair,
+	unmatched []FileInfo,
+	operations []RenameOperation,
+	dryRun bool,
+	runErr error,
+) RunReport {
+	report := RunReport{
+		DryRun:     dryRun,
+		Pairs:      []reportPair{},
+		Unmatched:  []reportFile{},
+		Operations: operationResults(pairs, operations, dryRun, runErr),
+	}
+
+	for _, pair := range pairs {
+		entry := reportPair{
+			Video:     newReportFile(pair.Video),
+			Subtitles: []reportFile{},
+			Fuzzy:     pair.Fuzzy,
+			Partial:   pair.PartialRange,
+			Similar:   pair.SimilarName,
+		}
+		for _, subtitle := range pair.Subtitles {
+			entry.Subtitles = append(entry.Subtitles, newReportFile(subtitle))
+		}
+
+		report.Pairs = append(report.Pairs, entry)
+	}
+
+	for _, file := range unmatched {
+		report.Unmatched = append(report.Unmatched, newReportFile(file))
+	}
+
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+
+	report.Stats = RunStats{Pairs: len(pairs), Unmatched: len(unmatched)}
+	for _, result := range report.Operations {
+		switch result.Status {
+		case operationSuccess:
+			report.Stats.Renamed++
+		case operationPlanned:
+			report.Stats.Planned++
+		case operationSkipped:
+			report.Stats.Skipped++
+		case operationError:
+			report.Stats.Errors++
+		}
+	}
+
+	return report
+}
+
+func newReportFile(file FileInfo) reportFile {
+	return reportFile{
+		Path:        file.Path,
+		Season:      file.Season,
+		Episode:     file.Episode,
+		EpisodePart: file.EpisodePart,
+		EpisodeEnd:  file.EpisodeEnd,
+	}
+}
+
+func operationResults(
+	pairs []FilePair,
+	operations []RenameOperation,
+	dryRun bool,
+	runErr error,
+) []OperationResult {
+	filesByPath := map[string]FileInfo{}
+	for _, pair := range pairs {
+		for _, file := range append([]FileInfo{pair.Video}, pair.Subtitles...) {
+			filesByPath[file.Path] = file
+			for _, companion := range file.Companions {
+				filesByPath[companion] = file
+			}
+		}
+	}
+
+	var executionErr *RenameExecutionError
+	var partialErr *PartialExecutionError
+	if !errors.As(runErr, &partialErr) {
+		errors.As(runErr, &executionErr)
+	}
+
+	results := make([]OperationResult, 0, len(operations))
+
+	for _, operation := range operations {
+		file := filesByPath[operation.OldPath]
+		result := OperationResult{
+			OldPath: operation.OldPath,
+			NewPath: operation.NewPath,
+			Season:  file.Season,
+			Episode: file.Episode,
+		}
+
+		switch {
+		case operation.AlreadyNamed():
+			result.Status = operationSkipped
+			result.Reason = "already named"
+		case dryRun:
+			result.Status = operationPlanned
+		case runErr == nil, partialErr != nil && !partialErr.Failed(operation):
+			result.Status = operationSuccess
+		case partialErr != nil:
+			result.Status = operationError
+			result.Error = partialErr.failure(operation).Err.Error()
+		case executionErr != nil && (executionErr.From == operation.OldPath || executionErr.To == operation.NewPath):
+			result.Status = operationError
+			result.Error = runErr.Error()
+		default:
+			// Any failure rolls the whole batch back, so the other files keep
+			// their original names as well.
+			result.Status = operationError
+			result.Error = "rolled back after another rename failed"
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func WriteRunReport(writer io.Writer, report RunReport) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("writing JSON report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestWriteRunReportRoundTrips(t *testing.T) {
+	pairs := []FilePair{
+		{
+			Video:     FileInfo{Path: "Show - 01.mkv", Season: 1, Episode: 1, Extension: ".mkv"},
+			Subtitles: []FileInfo{{Path: "Show - 01.srt", Season: 1, Episode: 1, Extension: ".srt"}},
+		},
+		{
+			Video:     FileInfo{Path: "Show - 02.mkv", Season: 1, Episode: 2, Extension: ".mkv"},
+			Subtitles: []FileInfo{{Path: "Show - 02.srt", Season: 1, Episode: 2, Extension: ".srt"}},
+		},
+	}
+	unmatched := []FileInfo{{Path: "Show - 03.mkv", Season: 1, Episode: 3, Extension: ".mkv"}}
+	operations := buildRenameOperations(pairs, "Anime", DefaultTemplate)
+
+	var output bytes.Buffer
+	if err := WriteRunReport(&output, BuildRunReport(pairs, unmatched, operations, false, nil)); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+
+	report := RunReport{}
+	if err := json.Unmarshal(output.Bytes(), &report); err != nil {
+		t.Fatalf("unmarshal report: %v\n%s", err, output.String())
+	}
+
+	if len(report.Pairs) != 2 || len(report.Unmatched) != 1 || len(report.Operations) != 4 {
+		t.Fatalf("unexpected report sizes: %+v", report)
+	}
+
+	operation := report.Operations[2]
+	if operation.NewPath != "Anime - S01E02.mkv" || operation.Episode != 2 || operation.Status != operationSuccess {
+		t.Fatalf("unexpected operation result: %+v", operation)
+	}
+}
+
+func TestOperationResultsMarksFailedOperation(t *testing.T) {
+	operations := []RenameOperation{
+		{OldPath: "a.mkv", NewPath: "Anime - S01E01.mkv"},
+		{OldPath: "a.srt", NewPath: "Anime - S01E01.srt"},
+		{OldPath: "Anime - S01E02.mkv", NewPath: "Anime - S01E02.mkv"},
+	}
+	runErr := &RenameExecutionError{Phase: "phase-two", From: "tmp", To: "Anime - S01E01.srt", Err: errors.New("boom")}
+
+	results := operationResults(nil, operations, false, runErr)
+
+	if results[1].Status != operationError || results[1].Error != runErr.Error() {
+		t.Fatalf("expected failing operation to carry the error, got %+v", results[1])
+	}
+
+	if results[0].Status != operationError || results[0].Error == runErr.Error() {
+		t.Fatalf("expected other operation to be reported as rolled back, got %+v", results[0])
+	}
+
+	if results[2].Status != operationSkipped || results[2].Reason != "already named" {
+		t.Fatalf("expected no-op to be skipped, got %+v", results[2])
+	}
+}
+
+func TestBuildRunReportCountsMixedBatch(t *testing.T) {
+	pairs := []FilePair{
+		{Video: FileInfo{Path: "a.mkv", Episode: 1}, Subtitles: []FileInfo{{Path: "a.srt", Episode: 1}}},
+		{Video: FileInfo{Path: "Anime - S01E02.mkv", Episode: 2}, Subtitles: []FileInfo{{Path: "b.srt", Episode: 2}}},
+	}
+	unmatched := []FileInfo{{Path: "c.mkv", Episode: 3}, {Path: "d.srt", Episode: 4}, {Path: "e.srt", Episode: 5}}
+	operations := []RenameOperation{
+		{OldPath: "a.mkv", NewPath: "Anime - S01E01.mkv"},
+		{OldPath: "a.srt", NewPath: "Anime - S01E01.srt"},
+		{OldPath: "Anime - S01E02.mkv", NewPath: "Anime - S01E02.mkv"},
+		{OldPath: "b.srt", NewPath: "Anime - S01E02.srt"},
+	}
+	runErr := &RenameExecutionError{Phase: "phase-two", From: "tmp", To: "Anime - S01E02.srt", Err: errors.New("boom")}
+
+	testCases := []struct {
+		name   string
+		dryRun bool
+		runErr error
+		want   RunStats
+	}{
+		{name: "success", want: RunStats{Pairs: 2, Renamed: 3, Skipped: 1, Unmatched: 3}},
+		{name: "dry run", dryRun: true, want: RunStats{Pairs: 2, Planned: 3, Skipped: 1, Unmatched: 3}},
+		{name: "failure", runErr: runErr, want: RunStats{Pairs: 2, Skipped: 1, Unmatched: 3, Errors: 3}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			report := BuildRunReport(pairs, unmatched, operations, testCase.dryRun, testCase.runErr)
+			if report.Stats != testCase.want {
+				t.Fatalf("unexpected stats %+v, want %+v", report.Stats, testCase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package renamer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// sniffLength is how much of a file is read to recognize its format.
+const sniffLength = 4096
+
+// sniffOnlyExtensions are scanned only with sniffing, for subtitles saved
+// with the wrong extension.
+var sniffOnlyExtensions = []string{".txt"}
+
+var srtTimestampPattern = regexp.MustCompile(`(?m)^\d{1,2}:\d{2}:\d{2}[,.]\d{3} --> \d{1,2}:\d{2}:\d{2}[,.]\d{3}`)
+
+// fileFormat is a container or subtitle format recognized by its first
+// bytes. The first extension is used for files whose extension belongs to
+// another format.
+type fileFormat struct {
+	Name       string
+	Video      bool
+	Extensions []string
+	Matches    func(head []byte) bool
+}
+
+var fileFormats = []fileFormat{
+	{Name: "Matroska", Video: true, Extensions: []string{".mkv", ".webm"}, Matches: func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3})
+	}},
+	{Name: "MP4", Video: true, Extensions: []string{".mp4", ".m4v", ".mov"}, Matches: func(head []byte) bool {
+		return len(head) >= 8 && string(head[4:8]) == "ftyp"
+	}},
+	{Name: "AVI", Video: true, Extensions: []string{".avi"}, Matches: func(head []byte) bool {
+		return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI "
+	}},
+	{Name: "MPEG-TS", Video: true, Extensions: []string{".ts"}, Matches: func(head []byte) bool {
+		return len(head) > 188 && head[0] == 0x47 && head[188] == 0x47
+	}},
+	{Name: "ASS", Extensions: []string{".ass", ".ssa"}, Matches: func(head []byte) bool {
+		return bytes.HasPrefix(trimByteOrderMark(head), []byte("[Script Info]"))
+	}},
+	{Name: "WebVTT", Extensions: []string{".vtt"}, Matches: func(head []byte) bool {
+		return bytes.HasPrefix(trimByteOrderMark(head), []byte("WEBVTT"))
+	}},
+	{Name: "SRT", Extensions: []string{".srt"}, Matches: srtTimestampPattern.Match},
+}
+
+func trimByteOrderMark(head []byte) []byte {
+	return bytes.TrimPrefix(head, []byte{0xEF, 0xBB, 0xBF})
+}
+
+// sniffFormat reads the start of a file and returns its format, or nil when
+// none is recognized.
+func sniffFormat(path string) (*fileFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("sniffing %s: %w", path, err)
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("sniffing %s: %w", path, err)
+	}
+
+	for index := range fileFormats {
+		if fileFormats[index].Matches(head[:n]) {
+			return &fileFormats[index], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// findSniffedFiles scans for videos and subtitles together and sorts every
+// file by its content instead of its extension, which is corrected when it
+// belongs to another format. Files whose format isn't recognized keep the
+// kind their extension says, except for the sniff-only ones.
+func findSniffedFiles(
+	folderPath string,
+	videoExtensions []string,
+	subtitleExtensions []string,
+	options findOptions,
+) ([]FileInfo, []FileInfo, error) {
+	options.Extensions = slices.Concat(videoExtensions, subtitleExtensions, sniffOnlyExtensions)
+	files, err := findFiles(folderPath, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	videoFiles := []FileInfo{}
+	subtitleFiles := []FileInfo{}
+
+	for _, file := range files {
+		format, err := sniffFormat(file.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		video := slices.Contains(videoExtensions, file.Extension)
+		switch {
+		case format != nil:
+			video = format.Video
+			if !slices.Contains(format.Extensions, file.Extension) {
+				Debugf("%s looks like %s, using %s\n", file.Path, format.Name, format.Extensions[0])
+				file.Extension = format.Extensions[0]
+				if !video {
+					_, file.Language, file.Qualifiers = splitSubtitleTags(filepath.Base(file.Path))
+				}
+			}
+		case slices.Contains(sniffOnlyExtensions, file.Extension):
+			Debugf("%s is not a recognized subtitle format, skipping\n", file.Path)
+			continue
+		}
+
+		if video {
+			videoFiles = append(videoFiles, file)
+		} else {
+			subtitleFiles = append(subtitleFiles, file)
+		}
+	}
+
+	return videoFiles, subtitleFiles, nil
+}
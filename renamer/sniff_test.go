@@ -0,0 +1,112 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const srtFixture = "1\n00:00:01,000 --> 00:00:04,000\nHello\n"
+
+func TestSniffFormat(t *testing.T) {
+	tempDir := t.TempDir()
+
+	transportStream := make([]byte, 400)
+	transportStream[0], transportStream[188], transportStream[376] = 0x47, 0x47, 0x47
+
+	testCases := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{name: "matroska", content: []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, want: "Matroska"},
+		{name: "mp4", content: []byte("\x00\x00\x00\x18ftypisom"), want: "MP4"},
+		{name: "avi", content: []byte("RIFF\x00\x00\x00\x00AVI LIST"), want: "AVI"},
+		{name: "transport stream", content: transportStream, want: "MPEG-TS"},
+		{name: "ass with byte order mark", content: []byte("\xEF\xBB\xBF[Script Info]\nTitle: x\n"), want: "ASS"},
+		{name: "webvtt", content: []byte("WEBVTT\n\n00:01.000 --> 00:04.000\nHello\n"), want: "WebVTT"},
+		{name: "srt", content: []byte(srtFixture), want: "SRT"},
+		{name: "plain text", content: []byte("episode notes"), want: ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, testCase.name)
+			if err := os.WriteFile(path, testCase.content, 0o600); err != nil {
+				t.Fatalf("create %s: %v", path, err)
+			}
+
+			format, err := sniffFormat(path)
+			if err != nil {
+				t.Fatalf("sniff %s: %v", path, err)
+			}
+
+			got := ""
+			if format != nil {
+				got = format.Name
+			}
+
+			if got != testCase.want {
+				t.Fatalf("sniffFormat(%s) = %q, want %q", testCase.name, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestScanSniffReclassifiesMislabeledFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"Show - 01.mp4":    "\x1A\x45\xDF\xA3matroska",
+		"Show - 01.en.txt": srtFixture,
+		"Show - 02.mkv":    "[Script Info]\nTitle: Show\n",
+		"Show - 02.mp4":    "\x00\x00\x00\x18ftypisom",
+		"Notes 03.txt":     "not a subtitle",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	plain, err := Scan(tempDir, ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	if len(plain.Videos) != 1 || len(plain.Subtitles) != 0 || len(plain.Collisions) != 1 {
+		t.Fatalf("expected the extensions to be trusted without sniffing, got %+v", plain)
+	}
+
+	sniffed, err := Scan(tempDir, ScanOptions{Sniff: true})
+	if err != nil {
+		t.Fatalf("scan with sniffing: %v", err)
+	}
+
+	if len(sniffed.Videos) != 2 || len(sniffed.Subtitles) != 2 {
+		t.Fatalf("expected two videos and two subtitles, got %+v", sniffed)
+	}
+
+	want := map[string]FileInfo{
+		"Show - 01.mp4":    {Extension: ".mkv"},
+		"Show - 01.en.txt": {Extension: ".srt", Language: "en"},
+		"Show - 02.mkv":    {Extension: ".ass"},
+		"Show - 02.mp4":    {Extension: ".mp4"},
+	}
+	for _, file := range append(sniffed.Videos, sniffed.Subtitles...) {
+		expected, ok := want[filepath.Base(file.Path)]
+		if !ok || file.Extension != expected.Extension || file.Language != expected.Language {
+			t.Fatalf("unexpected sniffed file %+v", file)
+		}
+	}
+
+	pairs, unmatched := Pair(sniffed.Videos, sniffed.Subtitles, PairOptions{})
+	if len(pairs) != 2 || len(unmatched) != 0 {
+		t.Fatalf("expected the sniffed files to pair, got %+v and %+v", pairs, unmatched)
+	}
+
+	operations := buildRenameOperations(pairs, "Show", DefaultTemplate)
+	if got := filepath.Base(operations[1].NewPath); got != "Show - S01E01.en.srt" {
+		t.Fatalf("expected the subtitle to get the .srt extension, got %q", got)
+	}
+}
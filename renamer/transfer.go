@@ -0,0 +1,374 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ModeRename   = "rename"
+	ModeCopy     = "copy"
+	ModeHardlink = "hardlink"
+	ModeSymlink  = "symlink"
+)
+
+var TransferModes = []string{ModeRename, ModeCopy, ModeHardlink, ModeSymlink}
+
+func KeepsSources(mode string) bool {
+	return mode == ModeCopy || mode == ModeHardlink || mode == ModeSymlink
+}
+
+// renameStrategy is how a batch produces its targets. Apply creates the
+// target of an operation and Undo takes that back, so a rollback moves a
+// renamed file back but deletes a copy.
+type renameStrategy interface {
+	Apply(operation RenameOperation) error
+	Undo(operation RenameOperation) error
+}
+
+// moveStrategy renames files, and moves them back on Undo.
+type moveStrategy struct {
+	move renameExecutor
+}
+
+func (s moveStrategy) Apply(operation RenameOperation) error {
+	return s.move(operation.OldPath, operation.NewPath)
+}
+
+func (s moveStrategy) Undo(operation RenameOperation) error {
+	return s.move(operation.NewPath, operation.OldPath)
+}
+
+// copyStrategy creates targets next to the originals with transfer, a copy
+// or a link, and deletes them on Undo.
+type copyStrategy struct {
+	transfer renameExecutor
+}
+
+func (s copyStrategy) Apply(operation RenameOperation) error {
+	return s.transfer(operation.OldPath, operation.NewPath)
+}
+
+func (s copyStrategy) Undo(operation RenameOperation) error {
+	remove := os.Remove
+	if info, err := os.Lstat(operation.NewPath); err == nil && info.IsDir() {
+		remove = os.RemoveAll
+	}
+
+	if err := remove(operation.NewPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing created file %s: %w", operation.NewPath, err)
+	}
+
+	return nil
+}
+
+func executeOperations(operations []RenameOperation, options ExecuteOptions) error {
+	copyFn, linkFn, renameFn := renameExecutor(copyFile), renameExecutor(linkFile), renameExecutor(os.Rename)
+	if options.PreserveModTimes {
+		copyFn, linkFn, renameFn = keepModTime(copyFn), keepModTime(linkFn), keepModTime(renameFn)
+	}
+
+	switch options.Mode {
+	case ModeCopy:
+		return executeCopyOperationsWith(operations, copyStrategy{transfer: copyFn}, options.Progress)
+	case ModeHardlink:
+		return executeCopyOperationsWith(operations, copyStrategy{transfer: linkFn}, options.Progress)
+	case ModeSymlink:
+		creator := &symlinkCreator{replace: options.ReplaceLinks, replaced: map[string]string{}}
+		err := executeCopyOperationsWith(operations, copyStrategy{transfer: creator.link}, options.Progress)
+		if err != nil {
+			if restoreErr := creator.restore(); restoreErr != nil {
+				return errors.Join(err, fmt.Errorf("restoring replaced links failed: %w", restoreErr))
+			}
+		}
+
+		return err
+	default:
+		if options.ContinueOnError {
+			return executeRenameOperationsContinuingWith(operations, moveStrategy{move: renameFn}, options.Progress)
+		}
+
+		return executeRenameOperationsWith(operations, moveStrategy{move: renameFn}, options.Progress)
+	}
+}
+
+// keepModTime gives the target of transfer the modification time of its
+// original, which a copy would otherwise set to now. Symbolic links are
+// left out, since changing a link's time changes the original's. A time
+// that can't be set doesn't fail the batch, the file itself is in place.
+func keepModTime(transfer renameExecutor) renameExecutor {
+	return func(oldPath string, newPath string) error {
+		info, err := os.Stat(oldPath)
+		if err != nil {
+			return err
+		}
+
+		if err := transfer(oldPath, newPath); err != nil {
+			return err
+		}
+
+		if err := os.Chtimes(newPath, time.Time{}, info.ModTime()); err != nil {
+			Debugf("keeping the modification time of %s failed: %v\n", newPath, err)
+		}
+
+		return nil
+	}
+}
+
+// executeCopyOperationsWith creates every target with strategy and leaves
+// the originals alone. Targets never replace a source here, so there is no
+// temp phase, and a rollback undoes what was created in reverse order.
+func executeCopyOperationsWith(operations []RenameOperation, strategy renameStrategy, progress ProgressFunc) error {
+	total := CountPendingOperations(operations)
+	applied := []RenameOperation{}
+	createdDirs := []string{}
+
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		created, err := createTargetDirectory(filepath.Dir(operation.NewPath))
+		createdDirs = append(createdDirs, created...)
+		if err == nil {
+			err = strategy.Apply(operation)
+		}
+
+		if err != nil {
+			executionErr := &RenameExecutionError{
+				Phase: "copy",
+				From:  operation.OldPath,
+				To:    operation.NewPath,
+				Err:   err,
+			}
+
+			rollbackErr := errors.Join(undoOperations(applied, strategy), removeCreatedDirectories(createdDirs))
+			if rollbackErr != nil {
+				return errors.Join(executionErr, fmt.Errorf("rollback failed: %w", rollbackErr))
+			}
+
+			return executionErr
+		}
+
+		applied = append(applied, operation)
+		progress.report(len(applied), total)
+	}
+
+	return nil
+}
+
+func undoOperations(operations []RenameOperation, strategy renameStrategy) error {
+	undoErrors := []error{}
+
+	for index := len(operations) - 1; index >= 0; index-- {
+		if err := strategy.Undo(operations[index]); err != nil {
+			undoErrors = append(undoErrors, err)
+		}
+	}
+
+	return errors.Join(undoErrors...)
+}
+
+func copyFile(oldPath string, newPath string) error {
+	source, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return copyDirectory(oldPath, newPath, info.Mode().Perm())
+	}
+
+	target, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, copyErr := io.Copy(target, source)
+	closeErr := target.Close()
+	if err := errors.Join(copyErr, closeErr); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	return nil
+}
+
+// copyDirectory copies a companion folder, like the fonts of a subtitle,
+// with everything in it. A failed copy leaves nothing behind.
+func copyDirectory(oldPath string, newPath string, perm os.FileMode) error {
+	if err := os.Mkdir(newPath, perm); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(oldPath)
+	if err == nil {
+		for _, entry := range entries {
+			if err = copyFile(filepath.Join(oldPath, entry.Name()), filepath.Join(newPath, entry.Name())); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+
+	return nil
+}
+
+// linkFile falls back to a copy when a hard link isn't possible, e.g. when
+// the output folder is on another file system.
+func linkFile(oldPath string, newPath string) error {
+	return linkFileWith(oldPath, newPath, os.Link, copyFile)
+}
+
+func linkFileWith(oldPath string, newPath string, linkFn renameExecutor, fallbackFn renameExecutor) error {
+	linkErr := linkFn(oldPath, newPath)
+	if linkErr == nil {
+		return nil
+	}
+
+	if errors.Is(linkErr, os.ErrExist) {
+		return linkErr
+	}
+
+	Debugf("hard link %s failed, copying instead: %v\n", newPath, linkErr)
+	return fallbackFn(oldPath, newPath)
+}
+
+// symlinkCreator links targets to the absolute path of their original and
+// remembers the links it replaced so a failed batch can put them back.
+type symlinkCreator struct {
+	replace  bool
+	replaced map[string]string
+}
+
+func (c *symlinkCreator) link(oldPath string, newPath string) error {
+	target, err := filepath.Abs(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if c.replace && isSymlink(newPath) {
+		previousTarget, err := os.Readlink(newPath)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(newPath); err != nil {
+			return err
+		}
+
+		c.replaced[newPath] = previousTarget
+	}
+
+	return os.Symlink(target, newPath)
+}
+
+func (c *symlinkCreator) restore() error {
+	restoreErrors := []error{}
+
+	for path, target := range c.replaced {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			restoreErrors = append(restoreErrors, err)
+			continue
+		}
+
+		if err := os.Symlink(target, path); err != nil {
+			restoreErrors = append(restoreErrors, err)
+		}
+	}
+
+	return errors.Join(restoreErrors...)
+}
+
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// statIgnoringSymlinks leaves existing links at a target to the symlink
+// checks in preflightOperations, which know whether they may be replaced.
+func statIgnoringSymlinks(path string) (os.FileInfo, error) {
+	if isSymlink(path) {
+		return nil, os.ErrNotExist
+	}
+
+	return os.Stat(path)
+}
+
+// moveIntoOutputDirectory keeps each target's path relative to the scanned
+// folder but places it under outputDir.
+func moveIntoOutputDirectory(operations []RenameOperation, folderPath string, outputDir string) ([]RenameOperation, error) {
+	moved := make([]RenameOperation, 0, len(operations))
+
+	for _, operation := range operations {
+		relativePath, err := filepath.Rel(folderPath, operation.NewPath)
+		if err != nil {
+			return nil, fmt.Errorf("placing %s in output folder: %w", operation.NewPath, err)
+		}
+
+		operation.NewPath = filepath.Join(outputDir, relativePath)
+		moved = append(moved, operation)
+	}
+
+	return moved, nil
+}
+
+func preflightOperations(operations []RenameOperation, options ExecuteOptions) error {
+	checkWritable := checkWritableDirectory
+	if options.DryRun {
+		checkWritable = skipWritableCheck
+	}
+
+	if !KeepsSources(options.Mode) {
+		return preflightRenameOperations(operations, checkWritable)
+	}
+
+	statTarget := os.Stat
+	if options.Mode == ModeSymlink {
+		statTarget = statIgnoringSymlinks
+	}
+
+	err := preflightRenameOperationsWith(operations, statTarget, checkWritable)
+	issues := []string{}
+
+	// A rename may take a name another source is about to give up, but a copy
+	// or link would overwrite that original instead.
+	sourcePaths := map[string]struct{}{}
+	for _, operation := range operations {
+		sourcePaths[operation.OldPath] = struct{}{}
+	}
+
+	for _, operation := range operations {
+		if operation.AlreadyNamed() {
+			continue
+		}
+
+		if _, exists := sourcePaths[operation.NewPath]; exists {
+			issues = append(
+				issues,
+				fmt.Sprintf("target path is an original file that %s would overwrite: %s", options.Mode, operation.NewPath),
+			)
+			continue
+		}
+
+		if options.Mode == ModeSymlink && !options.ReplaceLinks && isSymlink(operation.NewPath) {
+			issues = append(issues, fmt.Sprintf("symlink already exists (use -replace-links to replace it): %s", operation.NewPath))
+		}
+	}
+
+	return withPreflightIssues(err, issues)
+}
@@ -0,0 +1,348 @@
+package renamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createSourceFiles(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func TestExecuteOperationsModes(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mode       string
+		keepSource bool
+		sameFile   bool
+	}{
+		{name: "rename", mode: ModeRename},
+		{name: "copy", mode: ModeCopy, keepSource: true},
+		{name: "hardlink", mode: ModeHardlink, keepSource: true, sameFile: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			source := createSourceFiles(t, tempDir, "Show - 01.mkv")[0]
+			target := filepath.Join(tempDir, "out", "Anime - S01E01.mkv")
+			operations := []RenameOperation{{OldPath: source, NewPath: target}}
+
+			if err := preflightOperations(operations, ExecuteOptions{Mode: testCase.mode}); err != nil {
+				t.Fatalf("preflight: %v", err)
+			}
+
+			progress := []int{}
+			options := ExecuteOptions{Mode: testCase.mode, Progress: func(done int, total int) {
+				progress = append(progress, done, total)
+			}}
+			if err := executeOperations(operations, options); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if len(progress) != 2 || progress[0] != 1 || progress[1] != 1 {
+				t.Fatalf("expected progress 1 of 1, got %v", progress)
+			}
+
+			data, err := os.ReadFile(target)
+			if err != nil || string(data) != "Show - 01.mkv" {
+				t.Fatalf("expected target with source contents, got %q (%v)", data, err)
+			}
+
+			sourceInfo, sourceErr := os.Stat(source)
+			if (sourceErr == nil) != testCase.keepSource {
+				t.Fatalf("source kept = %t, want %t", sourceErr == nil, testCase.keepSource)
+			}
+
+			if !testCase.keepSource {
+				return
+			}
+
+			targetInfo, err := os.Stat(target)
+			if err != nil {
+				t.Fatalf("stat target: %v", err)
+			}
+
+			if os.SameFile(sourceInfo, targetInfo) != testCase.sameFile {
+				t.Fatalf("same file = %t, want %t", !testCase.sameFile, testCase.sameFile)
+			}
+		})
+	}
+}
+
+func TestExecuteOperationsPreservesModTimes(t *testing.T) {
+	modTime := time.Date(2020, time.April, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, preserve := range []bool{true, false} {
+		tempDir := t.TempDir()
+		source := createSourceFiles(t, tempDir, "Show - 01.mkv")[0]
+		if err := os.Chtimes(source, modTime, modTime); err != nil {
+			t.Fatalf("set source time: %v", err)
+		}
+
+		target := filepath.Join(tempDir, "out", "Anime - S01E01.mkv")
+		options := ExecuteOptions{Mode: ModeCopy, PreserveModTimes: preserve}
+		if err := executeOperations([]RenameOperation{{OldPath: source, NewPath: target}}, options); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		info, err := os.Stat(target)
+		if err != nil {
+			t.Fatalf("stat copy: %v", err)
+		}
+
+		if info.ModTime().Equal(modTime) != preserve {
+			t.Fatalf("copy time %v with PreserveModTimes %t, original %v", info.ModTime(), preserve, modTime)
+		}
+	}
+}
+
+func TestExecuteCopyOperationsWithRollbackDeletesCopies(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sources := createSourceFiles(t, tempDir, "Show - 01.mkv", "Show - 02.mkv")
+	outputDir := filepath.Join(tempDir, "out")
+	operations := []RenameOperation{
+		{OldPath: sources[0], NewPath: filepath.Join(outputDir, "Anime - S01E01.mkv")},
+		{OldPath: sources[1], NewPath: filepath.Join(outputDir, "Anime - S01E02.mkv")},
+	}
+
+	copyFn := func(oldPath, newPath string) error {
+		if oldPath == sources[1] {
+			return errors.New("simulated copy failure")
+		}
+
+		return copyFile(oldPath, newPath)
+	}
+
+	err := executeCopyOperationsWith(operations, copyStrategy{transfer: copyFn}, nil)
+	var executionErr *RenameExecutionError
+	if !errors.As(err, &executionErr) || executionErr.From != sources[1] {
+		t.Fatalf("expected a copy error for the second file, got %v", err)
+	}
+
+	if _, err := os.Stat(outputDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected copies and output folder to be deleted, got %v", err)
+	}
+
+	for _, source := range sources {
+		if _, err := os.Stat(source); err != nil {
+			t.Fatalf("expected original %s to be untouched: %v", source, err)
+		}
+	}
+}
+
+func TestCopyFileRefusesToOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	paths := createSourceFiles(t, tempDir, "a.mkv", "b.mkv")
+
+	if err := copyFile(paths[0], paths[1]); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected copyFile to refuse an existing target, got %v", err)
+	}
+
+	data, err := os.ReadFile(paths[1])
+	if err != nil || string(data) != "b.mkv" {
+		t.Fatalf("expected existing target to be untouched, got %q (%v)", data, err)
+	}
+}
+
+func TestLinkFileWithFallsBackToCopy(t *testing.T) {
+	failingLink := func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: errors.New("cross-device link")}
+	}
+
+	copied := false
+	fallback := func(oldPath, newPath string) error {
+		copied = true
+		return nil
+	}
+
+	if err := linkFileWith("a.mkv", "b.mkv", failingLink, fallback); err != nil || !copied {
+		t.Fatalf("expected fallback copy, got copied=%t err=%v", copied, err)
+	}
+
+	existingTarget := func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	copied = false
+	if err := linkFileWith("a.mkv", "b.mkv", existingTarget, fallback); err == nil || copied {
+		t.Fatalf("expected an existing target to fail without copying, got copied=%t err=%v", copied, err)
+	}
+}
+
+func TestPreflightOperationsRejectsOverwritingOriginals(t *testing.T) {
+	tempDir := t.TempDir()
+	sources := createSourceFiles(t, tempDir, "Show - 01.mkv", "Anime - S01E01.mkv")
+
+	operations := []RenameOperation{
+		{OldPath: sources[0], NewPath: sources[1]},
+		{OldPath: sources[1], NewPath: filepath.Join(tempDir, "Anime - S01E02.mkv")},
+	}
+
+	if err := preflightOperations(operations, ExecuteOptions{Mode: ModeRename}); err != nil {
+		t.Fatalf("expected rename chain to pass preflight, got %v", err)
+	}
+
+	err := preflightOperations(operations, ExecuteOptions{Mode: ModeCopy})
+	if err == nil || !strings.Contains(err.Error(), "would overwrite") {
+		t.Fatalf("expected copy preflight to reject overwriting an original, got %v", err)
+	}
+}
+
+func TestMoveIntoOutputDirectory(t *testing.T) {
+	folder := filepath.Join("downloads", "Show")
+	outputDir := filepath.Join("library", "Show")
+
+	operations, err := moveIntoOutputDirectory([]RenameOperation{{
+		OldPath: filepath.Join(folder, "Season 2", "Show - 01.mkv"),
+		NewPath: filepath.Join(folder, "Season 2", "Anime - S02E01.mkv"),
+	}}, folder, outputDir)
+	if err != nil {
+		t.Fatalf("move into output folder: %v", err)
+	}
+
+	want := filepath.Join(outputDir, "Season 2", "Anime - S02E01.mkv")
+	if operations[0].NewPath != want {
+		t.Fatalf("target = %q, want %q", operations[0].NewPath, want)
+	}
+}
+
+func TestSymlinkModeLinksIntoLinkDirectory(t *testing.T) {
+	sourceDir := t.TempDir()
+	linkDir := filepath.Join(t.TempDir(), "library")
+
+	sources := createSourceFiles(t, sourceDir, "Show - 01.mkv", "Show - 01.srt")
+	operations, err := moveIntoOutputDirectory([]RenameOperation{
+		{OldPath: sources[0], NewPath: filepath.Join(sourceDir, "Anime - S01E01.mkv")},
+		{OldPath: sources[1], NewPath: filepath.Join(sourceDir, "Anime - S01E01.srt")},
+	}, sourceDir, linkDir)
+	if err != nil {
+		t.Fatalf("move into link folder: %v", err)
+	}
+
+	options := ExecuteOptions{Mode: ModeSymlink}
+	if err := preflightOperations(operations, options); err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+
+	if err := executeOperations(operations, options); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	for index, operation := range operations {
+		target, err := os.Readlink(operation.NewPath)
+		if err != nil || target != sources[index] {
+			t.Fatalf("expected %s to link to %s, got %q (%v)", operation.NewPath, sources[index], target, err)
+		}
+
+		if _, err := os.Stat(sources[index]); err != nil {
+			t.Fatalf("expected original %s to stay in place: %v", sources[index], err)
+		}
+	}
+}
+
+func TestSymlinkModeExistingLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	linkDir := filepath.Join(tempDir, "library")
+
+	sources := createSourceFiles(t, tempDir, "Show - 01.mkv", "old.mkv")
+	if err := os.Mkdir(linkDir, 0o755); err != nil {
+		t.Fatalf("create link folder: %v", err)
+	}
+
+	linkPath := filepath.Join(linkDir, "Anime - S01E01.mkv")
+	if err := os.Symlink(sources[1], linkPath); err != nil {
+		t.Fatalf("create existing link: %v", err)
+	}
+
+	operations := []RenameOperation{{OldPath: sources[0], NewPath: linkPath}}
+
+	err := preflightOperations(operations, ExecuteOptions{Mode: ModeSymlink})
+	if err == nil || !strings.Contains(err.Error(), "symlink already exists") {
+		t.Fatalf("expected an existing symlink error, got %v", err)
+	}
+
+	options := ExecuteOptions{Mode: ModeSymlink, ReplaceLinks: true}
+	if err := preflightOperations(operations, options); err != nil {
+		t.Fatalf("preflight with -replace-links: %v", err)
+	}
+
+	if err := executeOperations(operations, options); err != nil {
+		t.Fatalf("execute with -replace-links: %v", err)
+	}
+
+	if target, err := os.Readlink(linkPath); err != nil || target != sources[0] {
+		t.Fatalf("expected replaced link to point at %s, got %q (%v)", sources[0], target, err)
+	}
+}
+
+func TestRenameStrategiesApplyAndUndo(t *testing.T) {
+	testCases := []struct {
+		name       string
+		strategy   renameStrategy
+		wantSource bool
+		wantTarget bool
+	}{
+		{name: "move", strategy: moveStrategy{move: os.Rename}, wantTarget: true},
+		{name: "copy", strategy: copyStrategy{transfer: copyFile}, wantSource: true, wantTarget: true},
+		{name: "link", strategy: copyStrategy{transfer: linkFile}, wantSource: true, wantTarget: true},
+	}
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			source := createSourceFiles(t, tempDir, "Show - 01.mkv")[0]
+			operation := RenameOperation{OldPath: source, NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv")}
+
+			if err := testCase.strategy.Apply(operation); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+
+			if exists(source) != testCase.wantSource || exists(operation.NewPath) != testCase.wantTarget {
+				t.Fatalf(
+					"after apply source exists %t, target exists %t, want %t, %t",
+					exists(source),
+					exists(operation.NewPath),
+					testCase.wantSource,
+					testCase.wantTarget,
+				)
+			}
+
+			if err := testCase.strategy.Undo(operation); err != nil {
+				t.Fatalf("undo: %v", err)
+			}
+
+			if !exists(source) || exists(operation.NewPath) {
+				t.Fatalf("after undo source exists %t, target exists %t", exists(source), exists(operation.NewPath))
+			}
+
+			data, err := os.ReadFile(source)
+			if err != nil || string(data) != "Show - 01.mkv" {
+				t.Fatalf("expected the original content after undo, got %q (%v)", data, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"anime-renamer/thing/renamer"
+)
+
+func runUndo(config AppConfig) error {
+	journal, err := renamer.ReadUndoJournal(config.FolderPath)
+	if err != nil {
+		return err
+	}
+
+	operations := renamer.BuildUndoOperations(journal)
+
+	infof("\nUndoing %d renames from %s:\n", len(operations), journal.CreatedAt.Format(time.RFC1123))
+
+	// Preflight verifies every renamed file is still where the journal left
+	// it and that nothing has taken the original names in the meantime.
+	options := renamer.ExecuteOptions{Mode: renamer.ModeRename, PreserveModTimes: config.KeepModTimes}
+	if err := renamer.Preflight(operations, options); err != nil {
+		return err
+	}
+
+	if config.DryRun {
+		printOperations(operations, true, options.Mode)
+		return nil
+	}
+
+	if !config.AssumeYes {
+		confirmed, err := confirmRename(stdinReader, messageOutput, config.DefaultAnswer)
+		if err != nil {
+			return err
+		}
+
+		if !confirmed {
+			fmt.Fprintln(messageOutput, "Undo cancelled.")
+			return nil
+		}
+	}
+
+	options.Progress = newProgress(progressVerb(options.Mode))
+	if err := renamer.Execute(operations, options); err != nil {
+		return err
+	}
+	printOperations(operations, false, options.Mode)
+
+	return renamer.RemoveUndoJournal(config.FolderPath)
+}
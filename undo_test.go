@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anime-renamer/thing/renamer"
+)
+
+func TestUndoJournalRestoresOriginalNames(t *testing.T) {
+	tempDir := t.TempDir()
+
+	oldVideo := filepath.Join(tempDir, "episode-01.mkv")
+	oldSubtitle := filepath.Join(tempDir, "episode-01.srt")
+	newVideo := filepath.Join(tempDir, "Anime - S01E01.mkv")
+	newSubtitle := filepath.Join(tempDir, "Anime - S01E01.srt")
+
+	for _, path := range []string{oldVideo, oldSubtitle} {
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+	}
+
+	operations := []renamer.RenameOperation{
+		{OldPath: oldVideo, NewPath: newVideo},
+		{OldPath: oldSubtitle, NewPath: newSubtitle},
+	}
+
+	if err := renamer.Execute(operations, renamer.ExecuteOptions{}); err != nil {
+		t.Fatalf("execute rename: %v", err)
+	}
+
+	if err := renamer.WriteUndoJournal(tempDir, operations); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+
+	if err := runUndo(AppConfig{FolderPath: tempDir, AssumeYes: true}); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+
+	for _, path := range []string{oldVideo, oldSubtitle} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected %s to be restored: %v", path, err)
+		}
+	}
+
+	for _, path := range []string{newVideo, newSubtitle, filepath.Join(tempDir, renamer.UndoJournalName)} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s to be gone after undo, got: %v", path, err)
+		}
+	}
+}
+
+func TestUndoJournalFailsWhenRenamedFileIsMissing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	operations := []renamer.RenameOperation{{
+		OldPath: filepath.Join(tempDir, "episode-01.mkv"),
+		NewPath: filepath.Join(tempDir, "Anime - S01E01.mkv"),
+	}}
+
+	if err := renamer.WriteUndoJournal(tempDir, operations); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+
+	err := runUndo(AppConfig{FolderPath: tempDir, AssumeYes: true})
+
+	var preflightErr *renamer.PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("expected preflight error for missing renamed file, got: %v", err)
+	}
+}